@@ -0,0 +1,110 @@
+package admin
+
+import (
+	"context"
+
+	"github.com/kunal768/go-grpc-tc/audit"
+	pb "github.com/kunal768/go-grpc-tc/proto/admin/v1"
+	"github.com/kunal768/go-grpc-tc/ratelimit"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+type Options struct {
+	// Limiter reports the usage of GetUsage, which is Unimplemented without
+	// it.
+	Limiter *ratelimit.Limiter
+	// AuditLog answers QueryAuditLog, which is Unimplemented without it.
+	AuditLog *audit.Log
+}
+
+type server struct {
+	pb.UnimplementedAdminServiceServer
+	opts Options
+}
+
+// NewServer implements the AdminService operators use to inspect the server.
+func NewServer(opts Options) pb.AdminServiceServer {
+	return &server{opts: opts}
+}
+
+func (s *server) GetUsage(ctx context.Context, req *pb.UsageRequest) (*pb.UsageResponse, error) {
+	if s.opts.Limiter == nil {
+		return nil, status.Error(codes.Unimplemented, "rate limiting is disabled")
+	}
+
+	resp := &pb.UsageResponse{QuotaResetTime: timestamppb.New(s.opts.Limiter.QuotaReset())}
+	for _, client := range s.opts.Limiter.Usage(req.Client) {
+		usage := &pb.ClientUsage{Client: client.Client}
+		for _, method := range client.Methods {
+			usage.Methods = append(usage.Methods, &pb.MethodUsage{
+				Method:     method.Method,
+				Tokens:     method.Tokens,
+				Burst:      int32(method.Limit.Burst),
+				Rate:       method.Limit.Rate,
+				QuotaUsed:  method.QuotaUsed,
+				QuotaLimit: method.Limit.DailyQuota,
+			})
+		}
+		resp.Clients = append(resp.Clients, usage)
+	}
+	return resp, nil
+}
+
+const (
+	// defaultAuditPageSize is the page size of QueryAuditLog calls without
+	// one.
+	defaultAuditPageSize = 100
+	// maxAuditPageSize caps the page size of QueryAuditLog calls.
+	maxAuditPageSize = 1000
+)
+
+func (s *server) QueryAuditLog(ctx context.Context, req *pb.QueryAuditLogRequest) (*pb.QueryAuditLogResponse, error) {
+	if s.opts.AuditLog == nil {
+		return nil, status.Error(codes.Unimplemented, "audit logging is disabled")
+	}
+	if req.PageSize < 0 {
+		return nil, status.Error(codes.InvalidArgument, "page_size must not be negative")
+	}
+
+	q := audit.Query{
+		Tenant:    req.Tenant,
+		Principal: req.Principal,
+		Method:    req.Method,
+		UserID:    req.UserId,
+		AfterSeq:  req.AfterSeq,
+		Limit:     int(req.PageSize),
+	}
+	if q.Limit == 0 {
+		q.Limit = defaultAuditPageSize
+	}
+	q.Limit = min(q.Limit, maxAuditPageSize)
+	if req.Since != nil {
+		q.Since = req.Since.AsTime()
+	}
+	if req.Until != nil {
+		q.Until = req.Until.AsTime()
+	}
+	records, err := s.opts.AuditLog.Query(q)
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "reading audit log: %v", err)
+	}
+
+	resp := &pb.QueryAuditLogResponse{}
+	for _, r := range records {
+		resp.Records = append(resp.Records, &pb.AuditRecord{
+			Seq:       r.Seq,
+			Time:      timestamppb.New(r.Time),
+			Tenant:    r.Tenant,
+			Principal: r.Principal,
+			Peer:      r.Peer,
+			Method:    r.Method,
+			UserIds:   r.UserIDs,
+			Code:      r.Code,
+			PrevHash:  r.PrevHash,
+			Hash:      r.Hash,
+		})
+	}
+	return resp, nil
+}
@@ -0,0 +1,76 @@
+package admin
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/kunal768/go-grpc-tc/audit"
+	pb "github.com/kunal768/go-grpc-tc/proto/admin/v1"
+	"github.com/kunal768/go-grpc-tc/ratelimit"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestGetUsage(t *testing.T) {
+	t.Run("Unimplemented without a limiter", func(t *testing.T) {
+		_, err := NewServer(Options{}).GetUsage(context.Background(), &pb.UsageRequest{})
+		assert.Equal(t, codes.Unimplemented, status.Code(err))
+	})
+
+	t.Run("Reports every client", func(t *testing.T) {
+		now := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+		limiter := ratelimit.New(ratelimit.Options{
+			Default: ratelimit.Limit{Rate: 1, Burst: 5, DailyQuota: 100},
+			Now:     func() time.Time { return now },
+		})
+		limiter.Allow("principal:ci", "/UserService/ListUsers")
+		limiter.Allow("peer:10.0.0.1", "/UserService/GetUserByID")
+
+		resp, err := NewServer(Options{Limiter: limiter}).GetUsage(context.Background(), &pb.UsageRequest{})
+		require.NoError(t, err)
+		assert.Equal(t, time.Date(2024, 6, 2, 0, 0, 0, 0, time.UTC), resp.QuotaResetTime.AsTime())
+		require.Len(t, resp.Clients, 2)
+		assert.Equal(t, "peer:10.0.0.1", resp.Clients[0].Client)
+		assert.Equal(t, "principal:ci", resp.Clients[1].Client)
+		assert.Equal(t, &pb.MethodUsage{Method: "*", Tokens: 4, Burst: 5, Rate: 1, QuotaUsed: 1, QuotaLimit: 100}, resp.Clients[1].Methods[0])
+
+		resp, err = NewServer(Options{Limiter: limiter}).GetUsage(context.Background(), &pb.UsageRequest{Client: "principal:ci"})
+		require.NoError(t, err)
+		assert.Len(t, resp.Clients, 1)
+	})
+}
+
+func TestQueryAuditLog(t *testing.T) {
+	t.Run("Unimplemented without an audit log", func(t *testing.T) {
+		_, err := NewServer(Options{}).QueryAuditLog(context.Background(), &pb.QueryAuditLogRequest{})
+		assert.Equal(t, codes.Unimplemented, status.Code(err))
+	})
+
+	t.Run("Pages through matching records", func(t *testing.T) {
+		l, err := audit.Open(filepath.Join(t.TempDir(), "audit.log"))
+		require.NoError(t, err)
+		defer l.Close()
+		for _, id := range []int64{1, 2, 1, 1} {
+			_, err := l.Append(audit.Record{Principal: "alice", Method: "/users.v2.UserService/UpdateUser", UserIDs: []int64{id}, Code: "OK"})
+			require.NoError(t, err)
+		}
+
+		s := NewServer(Options{AuditLog: l})
+		resp, err := s.QueryAuditLog(context.Background(), &pb.QueryAuditLogRequest{UserId: 1, PageSize: 2})
+		require.NoError(t, err)
+		require.Len(t, resp.Records, 2)
+		assert.Equal(t, int64(1), resp.Records[0].Seq)
+		assert.Equal(t, int64(3), resp.Records[1].Seq)
+
+		resp, err = s.QueryAuditLog(context.Background(), &pb.QueryAuditLogRequest{UserId: 1, PageSize: 2, AfterSeq: 3})
+		require.NoError(t, err)
+		require.Len(t, resp.Records, 1)
+		assert.Equal(t, int64(4), resp.Records[0].Seq)
+		assert.Equal(t, "alice", resp.Records[0].Principal)
+		assert.Equal(t, []int64{1}, resp.Records[0].UserIds)
+	})
+}
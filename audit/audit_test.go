@@ -0,0 +1,151 @@
+package audit
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/kunal768/go-grpc-tc/auth"
+	"github.com/kunal768/go-grpc-tc/config"
+	usersv1 "github.com/kunal768/go-grpc-tc/proto/users/v1"
+	pb "github.com/kunal768/go-grpc-tc/proto/users/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestLog(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.log")
+	now := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+	clock := func() time.Time { return now }
+
+	l, err := open(path, clock)
+	require.NoError(t, err)
+	first, err := l.Append(Record{Principal: "alice", Method: "/users.v2.UserService/AddUser", UserIDs: []int64{1}, Code: "OK"})
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), first.Seq)
+	assert.Empty(t, first.PrevHash)
+	now = now.Add(time.Hour)
+	_, err = l.Append(Record{Principal: "bob", Method: "/users.v2.UserService/DeleteUser", UserIDs: []int64{2}, Code: "NotFound"})
+	require.NoError(t, err)
+	require.NoError(t, l.Close())
+
+	t.Run("Reopening continues the chain", func(t *testing.T) {
+		l, err := open(path, clock)
+		require.NoError(t, err)
+		defer l.Close()
+		third, err := l.Append(Record{Principal: "alice", Method: "/users.v2.UserService/UpdateUser", UserIDs: []int64{1}, Code: "OK"})
+		require.NoError(t, err)
+		assert.Equal(t, int64(3), third.Seq)
+
+		data, err := os.ReadFile(path)
+		require.NoError(t, err)
+		last, err := Verify(bytes.NewReader(data))
+		require.NoError(t, err)
+		assert.Equal(t, third, last)
+
+		records, err := l.Query(Query{UserID: 1})
+		require.NoError(t, err)
+		assert.Len(t, records, 2)
+		assert.Equal(t, first, records[0])
+
+		records, err = l.Query(Query{Principal: "alice", AfterSeq: 1, Limit: 1})
+		require.NoError(t, err)
+		assert.Equal(t, []Record{third}, records)
+
+		records, err = l.Query(Query{Until: now})
+		require.NoError(t, err)
+		assert.Equal(t, []Record{first}, records)
+
+		// a record being appended is not read
+		f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0)
+		require.NoError(t, err)
+		_, err = f.WriteString(`{"seq":4,"time":`)
+		require.NoError(t, err)
+		require.NoError(t, f.Close())
+		records, err = l.Query(Query{})
+		require.NoError(t, err)
+		assert.Len(t, records, 3)
+	})
+
+	t.Run("Tampering is detected", func(t *testing.T) {
+		data, err := os.ReadFile(path)
+		require.NoError(t, err)
+		lines := strings.SplitAfter(string(data), "\n")
+
+		_, err = Verify(strings.NewReader(strings.Replace(string(data), `"principal":"bob"`, `"principal":"eve"`, 1)))
+		assert.ErrorContains(t, err, "record 2: hash does not match")
+
+		_, err = Verify(strings.NewReader(lines[0] + lines[2]))
+		assert.ErrorContains(t, err, "record 3: expected sequence number 2")
+
+		tampered := filepath.Join(t.TempDir(), "audit.log")
+		require.NoError(t, os.WriteFile(tampered, []byte(lines[1]+lines[0]), 0o600))
+		_, err = Open(tampered)
+		assert.Error(t, err)
+	})
+}
+
+func TestAuditor(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.log")
+	l, err := Open(path)
+	require.NoError(t, err)
+	defer l.Close()
+
+	interceptor := NewAuditor(l, Options{
+		Methods:         []string{"/users.v2.UserService/AddUser"},
+		SensitiveFields: []string{"phone"},
+	}).UnaryInterceptor()
+	ctx := auth.NewContext(context.Background(), auth.Principal{Subject: "alice"})
+	call := func(method string, req any, resp any, err error) {
+		_, _ = interceptor(ctx, req, &grpc.UnaryServerInfo{FullMethod: method}, func(ctx context.Context, req any) (any, error) {
+			return resp, err
+		})
+	}
+
+	john := &pb.User{Id: 1, Fname: "John", Phone: 1234567890}
+	call("/users.v2.UserService/AddUser", &pb.AddUserRequest{User: john}, &pb.UserResponse{User: john}, nil)
+	call("/users.v2.UserService/AddUser", &pb.AddUserRequest{User: john}, (*pb.UserResponse)(nil), status.Error(codes.AlreadyExists, "exists"))
+	call("/users.v2.UserService/GetUsersByIDs", &pb.GetUsersByIDsRequest{Ids: []int64{1, 2}}, &pb.UsersResponse{Users: []*pb.User{john}}, nil)
+	// phone masked or missing, nothing sensitive was read
+	call("/users.v2.UserService/GetUserByID", &pb.GetUserByIDRequest{Id: 2}, &pb.UserResponse{User: &pb.User{Id: 2, Fname: "Jane"}}, nil)
+
+	records, err := l.Query(Query{})
+	require.NoError(t, err)
+	require.Len(t, records, 3)
+	assert.Equal(t, "alice", records[0].Principal)
+	assert.Equal(t, []int64{1}, records[0].UserIDs)
+	assert.Equal(t, "OK", records[0].Code)
+	assert.Equal(t, "AlreadyExists", records[1].Code)
+	assert.Equal(t, "/users.v2.UserService/GetUsersByIDs", records[2].Method)
+	assert.Equal(t, []int64{1, 2}, records[2].UserIDs)
+}
+
+func TestAuditor_DefaultMethods(t *testing.T) {
+	l, err := Open(filepath.Join(t.TempDir(), "audit.log"))
+	require.NoError(t, err)
+	defer l.Close()
+
+	defaults := config.Default().Audit
+	interceptor := NewAuditor(l, Options{Methods: defaults.Methods, SensitiveFields: defaults.SensitiveFields}).UnaryInterceptor()
+	ctx := auth.NewContext(context.Background(), auth.Principal{Subject: "alice"})
+
+	// the policy masked the phone, the legacy write is audited by its name
+	john := &usersv1.User{Id: 1, Fname: "John"}
+	_, err = interceptor(ctx, john, &grpc.UnaryServerInfo{FullMethod: "/UserService/AddUser"}, func(ctx context.Context, req any) (any, error) {
+		return &usersv1.UserResponse{User: john}, nil
+	})
+	require.NoError(t, err)
+
+	records, err := l.Query(Query{})
+	require.NoError(t, err)
+	require.Len(t, records, 1)
+	assert.Equal(t, "/UserService/AddUser", records[0].Method)
+	assert.Equal(t, []int64{1}, records[0].UserIDs)
+}
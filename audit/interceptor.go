@@ -0,0 +1,144 @@
+package audit
+
+import (
+	"context"
+	"sort"
+	"strings"
+
+	"github.com/kunal768/go-grpc-tc/auth"
+	"github.com/kunal768/go-grpc-tc/tenant"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+type Options struct {
+	// Methods are full method names, or prefixes ending in "*", audited on
+	// every call, such as mutations.
+	Methods []string
+	// SensitiveFields are field names that get any other RPC audited when
+	// its response has one of them set, such as phone.
+	SensitiveFields []string
+	// OnError is called when a record cannot be written. The RPC still
+	// completes.
+	OnError func(method string, err error)
+}
+
+// Auditor records audited RPCs to a Log.
+type Auditor struct {
+	log       *Log
+	opts      Options
+	sensitive map[protoreflect.Name]bool
+}
+
+func NewAuditor(log *Log, opts Options) *Auditor {
+	sensitive := map[protoreflect.Name]bool{}
+	for _, field := range opts.SensitiveFields {
+		sensitive[protoreflect.Name(field)] = true
+	}
+	return &Auditor{log: log, opts: opts, sensitive: sensitive}
+}
+
+func (a *Auditor) always(method string) bool {
+	for _, pattern := range a.opts.Methods {
+		if prefix, ok := strings.CutSuffix(pattern, "*"); ok {
+			if strings.HasPrefix(method, prefix) {
+				return true
+			}
+		} else if method == pattern {
+			return true
+		}
+	}
+	return false
+}
+
+// hasSensitive reports whether a sensitive field is set anywhere in m.
+func (a *Auditor) hasSensitive(m protoreflect.Message) bool {
+	found := false
+	m.Range(func(fd protoreflect.FieldDescriptor, v protoreflect.Value) bool {
+		switch {
+		case a.sensitive[fd.Name()]:
+			found = true
+		case fd.Message() == nil:
+		case fd.IsList():
+			for i := 0; i < v.List().Len() && !found; i++ {
+				found = a.hasSensitive(v.List().Get(i).Message())
+			}
+		case !fd.IsMap():
+			found = a.hasSensitive(v.Message())
+		}
+		return !found
+	})
+	return found
+}
+
+// userIDs collects the user IDs in m: the id and ids fields of it and of
+// the messages it holds.
+func userIDs(m protoreflect.Message, ids map[int64]bool) {
+	m.Range(func(fd protoreflect.FieldDescriptor, v protoreflect.Value) bool {
+		switch {
+		case fd.Name() == "id" && fd.Kind() == protoreflect.Int64Kind && !fd.IsList():
+			ids[v.Int()] = true
+		case fd.Name() == "ids" && fd.Kind() == protoreflect.Int64Kind && fd.IsList():
+			for i := 0; i < v.List().Len(); i++ {
+				ids[v.List().Get(i).Int()] = true
+			}
+		case fd.Message() == nil || fd.IsMap():
+		case fd.IsList():
+			for i := 0; i < v.List().Len(); i++ {
+				userIDs(v.List().Get(i).Message(), ids)
+			}
+		default:
+			userIDs(v.Message(), ids)
+		}
+		return true
+	})
+}
+
+func (a *Auditor) record(ctx context.Context, method string, req, resp any, err error) {
+	r := Record{Method: method, Code: status.Code(err).String()}
+	r.Tenant, _ = tenant.FromContext(ctx)
+	if p, ok := auth.FromContext(ctx); ok {
+		r.Principal = p.Subject
+	}
+	if p, ok := peer.FromContext(ctx); ok && p.Addr != nil {
+		r.Peer = p.Addr.String()
+	}
+
+	ids := map[int64]bool{}
+	for _, msg := range []any{req, resp} {
+		if m, ok := msg.(proto.Message); ok && m.ProtoReflect().IsValid() {
+			userIDs(m.ProtoReflect(), ids)
+		}
+	}
+	for id := range ids {
+		r.UserIDs = append(r.UserIDs, id)
+	}
+	sort.Slice(r.UserIDs, func(i, j int) bool { return r.UserIDs[i] < r.UserIDs[j] })
+
+	if _, err := a.log.Append(r); err != nil && a.opts.OnError != nil {
+		a.opts.OnError(method, err)
+	}
+}
+
+// UnaryInterceptor audits the RPCs in Options.Methods and those returning a
+// sensitive field. It has to run after authentication to know the
+// principal, and outside of the policy so denied calls are audited and only
+// the fields callers were shown count.
+func (a *Auditor) UnaryInterceptor() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		resp, err := handler(ctx, req)
+		audited := a.always(info.FullMethod)
+		if !audited && err == nil {
+			if m, ok := resp.(proto.Message); ok && m.ProtoReflect().IsValid() {
+				audited = a.hasSensitive(m.ProtoReflect())
+			}
+		}
+		if audited {
+			a.record(ctx, info.FullMethod, req, resp, err)
+		}
+		return resp, err
+	}
+}
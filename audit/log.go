@@ -0,0 +1,240 @@
+package audit
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+)
+
+// Record is one audited RPC. Hash covers every other field, PrevHash is the
+// hash of the record before it, so changing, dropping or reordering records
+// breaks the chain.
+type Record struct {
+	Seq       int64     `json:"seq"`
+	Time      time.Time `json:"time"`
+	Tenant    string    `json:"tenant,omitempty"`
+	Principal string    `json:"principal,omitempty"`
+	Peer      string    `json:"peer,omitempty"`
+	Method    string    `json:"method"`
+	UserIDs   []int64   `json:"user_ids,omitempty"`
+	// Code is the gRPC status code the RPC ended with.
+	Code     string `json:"code"`
+	PrevHash string `json:"prev_hash"`
+	Hash     string `json:"hash,omitempty"`
+}
+
+// hash is the hash of r, computed over its JSON encoding without Hash.
+func (r Record) hash() string {
+	r.Hash = ""
+	data, _ := json.Marshal(r)
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// Log is an append-only, hash-chained file of records, one JSON record per
+// line.
+type Log struct {
+	path string
+	now  func() time.Time
+
+	mu   sync.Mutex
+	f    *os.File
+	seq  int64
+	last string
+	// size is the length of the complete records written so far.
+	size int64
+}
+
+// Open opens the log at path, creating it if needed. An existing log is
+// verified first, Open fails if it was tampered with.
+func Open(path string) (*Log, error) {
+	return open(path, time.Now)
+}
+
+func open(path string, now func() time.Time) (*Log, error) {
+	l := &Log{path: path, now: now}
+	if f, err := os.Open(path); err == nil {
+		last, err := Verify(f)
+		f.Close()
+		if err != nil {
+			return nil, fmt.Errorf("audit log %s: %w", path, err)
+		}
+		l.seq, l.last = last.Seq, last.Hash
+	} else if !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o600)
+	if err != nil {
+		return nil, err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	l.f, l.size = f, info.Size()
+	return l, nil
+}
+
+// Append chains r to the log and writes it to disk before returning it.
+// Seq, Time, PrevHash and Hash are set by the log.
+func (l *Log) Append(r Record) (Record, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.f == nil {
+		return Record{}, os.ErrClosed
+	}
+
+	r.Seq = l.seq + 1
+	r.Time = l.now().UTC()
+	r.PrevHash = l.last
+	r.Hash = r.hash()
+
+	line, err := json.Marshal(r)
+	if err != nil {
+		return Record{}, err
+	}
+	n, err := l.f.Write(append(line, '\n'))
+	if err != nil {
+		return Record{}, err
+	}
+	if err := l.f.Sync(); err != nil {
+		return Record{}, err
+	}
+	l.seq, l.last, l.size = r.Seq, r.Hash, l.size+int64(n)
+	return r, nil
+}
+
+func (l *Log) Close() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.f == nil {
+		return nil
+	}
+	err := l.f.Close()
+	l.f = nil
+	return err
+}
+
+// Query filters the records of a log. Zero fields match every record.
+type Query struct {
+	Tenant    string
+	Principal string
+	Method    string
+	UserID    int64
+	Since     time.Time
+	Until     time.Time
+	// AfterSeq skips the records up to it, to page through the log.
+	AfterSeq int64
+	// Limit caps the records returned, 0 for no limit.
+	Limit int
+}
+
+func (q Query) match(r Record) bool {
+	if r.Seq <= q.AfterSeq {
+		return false
+	}
+	if q.Tenant != "" && r.Tenant != q.Tenant {
+		return false
+	}
+	if q.Principal != "" && r.Principal != q.Principal {
+		return false
+	}
+	if q.Method != "" && r.Method != q.Method {
+		return false
+	}
+	if !q.Since.IsZero() && r.Time.Before(q.Since) {
+		return false
+	}
+	if !q.Until.IsZero() && !r.Time.Before(q.Until) {
+		return false
+	}
+	if q.UserID != 0 {
+		for _, id := range r.UserIDs {
+			if id == q.UserID {
+				return true
+			}
+		}
+		return false
+	}
+	return true
+}
+
+// Query returns the records matching q, oldest first. It reads the records
+// written when it started from a handle of its own, so appends go on meanwhile.
+func (l *Log) Query(q Query) ([]Record, error) {
+	l.mu.Lock()
+	size := l.size
+	l.mu.Unlock()
+
+	f, err := os.Open(l.path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	// records past size may be half written
+	records := []Record{}
+	err = scan(io.LimitReader(f, size), func(r Record) error {
+		if q.match(r) {
+			records = append(records, r)
+		}
+		if q.Limit > 0 && len(records) == q.Limit {
+			return errStop
+		}
+		return nil
+	})
+	if err != nil && err != errStop {
+		return nil, err
+	}
+	return records, nil
+}
+
+var errStop = errors.New("stop")
+
+// scan decodes the records of r in order, stopping at the first error of fn.
+func scan(r io.Reader, fn func(Record) error) error {
+	s := bufio.NewScanner(r)
+	s.Buffer(make([]byte, 64*1024), 1<<20)
+	for line := 1; s.Scan(); line++ {
+		var record Record
+		dec := json.NewDecoder(bytes.NewReader(s.Bytes()))
+		dec.DisallowUnknownFields()
+		if err := dec.Decode(&record); err != nil {
+			return fmt.Errorf("line %d: %w", line, err)
+		}
+		if err := fn(record); err != nil {
+			return err
+		}
+	}
+	return s.Err()
+}
+
+// Verify checks the chain of the log read from r and returns its last record.
+// It fails at the first record that was changed, inserted, dropped or
+// reordered.
+func Verify(r io.Reader) (Record, error) {
+	var last Record
+	err := scan(r, func(record Record) error {
+		switch {
+		case record.Seq != last.Seq+1:
+			return fmt.Errorf("record %d: expected sequence number %d", record.Seq, last.Seq+1)
+		case record.PrevHash != last.Hash:
+			return fmt.Errorf("record %d: previous hash does not match record %d", record.Seq, last.Seq)
+		case record.Hash != record.hash():
+			return fmt.Errorf("record %d: hash does not match its contents", record.Seq)
+		}
+		last = record
+		return nil
+	})
+	return last, err
+}
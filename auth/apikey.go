@@ -0,0 +1,68 @@
+package auth
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// APIKey is an entry of the API key file. Only the SHA-256 of the key is
+// stored, as "sha256:<hex>".
+type APIKey struct {
+	ID     string   `yaml:"id"`
+	Hash   string   `yaml:"hash"`
+	Roles  []string `yaml:"roles"`
+	Tenant string   `yaml:"tenant"`
+}
+
+type apiKeyFile struct {
+	Keys []APIKey `yaml:"keys"`
+}
+
+// APIKeys looks keys up by their hash.
+type APIKeys map[string]APIKey
+
+func HashAPIKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return "sha256:" + hex.EncodeToString(sum[:])
+}
+
+func LoadAPIKeys(path string) (APIKeys, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var file apiKeyFile
+	if err := yaml.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+
+	keys := APIKeys{}
+	for i, key := range file.Keys {
+		if key.ID == "" {
+			return nil, fmt.Errorf("%s: key %d has no id", path, i+1)
+		}
+		hash := strings.ToLower(key.Hash)
+		if !strings.HasPrefix(hash, "sha256:") || len(hash) != len("sha256:")+sha256.Size*2 {
+			return nil, fmt.Errorf("%s: key %q: hash must be sha256:<64 hex digits>", path, key.ID)
+		}
+		if _, err := hex.DecodeString(strings.TrimPrefix(hash, "sha256:")); err != nil {
+			return nil, fmt.Errorf("%s: key %q: %w", path, key.ID, err)
+		}
+		keys[hash] = key
+	}
+	return keys, nil
+}
+
+func (k APIKeys) Authenticate(key string) (Principal, bool) {
+	entry, ok := k[HashAPIKey(key)]
+	if !ok {
+		return Principal{}, false
+	}
+	return Principal{Subject: entry.ID, Method: "api_key", Roles: entry.Roles, Tenant: entry.Tenant}, true
+}
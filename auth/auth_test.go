@@ -0,0 +1,224 @@
+package auth
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	pb "github.com/kunal768/go-grpc-tc/proto/users/v1"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+func writeFile(t *testing.T, name, content string) string {
+	path := filepath.Join(t.TempDir(), name)
+	require.NoError(t, os.WriteFile(path, []byte(content), 0o600))
+	return path
+}
+
+func TestLoadAPIKeys(t *testing.T) {
+	t.Run("Authenticates a listed key", func(t *testing.T) {
+		path := writeFile(t, "keys.yaml", "keys:\n  - id: ci\n    hash: "+HashAPIKey("s3cret")+"\n    roles: [reader]\n")
+		keys, err := LoadAPIKeys(path)
+		require.NoError(t, err)
+
+		p, ok := keys.Authenticate("s3cret")
+		require.True(t, ok)
+		assert.Equal(t, Principal{Subject: "ci", Method: "api_key", Roles: []string{"reader"}}, p)
+
+		_, ok = keys.Authenticate("wrong")
+		assert.False(t, ok)
+	})
+
+	t.Run("Rejects a malformed hash", func(t *testing.T) {
+		path := writeFile(t, "keys.yaml", "keys:\n  - id: ci\n    hash: s3cret\n")
+		_, err := LoadAPIKeys(path)
+		assert.ErrorContains(t, err, "sha256:<64 hex digits>")
+	})
+}
+
+func TestJWTVerifier(t *testing.T) {
+	claims := jwt.MapClaims{"sub": "alice", "roles": []string{"admin"}, "iss": "issuer", "exp": time.Now().Add(time.Hour).Unix()}
+
+	t.Run("Shared secret", func(t *testing.T) {
+		v, err := NewJWTVerifier(JWTOptions{Secret: []byte("secret"), Issuer: "issuer"})
+		require.NoError(t, err)
+
+		token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString([]byte("secret"))
+		require.NoError(t, err)
+		p, err := v.Authenticate(token)
+		require.NoError(t, err)
+		assert.Equal(t, Principal{Subject: "alice", Method: "jwt", Roles: []string{"admin"}}, p)
+
+		forged, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString([]byte("other"))
+		require.NoError(t, err)
+		_, err = v.Authenticate(forged)
+		assert.Error(t, err)
+
+		expired := jwt.MapClaims{"sub": "alice", "iss": "issuer", "exp": time.Now().Add(-time.Minute).Unix()}
+		token, err = jwt.NewWithClaims(jwt.SigningMethodHS256, expired).SignedString([]byte("secret"))
+		require.NoError(t, err)
+		_, err = v.Authenticate(token)
+		assert.ErrorIs(t, err, jwt.ErrTokenExpired)
+
+		wrongIssuer := jwt.MapClaims{"sub": "alice", "iss": "other", "exp": time.Now().Add(time.Hour).Unix()}
+		token, err = jwt.NewWithClaims(jwt.SigningMethodHS256, wrongIssuer).SignedString([]byte("secret"))
+		require.NoError(t, err)
+		_, err = v.Authenticate(token)
+		assert.ErrorIs(t, err, jwt.ErrTokenInvalidIssuer)
+
+		bound := jwt.MapClaims{"sub": "alice", "iss": "issuer", "tenant": "acme", "exp": time.Now().Add(time.Hour).Unix()}
+		token, err = jwt.NewWithClaims(jwt.SigningMethodHS256, bound).SignedString([]byte("secret"))
+		require.NoError(t, err)
+		p, err = v.Authenticate(token)
+		require.NoError(t, err)
+		assert.Equal(t, "acme", p.Tenant)
+	})
+
+	t.Run("JWKS file", func(t *testing.T) {
+		key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		require.NoError(t, err)
+		set, err := json.Marshal(map[string]any{"keys": []map[string]string{{
+			"kty": "EC",
+			"kid": "k1",
+			"crv": "P-256",
+			"x":   base64.RawURLEncoding.EncodeToString(key.X.FillBytes(make([]byte, 32))),
+			"y":   base64.RawURLEncoding.EncodeToString(key.Y.FillBytes(make([]byte, 32))),
+		}}})
+		require.NoError(t, err)
+		v, err := NewJWTVerifier(JWTOptions{JWKSFile: writeFile(t, "jwks.json", string(set))})
+		require.NoError(t, err)
+
+		token := jwt.NewWithClaims(jwt.SigningMethodES256, claims)
+		token.Header["kid"] = "k1"
+		signed, err := token.SignedString(key)
+		require.NoError(t, err)
+		p, err := v.Authenticate(signed)
+		require.NoError(t, err)
+		assert.Equal(t, "alice", p.Subject)
+
+		// an HMAC token must not be accepted with the public key as secret
+		hmac, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString([]byte("secret"))
+		require.NoError(t, err)
+		_, err = v.Authenticate(hmac)
+		assert.Error(t, err)
+	})
+}
+
+func TestAuthenticator(t *testing.T) {
+	verifier, err := NewJWTVerifier(JWTOptions{Secret: []byte("secret")})
+	require.NoError(t, err)
+	a := NewAuthenticator(Options{
+		APIKeys:       APIKeys{HashAPIKey("s3cret"): {ID: "ci", Hash: HashAPIKey("s3cret")}},
+		JWT:           verifier,
+		ExemptMethods: []string{"/grpc.health.v1.Health/*"},
+	})
+	interceptor := a.UnaryInterceptor()
+
+	call := func(method string, md metadata.MD) (Principal, bool, error) {
+		var (
+			p  Principal
+			ok bool
+		)
+		ctx := metadata.NewIncomingContext(context.Background(), md)
+		_, err := interceptor(ctx, nil, &grpc.UnaryServerInfo{FullMethod: method}, func(ctx context.Context, req any) (any, error) {
+			p, ok = FromContext(ctx)
+			return nil, nil
+		})
+		return p, ok, err
+	}
+
+	token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{"sub": "alice", "exp": time.Now().Add(time.Hour).Unix()}).SignedString([]byte("secret"))
+	require.NoError(t, err)
+
+	tests := []struct {
+		name    string
+		method  string
+		md      metadata.MD
+		subject string
+		code    codes.Code
+	}{
+		{"API key", "/UserService/AddUser", metadata.Pairs(APIKeyHeader, "s3cret"), "ci", codes.OK},
+		{"Bearer token", "/UserService/AddUser", metadata.Pairs(AuthorizationHeader, "Bearer "+token), "alice", codes.OK},
+		{"Wrong API key", "/UserService/AddUser", metadata.Pairs(APIKeyHeader, "wrong"), "", codes.Unauthenticated},
+		{"Invalid token", "/UserService/AddUser", metadata.Pairs(AuthorizationHeader, "Bearer garbage"), "", codes.Unauthenticated},
+		{"Basic auth", "/UserService/AddUser", metadata.Pairs(AuthorizationHeader, "Basic dXNlcjpwYXNz"), "", codes.Unauthenticated},
+		{"No credentials", "/UserService/AddUser", metadata.MD{}, "", codes.Unauthenticated},
+		{"Exempt method", "/grpc.health.v1.Health/Check", metadata.MD{}, "", codes.OK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, ok, err := call(tt.method, tt.md)
+			assert.Equal(t, tt.code, status.Code(err))
+			assert.Equal(t, tt.subject != "", ok)
+			assert.Equal(t, tt.subject, p.Subject)
+		})
+	}
+}
+
+func TestPolicy(t *testing.T) {
+	path := writeFile(t, "policy.yaml", `
+roles:
+  reader: [users.read]
+  support: [users.read, users.read_phone]
+  admin: ["*"]
+methods:
+  /UserService/Get*: users.read
+  /UserService/AddUser: users.write
+fields:
+  phone: users.read_phone
+`)
+	policy, err := LoadPolicy(path)
+	require.NoError(t, err)
+	interceptor := policy.UnaryInterceptor()
+
+	call := func(roles []string, method string) (*pb.UsersResponse, error) {
+		ctx := NewContext(context.Background(), Principal{Subject: "alice", Roles: roles})
+		resp, err := interceptor(ctx, nil, &grpc.UnaryServerInfo{FullMethod: method}, func(ctx context.Context, req any) (any, error) {
+			return &pb.UsersResponse{Users: []*pb.User{{Id: 1, Fname: "John", Phone: 1234567890}}}, nil
+		})
+		if err != nil {
+			return nil, err
+		}
+		return resp.(*pb.UsersResponse), nil
+	}
+
+	t.Run("Denies RPCs without the permission", func(t *testing.T) {
+		_, err := call([]string{"reader"}, "/UserService/AddUser")
+		assert.Equal(t, codes.PermissionDenied, status.Code(err))
+		_, err = call([]string{"admin"}, "/UserService/AddUser")
+		assert.NoError(t, err)
+		_, err = call([]string{"admin"}, "/UserService/SearchUsers")
+		assert.Equal(t, codes.PermissionDenied, status.Code(err), "methods without an entry are denied")
+	})
+
+	t.Run("Masks fields without the permission", func(t *testing.T) {
+		resp, err := call([]string{"reader"}, "/UserService/GetUsersByIDs")
+		require.NoError(t, err)
+		assert.Zero(t, resp.Users[0].Phone)
+		assert.Equal(t, "John", resp.Users[0].Fname)
+
+		resp, err = call([]string{"support"}, "/UserService/GetUsersByIDs")
+		require.NoError(t, err)
+		assert.EqualValues(t, 1234567890, resp.Users[0].Phone)
+	})
+
+	t.Run("Lets exempted calls through", func(t *testing.T) {
+		_, err := interceptor(context.Background(), nil, &grpc.UnaryServerInfo{FullMethod: "/grpc.health.v1.Health/Check"}, func(ctx context.Context, req any) (any, error) {
+			return nil, nil
+		})
+		assert.NoError(t, err)
+	})
+}
@@ -0,0 +1,111 @@
+package auth
+
+import (
+	"context"
+	"strings"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	APIKeyHeader        = "x-api-key"
+	AuthorizationHeader = "authorization"
+)
+
+type Options struct {
+	// APIKeys and JWT are both optional; a caller is accepted when either
+	// authenticates it, or else when it presented a verified client
+	// certificate.
+	APIKeys APIKeys
+	JWT     *JWTVerifier
+	// ExemptMethods are full method names, or prefixes ending in "*", that
+	// skip authentication.
+	ExemptMethods []string
+}
+
+type Authenticator struct {
+	Options
+}
+
+func NewAuthenticator(opts Options) *Authenticator {
+	return &Authenticator{Options: opts}
+}
+
+func (a *Authenticator) exempt(method string) bool {
+	for _, pattern := range a.ExemptMethods {
+		if prefix, ok := strings.CutSuffix(pattern, "*"); ok {
+			if strings.HasPrefix(method, prefix) {
+				return true
+			}
+		} else if method == pattern {
+			return true
+		}
+	}
+	return false
+}
+
+// Authenticate returns ctx with the caller's principal, or an Unauthenticated
+// error. Explicit credentials take precedence over a client certificate.
+// Exempt methods are let through without a principal.
+func (a *Authenticator) Authenticate(ctx context.Context, method string) (context.Context, error) {
+	if a.exempt(method) {
+		return ctx, nil
+	}
+
+	md, _ := metadata.FromIncomingContext(ctx)
+	if values := md.Get(APIKeyHeader); len(values) > 0 {
+		if a.APIKeys != nil {
+			if p, ok := a.APIKeys.Authenticate(values[0]); ok {
+				return NewContext(ctx, p), nil
+			}
+		}
+		return nil, status.Error(codes.Unauthenticated, "invalid API key")
+	}
+	if values := md.Get(AuthorizationHeader); len(values) > 0 {
+		scheme, token, _ := strings.Cut(values[0], " ")
+		if !strings.EqualFold(scheme, "bearer") || a.JWT == nil {
+			return nil, status.Error(codes.Unauthenticated, "unsupported authorization scheme")
+		}
+		p, err := a.JWT.Authenticate(strings.TrimSpace(token))
+		if err != nil {
+			return nil, status.Errorf(codes.Unauthenticated, "invalid token: %v", err)
+		}
+		return NewContext(ctx, p), nil
+	}
+	if cert, ok := PeerCertificate(ctx); ok {
+		return NewContext(ctx, CertificatePrincipal(cert)), nil
+	}
+	return nil, status.Error(codes.Unauthenticated, "missing credentials")
+}
+
+func (a *Authenticator) UnaryInterceptor() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		ctx, err := a.Authenticate(ctx, info.FullMethod)
+		if err != nil {
+			return nil, err
+		}
+		return handler(ctx, req)
+	}
+}
+
+func (a *Authenticator) StreamInterceptor() grpc.StreamServerInterceptor {
+	return func(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		ctx, err := a.Authenticate(ss.Context(), info.FullMethod)
+		if err != nil {
+			return err
+		}
+		return handler(srv, &authenticatedStream{ServerStream: ss, ctx: ctx})
+	}
+}
+
+type authenticatedStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *authenticatedStream) Context() context.Context {
+	return s.ctx
+}
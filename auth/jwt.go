@@ -0,0 +1,206 @@
+package auth
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"strings"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+type JWTOptions struct {
+	// Secret verifies HS256/HS384/HS512 tokens.
+	Secret []byte
+	// JWKSFile is a JSON Web Key Set verifying RS*, PS* and ES* tokens.
+	JWKSFile string
+	// Issuer and Audience, when set, must match the iss and aud claims.
+	Issuer   string
+	Audience string
+	// RolesClaim names the claim holding the caller's roles, either a list
+	// or a space separated string. Defaults to "roles".
+	RolesClaim string
+	// TenantClaim names the claim binding the caller to a tenant. Defaults
+	// to "tenant".
+	TenantClaim string
+}
+
+type JWTVerifier struct {
+	parser      *jwt.Parser
+	keyfunc     jwt.Keyfunc
+	rolesClaim  string
+	tenantClaim string
+}
+
+func NewJWTVerifier(opts JWTOptions) (*JWTVerifier, error) {
+	v := &JWTVerifier{rolesClaim: opts.RolesClaim, tenantClaim: opts.TenantClaim}
+	if v.rolesClaim == "" {
+		v.rolesClaim = "roles"
+	}
+	if v.tenantClaim == "" {
+		v.tenantClaim = "tenant"
+	}
+
+	parserOpts := []jwt.ParserOption{jwt.WithExpirationRequired()}
+	if opts.Issuer != "" {
+		parserOpts = append(parserOpts, jwt.WithIssuer(opts.Issuer))
+	}
+	if opts.Audience != "" {
+		parserOpts = append(parserOpts, jwt.WithAudience(opts.Audience))
+	}
+
+	switch {
+	case len(opts.Secret) > 0 && opts.JWKSFile != "":
+		return nil, errors.New("configure either a JWT secret or a JWKS file, not both")
+	case len(opts.Secret) > 0:
+		secret := opts.Secret
+		v.keyfunc = func(*jwt.Token) (any, error) { return secret, nil }
+		parserOpts = append(parserOpts, jwt.WithValidMethods([]string{"HS256", "HS384", "HS512"}))
+	case opts.JWKSFile != "":
+		keys, err := loadJWKS(opts.JWKSFile)
+		if err != nil {
+			return nil, err
+		}
+		v.keyfunc = keys.keyfunc
+		parserOpts = append(parserOpts, jwt.WithValidMethods([]string{"RS256", "RS384", "RS512", "PS256", "PS384", "PS512", "ES256", "ES384", "ES512"}))
+	default:
+		return nil, errors.New("a JWT secret or JWKS file is required")
+	}
+
+	v.parser = jwt.NewParser(parserOpts...)
+	return v, nil
+}
+
+func (v *JWTVerifier) Authenticate(token string) (Principal, error) {
+	claims := jwt.MapClaims{}
+	if _, err := v.parser.ParseWithClaims(token, claims, v.keyfunc); err != nil {
+		return Principal{}, err
+	}
+
+	subject, err := claims.GetSubject()
+	if err != nil {
+		return Principal{}, err
+	}
+	if subject == "" {
+		return Principal{}, errors.New("token has no sub claim")
+	}
+
+	var roles []string
+	switch value := claims[v.rolesClaim].(type) {
+	case string:
+		roles = strings.Fields(value)
+	case []any:
+		for _, role := range value {
+			if s, ok := role.(string); ok {
+				roles = append(roles, s)
+			}
+		}
+	}
+	tenant, _ := claims[v.tenantClaim].(string)
+	return Principal{Subject: subject, Method: "jwt", Roles: roles, Tenant: tenant}, nil
+}
+
+type jwk struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+// jwks maps key IDs to RSA or ECDSA public keys.
+type jwks map[string]any
+
+func loadJWKS(path string) (jwks, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var set struct {
+		Keys []jwk `json:"keys"`
+	}
+	if err := json.Unmarshal(data, &set); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+
+	keys := jwks{}
+	for _, key := range set.Keys {
+		public, err := key.publicKey()
+		if err != nil {
+			return nil, fmt.Errorf("%s: key %q: %w", path, key.Kid, err)
+		}
+		keys[key.Kid] = public
+	}
+	if len(keys) == 0 {
+		return nil, fmt.Errorf("%s: no keys", path)
+	}
+	return keys, nil
+}
+
+func (k jwk) publicKey() (any, error) {
+	decode := func(s string) (*big.Int, error) {
+		b, err := base64.RawURLEncoding.DecodeString(s)
+		if err != nil {
+			return nil, err
+		}
+		return new(big.Int).SetBytes(b), nil
+	}
+
+	switch k.Kty {
+	case "RSA":
+		n, err := decode(k.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := decode(k.E)
+		if err != nil {
+			return nil, err
+		}
+		return &rsa.PublicKey{N: n, E: int(e.Int64())}, nil
+	case "EC":
+		var curve elliptic.Curve
+		switch k.Crv {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		case "P-521":
+			curve = elliptic.P521()
+		default:
+			return nil, fmt.Errorf("unsupported curve %q", k.Crv)
+		}
+		x, err := decode(k.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := decode(k.Y)
+		if err != nil {
+			return nil, err
+		}
+		return &ecdsa.PublicKey{Curve: curve, X: x, Y: y}, nil
+	}
+	return nil, fmt.Errorf("unsupported key type %q", k.Kty)
+}
+
+func (k jwks) keyfunc(token *jwt.Token) (any, error) {
+	kid, _ := token.Header["kid"].(string)
+	if kid == "" && len(k) == 1 {
+		for _, key := range k {
+			return key, nil
+		}
+	}
+	key, ok := k[kid]
+	if !ok {
+		return nil, fmt.Errorf("unknown key ID %q", kid)
+	}
+	return key, nil
+}
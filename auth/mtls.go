@@ -0,0 +1,42 @@
+package auth
+
+import (
+	"context"
+	"crypto/x509"
+
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/peer"
+)
+
+// PeerCertificate returns the verified client certificate of the RPC, if the
+// connection uses TLS and the client presented one.
+func PeerCertificate(ctx context.Context) (*x509.Certificate, bool) {
+	p, ok := peer.FromContext(ctx)
+	if !ok {
+		return nil, false
+	}
+	info, ok := p.AuthInfo.(credentials.TLSInfo)
+	if !ok || len(info.State.VerifiedChains) == 0 || len(info.State.VerifiedChains[0]) == 0 {
+		return nil, false
+	}
+	return info.State.VerifiedChains[0][0], true
+}
+
+// CertificatePrincipal maps a client certificate to a principal. The subject
+// is its first URI SAN (e.g. a SPIFFE ID), else its first DNS SAN, else its
+// common name, its organizational units are the roles and its first
+// organization the tenant.
+func CertificatePrincipal(cert *x509.Certificate) Principal {
+	subject := cert.Subject.CommonName
+	switch {
+	case len(cert.URIs) > 0:
+		subject = cert.URIs[0].String()
+	case len(cert.DNSNames) > 0:
+		subject = cert.DNSNames[0]
+	}
+	p := Principal{Subject: subject, Method: "mtls", Roles: cert.Subject.OrganizationalUnit}
+	if len(cert.Subject.Organization) > 0 {
+		p.Tenant = cert.Subject.Organization[0]
+	}
+	return p
+}
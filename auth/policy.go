@@ -0,0 +1,180 @@
+package auth
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"gopkg.in/yaml.v3"
+)
+
+// AllPermissions granted to a role gives it every permission.
+const AllPermissions = "*"
+
+// Policy grants permissions to roles and names the permission each RPC, and
+// each message field of a response, requires.
+type Policy struct {
+	// Roles maps a role to its permissions.
+	Roles map[string][]string `yaml:"roles"`
+	// Methods maps full method names, or prefixes ending in "*", to the
+	// permission needed to call them. Methods without an entry are denied.
+	Methods map[string]string `yaml:"methods"`
+	// Fields maps proto field names to the permission needed to see them.
+	// Fields the caller may not see are cleared from responses.
+	Fields map[string]string `yaml:"fields"`
+}
+
+func LoadPolicy(path string) (*Policy, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var p Policy
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+	dec.KnownFields(true)
+	if err := dec.Decode(&p); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	for method, permission := range p.Methods {
+		if permission == "" {
+			return nil, fmt.Errorf("%s: method %q has no permission", path, method)
+		}
+	}
+	for field, permission := range p.Fields {
+		if permission == "" {
+			return nil, fmt.Errorf("%s: field %q has no permission", path, field)
+		}
+	}
+	return &p, nil
+}
+
+// Allowed reports whether any role of principal grants permission.
+func (p *Policy) Allowed(principal Principal, permission string) bool {
+	for _, role := range principal.Roles {
+		granted := p.Roles[role]
+		if slices.Contains(granted, permission) || slices.Contains(granted, AllPermissions) {
+			return true
+		}
+	}
+	return false
+}
+
+// methodPermission returns the permission of the exact method entry, or else
+// of the longest matching prefix.
+func (p *Policy) methodPermission(method string) (string, bool) {
+	if permission, ok := p.Methods[method]; ok && !strings.HasSuffix(method, "*") {
+		return permission, true
+	}
+	var best, permission string
+	for pattern, perm := range p.Methods {
+		prefix, ok := strings.CutSuffix(pattern, "*")
+		if ok && strings.HasPrefix(method, prefix) && len(prefix) >= len(best) {
+			best, permission = prefix, perm
+		}
+	}
+	return permission, permission != ""
+}
+
+// Authorize checks the principal on ctx may call method. Calls without a
+// principal are those the Authenticator exempted and are let through.
+func (p *Policy) Authorize(ctx context.Context, method string) error {
+	principal, ok := FromContext(ctx)
+	if !ok {
+		return nil
+	}
+	permission, ok := p.methodPermission(method)
+	if !ok || !p.Allowed(principal, permission) {
+		return status.Errorf(codes.PermissionDenied, "%s may not call %s", principal.Subject, method)
+	}
+	return nil
+}
+
+// Mask clears, at any depth of msg, the fields principal may not see.
+func (p *Policy) Mask(principal Principal, msg proto.Message) {
+	if len(p.Fields) == 0 || msg == nil {
+		return
+	}
+	hidden := map[protoreflect.Name]bool{}
+	for field, permission := range p.Fields {
+		if !p.Allowed(principal, permission) {
+			hidden[protoreflect.Name(field)] = true
+		}
+	}
+	if len(hidden) > 0 {
+		mask(msg.ProtoReflect(), hidden)
+	}
+}
+
+func mask(m protoreflect.Message, hidden map[protoreflect.Name]bool) {
+	if !m.IsValid() {
+		return
+	}
+	m.Range(func(fd protoreflect.FieldDescriptor, v protoreflect.Value) bool {
+		switch {
+		case hidden[fd.Name()]:
+			m.Clear(fd)
+		case fd.IsList() && fd.Message() != nil:
+			list := v.List()
+			for i := 0; i < list.Len(); i++ {
+				mask(list.Get(i).Message(), hidden)
+			}
+		case fd.IsMap() && fd.MapValue().Message() != nil:
+			v.Map().Range(func(_ protoreflect.MapKey, v protoreflect.Value) bool {
+				mask(v.Message(), hidden)
+				return true
+			})
+		case fd.Message() != nil && !fd.IsMap():
+			mask(v.Message(), hidden)
+		}
+		return true
+	})
+}
+
+func (p *Policy) UnaryInterceptor() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		if err := p.Authorize(ctx, info.FullMethod); err != nil {
+			return nil, err
+		}
+		resp, err := handler(ctx, req)
+		if principal, ok := FromContext(ctx); ok {
+			if msg, isProto := resp.(proto.Message); isProto {
+				p.Mask(principal, msg)
+			}
+		}
+		return resp, err
+	}
+}
+
+func (p *Policy) StreamInterceptor() grpc.StreamServerInterceptor {
+	return func(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		if err := p.Authorize(ss.Context(), info.FullMethod); err != nil {
+			return err
+		}
+		if principal, ok := FromContext(ss.Context()); ok {
+			ss = &maskedStream{ServerStream: ss, policy: p, principal: principal}
+		}
+		return handler(srv, ss)
+	}
+}
+
+type maskedStream struct {
+	grpc.ServerStream
+	policy    *Policy
+	principal Principal
+}
+
+func (s *maskedStream) SendMsg(m any) error {
+	if msg, ok := m.(proto.Message); ok {
+		s.policy.Mask(s.principal, msg)
+	}
+	return s.ServerStream.SendMsg(m)
+}
@@ -0,0 +1,26 @@
+package auth
+
+import "context"
+
+// Principal is the authenticated caller of an RPC.
+type Principal struct {
+	// Subject identifies the caller: the API key ID, the JWT "sub" claim or
+	// the client certificate identity.
+	Subject string
+	// Method is how the caller authenticated, "api_key", "jwt" or "mtls".
+	Method string
+	Roles  []string
+	// Tenant binds the caller to one tenant, empty if it may pick any.
+	Tenant string
+}
+
+type principalKey struct{}
+
+func NewContext(ctx context.Context, p Principal) context.Context {
+	return context.WithValue(ctx, principalKey{}, p)
+}
+
+func FromContext(ctx context.Context) (Principal, bool) {
+	p, ok := ctx.Value(principalKey{}).(Principal)
+	return p, ok
+}
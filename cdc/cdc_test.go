@@ -0,0 +1,405 @@
+package cdc
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	pb "github.com/kunal768/go-grpc-tc/proto/users/v2"
+	"github.com/kunal768/go-grpc-tc/tenant"
+	"github.com/kunal768/go-grpc-tc/user"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+)
+
+var john = user.User{ID: 1, FName: "John", Address: user.Address{City: "New York"}, Phone: 1234567890, Height: 180.5}
+
+func TestEncode(t *testing.T) {
+	change := user.Change{Seq: 7, Tenant: "acme", Type: user.ChangeUpdated, User: john, Actor: "alice", Time: time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)}
+
+	msg, err := Encode(change, FormatJSON)
+	require.NoError(t, err)
+	assert.Equal(t, "acme/7", msg.ID)
+	assert.Equal(t, "acme/1", msg.Key)
+	assert.Equal(t, "application/json", msg.ContentType)
+	var fromJSON pb.UserChangeEvent
+	require.NoError(t, protojson.Unmarshal(msg.Data, &fromJSON))
+
+	msg, err = Encode(change, FormatProtobuf)
+	require.NoError(t, err)
+	var fromProto pb.UserChangeEvent
+	require.NoError(t, proto.Unmarshal(msg.Data, &fromProto))
+
+	assert.True(t, proto.Equal(&fromJSON, &fromProto))
+	assert.EqualValues(t, SchemaVersion, fromProto.SchemaVersion)
+	assert.Equal(t, pb.ChangeType_CHANGE_TYPE_UPDATED, fromProto.Type)
+	assert.Equal(t, "John", fromProto.User.Fname)
+	assert.Equal(t, "alice", fromProto.Actor)
+
+	_, err = ParseFormat("xml")
+	assert.Error(t, err)
+}
+
+func TestFileSink(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "events.jsonl")
+	sink, err := NewFileSink(FileOptions{Path: path, MaxBytes: 10, MaxFiles: 2})
+	require.NoError(t, err)
+	defer sink.Close()
+
+	for i := 1; i <= 4; i++ {
+		require.NoError(t, sink.Send(context.Background(), Message{ContentType: FormatJSON.ContentType(), Data: []byte(fmt.Sprintf(`{"seq":%d}`, i))}))
+	}
+	for file, want := range map[string]string{path: `{"seq":4}` + "\n", path + ".1": `{"seq":3}` + "\n", path + ".2": `{"seq":2}` + "\n"} {
+		data, err := os.ReadFile(file)
+		require.NoError(t, err)
+		assert.Equal(t, want, string(data))
+	}
+	_, err = os.Stat(path + ".3")
+	assert.ErrorIs(t, err, os.ErrNotExist, "only MaxFiles rotated files are kept")
+
+	t.Run("Protobuf is length delimited", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "events.pb")
+		sink, err := NewFileSink(FileOptions{Path: path})
+		require.NoError(t, err)
+		require.NoError(t, sink.Send(context.Background(), Message{ContentType: FormatProtobuf.ContentType(), Data: []byte("abc")}))
+		require.NoError(t, sink.Close())
+		data, err := os.ReadFile(path)
+		require.NoError(t, err)
+		n, read := binary.Uvarint(data)
+		assert.EqualValues(t, 3, n)
+		assert.Equal(t, "abc", string(data[read:]))
+	})
+}
+
+func TestWebhookSink(t *testing.T) {
+	statuses := []int{http.StatusServiceUnavailable, http.StatusOK, http.StatusBadRequest}
+	var requests []*http.Request
+	var bodies [][]byte
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		requests = append(requests, r)
+		bodies = append(bodies, body)
+		w.WriteHeader(statuses[len(requests)-1])
+	}))
+	defer server.Close()
+
+	sink := NewWebhookSink(WebhookOptions{URL: server.URL, Secret: "secret"})
+	msg := Message{ID: "7", ContentType: "application/json", Data: []byte(`{"seq":"7"}`)}
+
+	err := sink.Send(context.Background(), msg)
+	assert.Error(t, err)
+	assert.False(t, isPermanent(err), "5xx responses are retried")
+	assert.NoError(t, sink.Send(context.Background(), msg))
+	err = sink.Send(context.Background(), msg)
+	assert.True(t, isPermanent(err), "other 4xx responses are not")
+
+	require.Len(t, requests, 3)
+	assert.Equal(t, "7", requests[1].Header.Get(EventIDHeader))
+	assert.Equal(t, "application/json", requests[1].Header.Get("Content-Type"))
+	assert.Equal(t, Sign("secret", bodies[1]), requests[1].Header.Get(SignatureHeader))
+}
+
+// natsServer is an in-process stand-in for a NATS server with a JetStream
+// stream, speaking enough of the protocol for NATSSink.
+type natsServer struct {
+	lis net.Listener
+
+	mu       sync.Mutex
+	connects []map[string]any
+	messages []natsMessage
+	// reject answers the next publishes with -ERR.
+	reject int
+	// fail acknowledges the next publishes with a JetStream error.
+	fail int
+	// noStream answers publishes as if no stream stored the subject.
+	noStream bool
+}
+
+type natsMessage struct {
+	subject string
+	headers string
+	data    string
+}
+
+func newNATSServer(t *testing.T) *natsServer {
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	s := &natsServer{lis: lis}
+	t.Cleanup(func() { lis.Close() })
+	go func() {
+		for {
+			conn, err := lis.Accept()
+			if err != nil {
+				return
+			}
+			go s.serve(conn)
+		}
+	}()
+	return s
+}
+
+func (s *natsServer) serve(conn net.Conn) {
+	defer conn.Close()
+	fmt.Fprintf(conn, "INFO {\"server_id\":\"test\",\"headers\":true,\"max_payload\":1048576}\r\n")
+	r := bufio.NewReader(conn)
+	sid := ""
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return
+		}
+		op, args, _ := strings.Cut(strings.TrimSpace(line), " ")
+		switch op {
+		case "CONNECT":
+			var options map[string]any
+			json.Unmarshal([]byte(args), &options)
+			s.mu.Lock()
+			s.connects = append(s.connects, options)
+			s.mu.Unlock()
+		case "SUB":
+			sid = strings.Fields(args)[1]
+		case "PING":
+			fmt.Fprintf(conn, "PONG\r\n")
+		case "HPUB":
+			// HPUB subject reply hsize size
+			fields := strings.Fields(args)
+			reply := fields[1]
+			headerLen, _ := strconv.Atoi(fields[2])
+			total, _ := strconv.Atoi(fields[3])
+			payload := make([]byte, total+2)
+			if _, err := io.ReadFull(r, payload); err != nil {
+				return
+			}
+			s.mu.Lock()
+			switch {
+			case s.reject > 0:
+				s.reject--
+				s.mu.Unlock()
+				fmt.Fprintf(conn, "-ERR 'Permissions Violation for Publish to %s'\r\n", fields[0])
+				return
+			case s.noStream:
+				status := "NATS/1.0 503\r\n\r\n"
+				fmt.Fprintf(conn, "HMSG %s %s %d %d\r\n%s\r\n", reply, sid, len(status), len(status), status)
+			case s.fail > 0:
+				s.fail--
+				ack := `{"error":{"code":503,"err_code":10077,"description":"maximum messages exceeded"}}`
+				fmt.Fprintf(conn, "MSG %s %s %d\r\n%s\r\n", reply, sid, len(ack), ack)
+			default:
+				s.messages = append(s.messages, natsMessage{subject: fields[0], headers: string(payload[:headerLen]), data: string(payload[headerLen:total])})
+				// an unrelated reply first, the sink waits for its own
+				fmt.Fprintf(conn, "MSG %s.0 %s 2\r\n{}\r\n", reply, sid)
+				ack := fmt.Sprintf(`{"stream":"USERS","seq":%d}`, len(s.messages))
+				fmt.Fprintf(conn, "MSG %s %s %d\r\n%s\r\n", reply, sid, len(ack), ack)
+			}
+			s.mu.Unlock()
+		}
+	}
+}
+
+func (s *natsServer) received() []natsMessage {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]natsMessage(nil), s.messages...)
+}
+
+func TestNATSSink(t *testing.T) {
+	server := newNATSServer(t)
+	sink, err := NewNATSSink(NATSOptions{URL: "nats://s3cret@" + server.lis.Addr().String(), Subject: "users.changes", Timeout: time.Second})
+	require.NoError(t, err)
+	defer sink.Close()
+
+	require.NoError(t, sink.Send(context.Background(), Message{ID: "1", Data: []byte("one")}))
+	server.mu.Lock()
+	server.reject = 1
+	server.mu.Unlock()
+	assert.ErrorContains(t, sink.Send(context.Background(), Message{ID: "2", Data: []byte("two")}), "Permissions Violation")
+	require.NoError(t, sink.Send(context.Background(), Message{ID: "2", Data: []byte("two")}), "reconnects after an error")
+
+	server.mu.Lock()
+	server.fail = 1
+	server.mu.Unlock()
+	err = sink.Send(context.Background(), Message{ID: "3", Data: []byte("three")})
+	assert.ErrorContains(t, err, "maximum messages exceeded")
+	assert.False(t, isPermanent(err), "error acknowledgements are retried")
+	server.mu.Lock()
+	server.noStream = true
+	server.mu.Unlock()
+	assert.ErrorContains(t, sink.Send(context.Background(), Message{ID: "3", Data: []byte("three")}), "no JetStream stream")
+	server.mu.Lock()
+	server.noStream = false
+	server.mu.Unlock()
+
+	messages := server.received()
+	require.Len(t, messages, 2)
+	assert.Equal(t, "users.changes", messages[0].subject)
+	assert.Equal(t, "one", messages[0].data)
+	assert.Contains(t, messages[1].headers, "Nats-Msg-Id: 2\r\n")
+
+	server.mu.Lock()
+	defer server.mu.Unlock()
+	require.Len(t, server.connects, 2)
+	assert.Equal(t, "s3cret", server.connects[0]["auth_token"])
+
+	_, err = NewNATSSink(NATSOptions{URL: "http://localhost:4222", Subject: "users"})
+	assert.Error(t, err)
+}
+
+// recordingSink fails its first failures sends with err.
+type recordingSink struct {
+	mu       sync.Mutex
+	failures int
+	err      error
+	messages []Message
+	attempts int
+}
+
+func (s *recordingSink) Send(ctx context.Context, msg Message) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.attempts++
+	if s.failures != 0 {
+		s.failures--
+		return s.err
+	}
+	s.messages = append(s.messages, msg)
+	return nil
+}
+
+func (s *recordingSink) Close() error { return nil }
+
+func TestPublisher(t *testing.T) {
+	newFeed := func(t *testing.T) (user.Repository, user.ChangeFeed) {
+		repo := user.NewRepositoryWithOptions(user.UserDB{}, user.RepositoryOptions{Outbox: true})
+		_, err := repo.AddUser(context.Background(), john)
+		require.NoError(t, err)
+		updated := john
+		updated.Married = true
+		_, err = repo.UpdateUser(context.Background(), updated)
+		require.NoError(t, err)
+		return repo, repo.(user.ChangeFeed)
+	}
+	opts := func(sinks map[string]Sink, deadLetter Sink) Options {
+		return Options{Sinks: sinks, DeadLetter: deadLetter, MaxAttempts: 3, Backoff: time.Millisecond, MaxBackoff: time.Millisecond}
+	}
+
+	t.Run("Retries until delivered", func(t *testing.T) {
+		_, feed := newFeed(t)
+		flaky := &recordingSink{failures: 2, err: errors.New("connection refused")}
+		n, err := NewPublisher(feed, opts(map[string]Sink{"flaky": flaky}, nil)).PublishPending(context.Background())
+		require.NoError(t, err)
+		assert.Equal(t, 2, n)
+		require.Len(t, flaky.messages, 2)
+		assert.Equal(t, "1", flaky.messages[0].ID)
+		assert.Equal(t, "2", flaky.messages[1].ID)
+
+		pending, err := feed.PendingChanges(context.Background(), 0)
+		require.NoError(t, err)
+		assert.Empty(t, pending, "delivered changes are acknowledged")
+	})
+
+	t.Run("Dead letters failed events", func(t *testing.T) {
+		_, feed := newFeed(t)
+		down := &recordingSink{failures: -1, err: errors.New("connection refused")}
+		rejecting := &recordingSink{failures: 1, err: Permanent(errors.New("400 Bad Request"))}
+		ok := &recordingSink{}
+		deadLetter := &recordingSink{}
+		n, err := NewPublisher(feed, opts(map[string]Sink{"down": down, "rejecting": rejecting, "ok": ok}, deadLetter)).PublishPending(context.Background())
+		require.NoError(t, err)
+		assert.Equal(t, 2, n)
+		assert.Len(t, ok.messages, 2)
+		assert.Equal(t, 6, down.attempts, "MaxAttempts per event")
+		assert.Equal(t, 2, rejecting.attempts, "permanent failures are not retried")
+
+		require.Len(t, deadLetter.messages, 3)
+		var letter DeadLetter
+		require.NoError(t, json.Unmarshal(deadLetter.messages[0].Data, &letter))
+		assert.Equal(t, "down", letter.Sink)
+		assert.Equal(t, 3, letter.Attempts)
+		assert.Equal(t, "1", letter.ID)
+		var event pb.UserChangeEvent
+		require.NoError(t, protojson.Unmarshal(letter.Data, &event))
+		assert.Equal(t, pb.ChangeType_CHANGE_TYPE_CREATED, event.Type)
+	})
+
+	t.Run("Holds back events without a dead-letter sink", func(t *testing.T) {
+		repo, feed := newFeed(t)
+		sink := &recordingSink{failures: 4, err: errors.New("connection refused")}
+		publisher := NewPublisher(feed, opts(map[string]Sink{"sink": sink}, nil))
+
+		n, err := publisher.PublishPending(context.Background())
+		assert.Error(t, err)
+		assert.Equal(t, 0, n)
+		pending, _ := feed.PendingChanges(context.Background(), 0)
+		assert.Len(t, pending, 2)
+
+		require.NoError(t, repo.DeleteUser(context.Background(), 1, 0))
+		n, err = publisher.PublishPending(context.Background())
+		require.NoError(t, err)
+		assert.Equal(t, 3, n)
+		require.Len(t, sink.messages, 3)
+		var event pb.UserChangeEvent
+		require.NoError(t, protojson.Unmarshal(sink.messages[2].Data, &event))
+		assert.Equal(t, pb.ChangeType_CHANGE_TYPE_DELETED, event.Type)
+	})
+
+	t.Run("Tenants", func(t *testing.T) {
+		acme := tenant.NewContext(context.Background(), "acme")
+		repo := user.NewTenantRepository(map[string]user.Repository{
+			"acme":   user.NewRepositoryWithOptions(user.UserDB{}, user.RepositoryOptions{Outbox: true}),
+			"globex": user.NewRepositoryWithOptions(user.UserDB{}, user.RepositoryOptions{Outbox: true}),
+		})
+		_, err := repo.AddUser(acme, john)
+		require.NoError(t, err)
+		sink := &recordingSink{}
+		publisher := NewPublisher(repo.(user.ChangeFeed), opts(map[string]Sink{"sink": sink}, nil))
+
+		n, err := publisher.PublishPending(tenant.NewContext(context.Background(), "globex"))
+		require.NoError(t, err)
+		assert.Equal(t, 0, n)
+		n, err = publisher.PublishPending(acme)
+		require.NoError(t, err)
+		assert.Equal(t, 1, n)
+		assert.Equal(t, "acme/1", sink.messages[0].ID)
+	})
+}
+
+func TestPublisher_Run(t *testing.T) {
+	repo := user.NewRepositoryWithOptions(user.UserDB{}, user.RepositoryOptions{Outbox: true})
+	path := filepath.Join(t.TempDir(), "events.jsonl")
+	sink, err := NewFileSink(FileOptions{Path: path})
+	require.NoError(t, err)
+	defer sink.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		NewPublisher(repo.(user.ChangeFeed), Options{Sinks: map[string]Sink{"file": sink}, PollInterval: time.Millisecond}).Run(ctx)
+		close(done)
+	}()
+
+	_, err = repo.AddUser(context.Background(), john)
+	require.NoError(t, err)
+	assert.Eventually(t, func() bool {
+		data, _ := os.ReadFile(path)
+		return bytes.Count(data, []byte("\n")) == 1
+	}, time.Second, time.Millisecond)
+	cancel()
+	<-done
+}
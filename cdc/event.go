@@ -0,0 +1,97 @@
+package cdc
+
+import (
+	"fmt"
+	"strconv"
+
+	pb "github.com/kunal768/go-grpc-tc/proto/users/v2"
+	"github.com/kunal768/go-grpc-tc/user"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// SchemaVersion is the schema_version of the events published.
+const SchemaVersion = 1
+
+// Format is how events are encoded.
+type Format string
+
+const (
+	FormatJSON     Format = "json"
+	FormatProtobuf Format = "protobuf"
+)
+
+func ParseFormat(name string) (Format, error) {
+	switch Format(name) {
+	case FormatJSON, FormatProtobuf:
+		return Format(name), nil
+	}
+	return "", fmt.Errorf("unknown event format %q, want json or protobuf", name)
+}
+
+func (f Format) ContentType() string {
+	if f == FormatProtobuf {
+		return "application/x-protobuf"
+	}
+	return "application/json"
+}
+
+// Message is an encoded event as handed to a sink.
+type Message struct {
+	// ID is unique per event and the same on every delivery of it.
+	ID string
+	// Key is the same for every event of a user, for sinks that partition.
+	Key         string
+	ContentType string
+	Data        []byte
+}
+
+var changeTypes = map[user.ChangeType]pb.ChangeType{
+	user.ChangeCreated: pb.ChangeType_CHANGE_TYPE_CREATED,
+	user.ChangeUpdated: pb.ChangeType_CHANGE_TYPE_UPDATED,
+	user.ChangeDeleted: pb.ChangeType_CHANGE_TYPE_DELETED,
+}
+
+// Event converts a change to the event published for it. Sequence numbers
+// are per tenant, so the ID of an event is prefixed with its tenant.
+func Event(change user.Change) *pb.UserChangeEvent {
+	id := strconv.FormatInt(change.Seq, 10)
+	if change.Tenant != "" {
+		id = change.Tenant + "/" + id
+	}
+	event := &pb.UserChangeEvent{
+		SchemaVersion: SchemaVersion,
+		Id:            id,
+		Seq:           change.Seq,
+		Tenant:        change.Tenant,
+		Type:          changeTypes[change.Type],
+		User:          user.ToProto(change.User),
+		Actor:         change.Actor,
+	}
+	if !change.Time.IsZero() {
+		event.Time = timestamppb.New(change.Time)
+	}
+	return event
+}
+
+// Encode encodes the event of a change in format.
+func Encode(change user.Change, format Format) (Message, error) {
+	event := Event(change)
+	var data []byte
+	var err error
+	if format == FormatProtobuf {
+		data, err = proto.Marshal(event)
+	} else {
+		data, err = protojson.Marshal(event)
+	}
+	if err != nil {
+		return Message{}, err
+	}
+
+	key := strconv.FormatInt(int64(change.User.ID), 10)
+	if change.Tenant != "" {
+		key = change.Tenant + "/" + key
+	}
+	return Message{ID: event.Id, Key: key, ContentType: format.ContentType(), Data: data}, nil
+}
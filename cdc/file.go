@@ -0,0 +1,116 @@
+package cdc
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+)
+
+type FileOptions struct {
+	Path string
+	// MaxBytes rotates the file before it grows past it, 100 MiB if 0.
+	MaxBytes int64
+	// MaxFiles is how many rotated files are kept, Path.1 being the newest,
+	// 5 if 0.
+	MaxFiles int
+}
+
+// FileSink appends messages to a local file: JSON events one per line,
+// protobuf events each preceded by its varint encoded length.
+type FileSink struct {
+	opts FileOptions
+
+	mu   sync.Mutex
+	f    *os.File
+	size int64
+}
+
+func NewFileSink(opts FileOptions) (*FileSink, error) {
+	if opts.MaxBytes <= 0 {
+		opts.MaxBytes = 100 << 20
+	}
+	if opts.MaxFiles <= 0 {
+		opts.MaxFiles = 5
+	}
+	s := &FileSink{opts: opts}
+	if err := s.open(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+func (s *FileSink) open() error {
+	f, err := os.OpenFile(s.opts.Path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o600)
+	if err != nil {
+		return err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return err
+	}
+	s.f, s.size = f, info.Size()
+	return nil
+}
+
+// rotate shifts Path to Path.1, Path.1 to Path.2 and so on, dropping the
+// oldest, and starts a new Path.
+func (s *FileSink) rotate() error {
+	if err := s.f.Close(); err != nil {
+		return err
+	}
+	s.f = nil
+	for i := s.opts.MaxFiles - 1; i >= 1; i-- {
+		err := os.Rename(fmt.Sprintf("%s.%d", s.opts.Path, i), fmt.Sprintf("%s.%d", s.opts.Path, i+1))
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+	}
+	if err := os.Rename(s.opts.Path, s.opts.Path+".1"); err != nil {
+		return err
+	}
+	return s.open()
+}
+
+func (s *FileSink) Send(ctx context.Context, msg Message) error {
+	var record []byte
+	if msg.ContentType == FormatJSON.ContentType() {
+		record = append(append(record, msg.Data...), '\n')
+	} else {
+		record = append(binary.AppendUvarint(record, uint64(len(msg.Data))), msg.Data...)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.f == nil {
+		// a failed rotation is retried with the next message
+		if err := s.open(); err != nil {
+			return err
+		}
+	}
+	if s.size > 0 && s.size+int64(len(record)) > s.opts.MaxBytes {
+		if err := s.rotate(); err != nil {
+			return err
+		}
+	}
+	n, err := s.f.Write(record)
+	s.size += int64(n)
+	if err != nil {
+		return err
+	}
+	return s.f.Sync()
+}
+
+func (s *FileSink) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.f == nil {
+		return nil
+	}
+	err := s.f.Close()
+	s.f = nil
+	return err
+}
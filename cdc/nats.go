@@ -0,0 +1,254 @@
+package cdc
+
+import (
+	"bufio"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// natsMsgIDHeader lets a JetStream stream drop redelivered events.
+const natsMsgIDHeader = "Nats-Msg-Id"
+
+type NATSOptions struct {
+	// URL is the server, nats://[user:password@ or token@]host:port.
+	URL     string
+	Subject string
+	// Timeout bounds connecting and every publish, 10s if 0.
+	Timeout time.Duration
+}
+
+// NATSSink publishes every message to a JetStream stream bound to a NATS
+// subject, speaking the client protocol directly. A publish counts once the
+// stream acknowledged storing it; an error acknowledgement, or none before the
+// timeout, fails the send so the publisher retries. The event ID is sent as
+// Nats-Msg-Id so the stream drops duplicates.
+type NATSSink struct {
+	opts NATSOptions
+	addr string
+	auth map[string]string
+
+	mu    sync.Mutex
+	conn  net.Conn
+	r     *bufio.Reader
+	inbox string
+	next  uint64
+}
+
+// natsAck is the JetStream reply to a publish.
+type natsAck struct {
+	Stream string `json:"stream"`
+	Seq    uint64 `json:"seq"`
+	Error  *struct {
+		Code        int    `json:"code"`
+		Description string `json:"description"`
+	} `json:"error"`
+}
+
+func NewNATSSink(opts NATSOptions) (*NATSSink, error) {
+	if opts.Timeout <= 0 {
+		opts.Timeout = 10 * time.Second
+	}
+	if opts.Subject == "" || strings.ContainsAny(opts.Subject, " \t\r\n") {
+		return nil, fmt.Errorf("invalid NATS subject %q", opts.Subject)
+	}
+	u, err := url.Parse(opts.URL)
+	if err != nil {
+		return nil, err
+	}
+	if u.Scheme != "nats" || u.Host == "" {
+		return nil, fmt.Errorf("NATS URL must be nats://host:port, got %q", opts.URL)
+	}
+	s := &NATSSink{opts: opts, addr: u.Host, auth: map[string]string{}}
+	if u.User != nil {
+		if password, ok := u.User.Password(); ok {
+			s.auth["user"], s.auth["pass"] = u.User.Username(), password
+		} else {
+			s.auth["auth_token"] = u.User.Username()
+		}
+	}
+	return s, nil
+}
+
+// connect opens the connection when there is none. Must be called with mu
+// held.
+func (s *NATSSink) connect(ctx context.Context) error {
+	if s.conn != nil {
+		return nil
+	}
+	dialer := net.Dialer{Timeout: s.opts.Timeout}
+	conn, err := dialer.DialContext(ctx, "tcp", s.addr)
+	if err != nil {
+		return err
+	}
+	conn.SetDeadline(time.Now().Add(s.opts.Timeout))
+	r := bufio.NewReader(conn)
+
+	line, err := r.ReadString('\n')
+	if err != nil {
+		conn.Close()
+		return err
+	}
+	infoJSON, ok := strings.CutPrefix(strings.TrimSpace(line), "INFO ")
+	if !ok {
+		conn.Close()
+		return fmt.Errorf("NATS server sent %q instead of INFO", strings.TrimSpace(line))
+	}
+	var info struct {
+		Headers bool `json:"headers"`
+	}
+	if err := json.Unmarshal([]byte(infoJSON), &info); err != nil {
+		conn.Close()
+		return fmt.Errorf("NATS INFO: %w", err)
+	}
+	if !info.Headers {
+		conn.Close()
+		return errors.New("NATS server does not support headers, JetStream needs NATS 2.2 or later")
+	}
+
+	// no_responders makes the server answer at once when no stream listens
+	options := map[string]any{"verbose": false, "pedantic": false, "headers": true, "no_responders": true, "name": "go-grpc-tc", "lang": "go"}
+	for k, v := range s.auth {
+		options[k] = v
+	}
+	connect, _ := json.Marshal(options)
+	var id [8]byte
+	rand.Read(id[:])
+	s.conn, s.r, s.inbox = conn, r, "_INBOX."+hex.EncodeToString(id[:])
+	if _, err := fmt.Fprintf(conn, "CONNECT %s\r\nSUB %s.* 1\r\nPING\r\n", connect, s.inbox); err != nil {
+		s.reset()
+		return err
+	}
+	if err := s.awaitPong(); err != nil {
+		s.reset()
+		return err
+	}
+	return nil
+}
+
+// awaitPong reads until the server answers a PING. Must be called with mu
+// held.
+func (s *NATSSink) awaitPong() error {
+	_, _, err := s.await("")
+	return err
+}
+
+// await reads until the server answers a PING, or, with a reply subject, until
+// the message sent to it arrives. It returns the status line and payload of
+// that message, answering the server's PINGs meanwhile and skipping replies to
+// other subjects. Must be called with mu held.
+func (s *NATSSink) await(reply string) (status string, payload []byte, err error) {
+	for {
+		line, err := s.r.ReadString('\n')
+		if err != nil {
+			return "", nil, err
+		}
+		op, args, _ := strings.Cut(strings.TrimSpace(line), " ")
+		switch op {
+		case "PONG":
+			if reply == "" {
+				return "", nil, nil
+			}
+		case "PING":
+			if _, err := s.conn.Write([]byte("PONG\r\n")); err != nil {
+				return "", nil, err
+			}
+		case "-ERR":
+			return "", nil, errors.New("NATS server: " + strings.TrimSpace(args))
+		case "MSG", "HMSG":
+			// MSG subject sid [reply] size, HMSG subject sid [reply] hsize size
+			fields := strings.Fields(args)
+			headerLen, total := 0, 0
+			if op == "HMSG" && len(fields) >= 4 {
+				headerLen, _ = strconv.Atoi(fields[len(fields)-2])
+			}
+			if len(fields) >= 3 {
+				total, err = strconv.Atoi(fields[len(fields)-1])
+			}
+			if len(fields) < 3 || err != nil || headerLen > total {
+				return "", nil, fmt.Errorf("NATS server sent malformed %q", strings.TrimSpace(line))
+			}
+			data := make([]byte, total+2)
+			if _, err := io.ReadFull(s.r, data); err != nil {
+				return "", nil, err
+			}
+			if fields[0] != reply {
+				continue
+			}
+			// the header block starts with a status line, NATS/1.0 503
+			headers := string(data[:headerLen])
+			status, _, _ = strings.Cut(headers, "\r\n")
+			return strings.TrimSpace(strings.TrimPrefix(status, "NATS/1.0")), data[headerLen:total], nil
+		}
+	}
+}
+
+// reset drops the connection, the next Send connects again. Must be called
+// with mu held.
+func (s *NATSSink) reset() {
+	if s.conn != nil {
+		s.conn.Close()
+	}
+	s.conn, s.r = nil, nil
+}
+
+func (s *NATSSink) Send(ctx context.Context, msg Message) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.connect(ctx); err != nil {
+		return err
+	}
+
+	deadline := time.Now().Add(s.opts.Timeout)
+	if d, ok := ctx.Deadline(); ok && d.Before(deadline) {
+		deadline = d
+	}
+	s.conn.SetDeadline(deadline)
+
+	s.next++
+	reply := fmt.Sprintf("%s.%d", s.inbox, s.next)
+	headers := fmt.Sprintf("NATS/1.0\r\n%s: %s\r\n\r\n", natsMsgIDHeader, msg.ID)
+	frame := fmt.Appendf(nil, "HPUB %s %s %d %d\r\n%s", s.opts.Subject, reply, len(headers), len(headers)+len(msg.Data), headers)
+	frame = append(append(frame, msg.Data...), "\r\n"...)
+
+	if _, err := s.conn.Write(frame); err != nil {
+		s.reset()
+		return err
+	}
+	status, payload, err := s.await(reply)
+	if err != nil {
+		s.reset()
+		return err
+	}
+	if strings.HasPrefix(status, "503") {
+		return fmt.Errorf("NATS: no JetStream stream stores subject %q", s.opts.Subject)
+	}
+	var ack natsAck
+	if err := json.Unmarshal(payload, &ack); err != nil {
+		return fmt.Errorf("NATS: invalid JetStream acknowledgement %q: %w", payload, err)
+	}
+	if ack.Error != nil {
+		return fmt.Errorf("NATS JetStream: %s (%d)", ack.Error.Description, ack.Error.Code)
+	}
+	if ack.Stream == "" {
+		return fmt.Errorf("NATS: invalid JetStream acknowledgement %q", payload)
+	}
+	return nil
+}
+
+func (s *NATSSink) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.reset()
+	return nil
+}
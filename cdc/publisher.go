@@ -0,0 +1,186 @@
+package cdc
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/kunal768/go-grpc-tc/user"
+)
+
+type Options struct {
+	Format Format
+	// Sinks receive every event, by name.
+	Sinks map[string]Sink
+	// DeadLetter receives the events a sink failed to take after
+	// MaxAttempts, wrapped in a DeadLetter record. Without it, a failing
+	// event is retried until it is delivered and holds back the ones
+	// after it.
+	DeadLetter Sink
+	// MaxAttempts is how often a sink is tried per event before it is dead
+	// lettered, 5 if 0.
+	MaxAttempts int
+	// Backoff is the wait before the first retry, doubling up to
+	// MaxBackoff. 100ms and 30s if 0.
+	Backoff    time.Duration
+	MaxBackoff time.Duration
+	// PollInterval is how often the outbox is checked for changes, 1s if 0.
+	PollInterval time.Duration
+	// BatchSize is how many changes are read from the outbox at once, 100
+	// if 0.
+	BatchSize int
+	// OnError is called for every failed delivery attempt, and with an
+	// empty sink and message when a batch stops early.
+	OnError func(sink string, msg Message, err error)
+}
+
+// DeadLetter is what the dead-letter sink receives, as JSON, for an event a
+// sink did not take.
+type DeadLetter struct {
+	Sink        string    `json:"sink"`
+	Error       string    `json:"error"`
+	Attempts    int       `json:"attempts"`
+	Time        time.Time `json:"time"`
+	ID          string    `json:"id"`
+	Key         string    `json:"key"`
+	ContentType string    `json:"content_type"`
+	Data        []byte    `json:"data"`
+}
+
+// Publisher relays the changes of a repository outbox to sinks, at least
+// once: a change is only acknowledged after every sink took its event or it
+// was dead lettered, so a crash in between sends it again.
+type Publisher struct {
+	feed  user.ChangeFeed
+	opts  Options
+	names []string
+}
+
+func NewPublisher(feed user.ChangeFeed, opts Options) *Publisher {
+	if opts.Format == "" {
+		opts.Format = FormatJSON
+	}
+	if opts.MaxAttempts <= 0 {
+		opts.MaxAttempts = 5
+	}
+	if opts.Backoff <= 0 {
+		opts.Backoff = 100 * time.Millisecond
+	}
+	if opts.MaxBackoff <= 0 {
+		opts.MaxBackoff = 30 * time.Second
+	}
+	if opts.PollInterval <= 0 {
+		opts.PollInterval = time.Second
+	}
+	if opts.BatchSize <= 0 {
+		opts.BatchSize = 100
+	}
+	names := make([]string, 0, len(opts.Sinks))
+	for name := range opts.Sinks {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return &Publisher{feed: feed, opts: opts, names: names}
+}
+
+// Run publishes until ctx is done. ctx selects the outbox of a tenant when
+// the repository has tenants.
+func (p *Publisher) Run(ctx context.Context) {
+	for {
+		n, err := p.PublishPending(ctx)
+		if err != nil && p.opts.OnError != nil && ctx.Err() == nil {
+			p.opts.OnError("", Message{}, err)
+		}
+		if err == nil && n == p.opts.BatchSize {
+			continue
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(p.opts.PollInterval):
+		}
+	}
+}
+
+// PublishPending publishes one batch of pending changes and returns how
+// many it acknowledged.
+func (p *Publisher) PublishPending(ctx context.Context) (int, error) {
+	changes, err := p.feed.PendingChanges(ctx, p.opts.BatchSize)
+	if err != nil {
+		return 0, err
+	}
+
+	published := 0
+	var publishErr error
+	for _, change := range changes {
+		if publishErr = p.publish(ctx, change); publishErr != nil {
+			break
+		}
+		published++
+	}
+	if published > 0 {
+		if err := p.feed.AckChanges(ctx, changes[published-1].Seq); err != nil {
+			return 0, err
+		}
+	}
+	return published, publishErr
+}
+
+// publish sends the event of a change to every sink, dead lettering it for
+// the sinks that fail.
+func (p *Publisher) publish(ctx context.Context, change user.Change) error {
+	msg, err := Encode(change, p.opts.Format)
+	if err != nil {
+		return err
+	}
+	for _, name := range p.names {
+		attempts, err := p.send(ctx, name, p.opts.Sinks[name], msg)
+		if err == nil {
+			continue
+		}
+		if ctx.Err() != nil || p.opts.DeadLetter == nil {
+			return fmt.Errorf("sink %s: event %s: %w", name, msg.ID, err)
+		}
+		letter, _ := json.Marshal(DeadLetter{
+			Sink:        name,
+			Error:       err.Error(),
+			Attempts:    attempts,
+			Time:        time.Now().UTC(),
+			ID:          msg.ID,
+			Key:         msg.Key,
+			ContentType: msg.ContentType,
+			Data:        msg.Data,
+		})
+		deadLetter := Message{ID: msg.ID, Key: msg.Key, ContentType: FormatJSON.ContentType(), Data: letter}
+		if _, err := p.send(ctx, "dead-letter", p.opts.DeadLetter, deadLetter); err != nil {
+			return fmt.Errorf("dead-letter of event %s: %w", msg.ID, err)
+		}
+	}
+	return nil
+}
+
+// send tries a sink up to MaxAttempts times, backing off in between, and
+// returns the attempts made.
+func (p *Publisher) send(ctx context.Context, name string, sink Sink, msg Message) (int, error) {
+	backoff := p.opts.Backoff
+	for attempt := 1; ; attempt++ {
+		err := sink.Send(ctx, msg)
+		if err == nil {
+			return attempt, nil
+		}
+		if p.opts.OnError != nil {
+			p.opts.OnError(name, msg, err)
+		}
+		if attempt == p.opts.MaxAttempts || isPermanent(err) {
+			return attempt, err
+		}
+		select {
+		case <-ctx.Done():
+			return attempt, ctx.Err()
+		case <-time.After(backoff):
+		}
+		backoff = min(2*backoff, p.opts.MaxBackoff)
+	}
+}
@@ -0,0 +1,33 @@
+package cdc
+
+import (
+	"context"
+	"errors"
+)
+
+// Sink delivers messages to another system. Send returns once the message
+// is stored by it, a message may be sent more than once.
+type Sink interface {
+	Send(ctx context.Context, msg Message) error
+	Close() error
+}
+
+// permanentError is a failure retrying cannot fix, such as a rejected
+// message.
+type permanentError struct {
+	err error
+}
+
+func (e *permanentError) Error() string { return e.err.Error() }
+func (e *permanentError) Unwrap() error { return e.err }
+
+// Permanent marks err as not worth retrying, the message goes to the
+// dead-letter sink straight away.
+func Permanent(err error) error {
+	return &permanentError{err: err}
+}
+
+func isPermanent(err error) bool {
+	var p *permanentError
+	return errors.As(err, &p)
+}
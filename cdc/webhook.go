@@ -0,0 +1,89 @@
+package cdc
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+)
+
+const (
+	// EventIDHeader carries Message.ID in webhook requests.
+	EventIDHeader = "X-Event-Id"
+	// SignatureHeader carries "sha256=" and the hex HMAC-SHA256 of the
+	// request body with the webhook secret.
+	SignatureHeader = "X-Signature-256"
+)
+
+type WebhookOptions struct {
+	URL string
+	// Secret signs every request when set, see SignatureHeader.
+	Secret string
+	// Timeout bounds every request, 10s if 0.
+	Timeout time.Duration
+	// Client sends the requests, http.DefaultClient if nil.
+	Client *http.Client
+}
+
+// WebhookSink POSTs every message to a URL. 2xx responses acknowledge it,
+// 408, 429 and 5xx responses are retried and any other response is a
+// permanent failure.
+type WebhookSink struct {
+	opts WebhookOptions
+}
+
+func NewWebhookSink(opts WebhookOptions) *WebhookSink {
+	if opts.Timeout <= 0 {
+		opts.Timeout = 10 * time.Second
+	}
+	if opts.Client == nil {
+		opts.Client = http.DefaultClient
+	}
+	return &WebhookSink{opts: opts}
+}
+
+func (s *WebhookSink) Send(ctx context.Context, msg Message) error {
+	ctx, cancel := context.WithTimeout(ctx, s.opts.Timeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.opts.URL, bytes.NewReader(msg.Data))
+	if err != nil {
+		return Permanent(err)
+	}
+	req.Header.Set("Content-Type", msg.ContentType)
+	req.Header.Set(EventIDHeader, msg.ID)
+	if s.opts.Secret != "" {
+		req.Header.Set(SignatureHeader, Sign(s.opts.Secret, msg.Data))
+	}
+
+	resp, err := s.opts.Client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+
+	switch {
+	case resp.StatusCode >= 200 && resp.StatusCode < 300:
+		return nil
+	case resp.StatusCode == http.StatusRequestTimeout, resp.StatusCode == http.StatusTooManyRequests, resp.StatusCode >= 500:
+		return fmt.Errorf("webhook responded %s", resp.Status)
+	}
+	return Permanent(fmt.Errorf("webhook responded %s", resp.Status))
+}
+
+func (s *WebhookSink) Close() error {
+	return nil
+}
+
+// Sign is the SignatureHeader value of body, for receivers to compare with.
+func Sign(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
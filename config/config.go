@@ -0,0 +1,722 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/kunal768/go-grpc-tc/tenant"
+	"gopkg.in/yaml.v3"
+)
+
+type Config struct {
+	Server      ServerConfig      `yaml:"server"`
+	Storage     StorageConfig     `yaml:"storage"`
+	Seed        SeedConfig        `yaml:"seed"`
+	TLS         TLSConfig         `yaml:"tls"`
+	Limits      LimitsConfig      `yaml:"limits"`
+	Log         LogConfig         `yaml:"log"`
+	Metrics     MetricsConfig     `yaml:"metrics"`
+	Tracing     TracingConfig     `yaml:"tracing"`
+	Auth        AuthConfig        `yaml:"auth"`
+	RateLimit   RateLimitConfig   `yaml:"rate_limit"`
+	LoadShed    LoadShedConfig    `yaml:"load_shedding"`
+	Deadlines   DeadlinesConfig   `yaml:"deadlines"`
+	IDs         IDsConfig         `yaml:"ids"`
+	Idempotency IdempotencyConfig `yaml:"idempotency"`
+	Audit       AuditConfig       `yaml:"audit"`
+	Tenancy     TenancyConfig     `yaml:"tenancy"`
+	CDC         CDCConfig         `yaml:"cdc"`
+}
+
+type ServerConfig struct {
+	ListenAddress   string        `yaml:"listen_address"`
+	Reflection      bool          `yaml:"reflection"`
+	ShutdownTimeout time.Duration `yaml:"shutdown_timeout"`
+}
+
+type StorageConfig struct {
+	// Backend is either "memory" or "file".
+	Backend       string        `yaml:"backend"`
+	Path          string        `yaml:"path"`
+	FlushInterval time.Duration `yaml:"flush_interval"`
+}
+
+type SeedConfig struct {
+	// File is a JSON, JSONL or CSV file of users loaded into an empty
+	// repository at startup. Without it the built-in sample users are used.
+	File string `yaml:"file"`
+	// Mode is "strict" (abort on any rejected row) or "lenient" (skip them).
+	Mode string `yaml:"mode"`
+}
+
+type TLSConfig struct {
+	Enabled  bool   `yaml:"enabled"`
+	CertFile string `yaml:"cert_file"`
+	KeyFile  string `yaml:"key_file"`
+	// ClientCAFile enables mutual TLS, client certificates are verified
+	// against its CA bundle. RequireClientCert rejects clients without one.
+	ClientCAFile      string `yaml:"client_ca_file"`
+	RequireClientCert bool   `yaml:"require_client_cert"`
+	// ReloadInterval is how often the files are checked for changes.
+	ReloadInterval time.Duration `yaml:"reload_interval"`
+}
+
+type LimitsConfig struct {
+	MaxRecvMsgSize       int           `yaml:"max_recv_msg_size"`
+	MaxSendMsgSize       int           `yaml:"max_send_msg_size"`
+	MaxConcurrentStreams uint32        `yaml:"max_concurrent_streams"`
+	ConnectionTimeout    time.Duration `yaml:"connection_timeout"`
+}
+
+type LogConfig struct {
+	// Level is one of debug, info, warn or error.
+	Level string `yaml:"level"`
+	// Format is either "text" or "json".
+	Format string `yaml:"format"`
+	// SampleRate is the fraction of successful RPCs logged, overridden per
+	// full method name (e.g. /users.v2.UserService/ListUsers) by
+	// MethodSampleRates.
+	SampleRate        float64            `yaml:"sample_rate"`
+	MethodSampleRates map[string]float64 `yaml:"method_sample_rates"`
+	// Payloads logs request and response messages with RedactFields masked.
+	Payloads     bool     `yaml:"payloads"`
+	RedactFields []string `yaml:"redact_fields"`
+}
+
+type MetricsConfig struct {
+	// ListenAddress serves Prometheus metrics on /metrics over HTTP, empty
+	// disables the endpoint.
+	ListenAddress string `yaml:"listen_address"`
+}
+
+type TracingConfig struct {
+	// Exporter is none, stdout, file or otlp.
+	Exporter string `yaml:"exporter"`
+	// File receives the spans of the file exporter, one JSON object each.
+	File         string  `yaml:"file"`
+	OTLPEndpoint string  `yaml:"otlp_endpoint"`
+	OTLPInsecure bool    `yaml:"otlp_insecure"`
+	SampleRatio  float64 `yaml:"sample_ratio"`
+}
+
+type AuthConfig struct {
+	// Enabled rejects RPCs without a valid API key or bearer token, except
+	// for ExemptMethods.
+	Enabled bool `yaml:"enabled"`
+	// APIKeysFile is a YAML file of hashed API keys, see auth.LoadAPIKeys.
+	APIKeysFile string `yaml:"api_keys_file"`
+	// JWTSecret verifies HMAC signed tokens, JWKSFile RSA and ECDSA signed
+	// ones; at most one may be set.
+	JWTSecret   string `yaml:"jwt_secret"`
+	JWKSFile    string `yaml:"jwks_file"`
+	JWTIssuer   string `yaml:"jwt_issuer"`
+	JWTAudience string `yaml:"jwt_audience"`
+	// ExemptMethods are full method names, or prefixes ending in "*".
+	ExemptMethods []string `yaml:"exempt_methods"`
+	// PolicyFile holds the roles, their permissions and the permissions
+	// RPCs and response fields require, see auth.Policy.
+	PolicyFile string `yaml:"policy_file"`
+}
+
+type RateLimitConfig struct {
+	// Enabled limits every client, the authenticated principal or else the
+	// peer address, to Rate requests per second with bursts of Burst, and to
+	// DailyQuota requests per UTC day (0 is unlimited).
+	Enabled    bool    `yaml:"enabled"`
+	Rate       float64 `yaml:"rate"`
+	Burst      int     `yaml:"burst"`
+	DailyQuota int     `yaml:"daily_quota"`
+	// Methods gives full method names a bucket and quota of their own.
+	Methods map[string]MethodLimit `yaml:"methods"`
+	// ExemptMethods are full method names, or prefixes ending in "*".
+	ExemptMethods []string `yaml:"exempt_methods"`
+}
+
+type MethodLimit struct {
+	Rate       float64 `yaml:"rate"`
+	Burst      int     `yaml:"burst"`
+	DailyQuota int     `yaml:"daily_quota"`
+}
+
+type LoadShedConfig struct {
+	// Enabled sheds RPCs with Unavailable beyond an adaptive concurrency
+	// limit between MinLimit and MaxLimit. RPCs slower than LatencyThreshold
+	// shrink the limit.
+	Enabled          bool          `yaml:"enabled"`
+	InitialLimit     int           `yaml:"initial_limit"`
+	MinLimit         int           `yaml:"min_limit"`
+	MaxLimit         int           `yaml:"max_limit"`
+	LatencyThreshold time.Duration `yaml:"latency_threshold"`
+	// ExemptMethods are full method names, or prefixes ending in "*".
+	ExemptMethods []string `yaml:"exempt_methods"`
+}
+
+type DeadlinesConfig struct {
+	// Default is the deadline of unary RPCs sent without one, Max caps the
+	// deadline clients send. Zero leaves either unset.
+	Default time.Duration `yaml:"default"`
+	Max     time.Duration `yaml:"max"`
+	// Methods overrides both per full method name.
+	Methods map[string]MethodDeadline `yaml:"methods"`
+}
+
+type MethodDeadline struct {
+	Default time.Duration `yaml:"default"`
+	Max     time.Duration `yaml:"max"`
+}
+
+type IDsConfig struct {
+	// Generator allocates the IDs of CreateUser: sequential, snowflake or
+	// uuidv7 (a Snowflake ID plus a UUIDv7).
+	Generator string `yaml:"generator"`
+	// NodeID tells apart servers generating Snowflake IDs, 0 to 1023.
+	NodeID int `yaml:"node_id"`
+}
+
+type IdempotencyConfig struct {
+	// Enabled stores the outcome of calls to Methods sent with an
+	// idempotency-key header for TTL, and replays it to retries.
+	Enabled bool          `yaml:"enabled"`
+	TTL     time.Duration `yaml:"ttl"`
+	// Methods are full method names, or prefixes ending in "*".
+	Methods []string `yaml:"methods"`
+	// MaxEntries bounds the outcomes kept, calls with a new key fail with
+	// RESOURCE_EXHAUSTED while that many are stored.
+	MaxEntries int `yaml:"max_entries"`
+}
+
+type AuditConfig struct {
+	// Enabled appends a record of audited RPCs to the hash-chained log at
+	// Path.
+	Enabled bool   `yaml:"enabled"`
+	Path    string `yaml:"path"`
+	// Methods are full method names, or prefixes ending in "*", audited on
+	// every call.
+	Methods []string `yaml:"methods"`
+	// SensitiveFields get any other RPC audited when its response has one
+	// of them set.
+	SensitiveFields []string `yaml:"sensitive_fields"`
+}
+
+type TenancyConfig struct {
+	// Enabled keeps the users of every tenant apart, each call belongs to
+	// the tenant of its principal or of its x-tenant-id metadata.
+	Enabled bool                    `yaml:"enabled"`
+	Tenants map[string]TenantConfig `yaml:"tenants"`
+	// DefaultTenant is the tenant of calls naming none, which are rejected
+	// if it is empty.
+	DefaultTenant string `yaml:"default_tenant"`
+	// ExemptMethods are full method names, or prefixes ending in "*", that
+	// belong to no tenant.
+	ExemptMethods []string `yaml:"exempt_methods"`
+}
+
+type TenantConfig struct {
+	// SeedFile is loaded into the empty store of the tenant at startup,
+	// like seed.file. Tenants without one start empty.
+	SeedFile string `yaml:"seed_file"`
+	// RateLimit limits the calls of all clients of the tenant together when
+	// rate_limit.enabled is set.
+	RateLimit MethodLimit `yaml:"rate_limit"`
+}
+
+type CDCConfig struct {
+	// Enabled records every write in an outbox and publishes it to the
+	// configured sinks.
+	Enabled bool `yaml:"enabled"`
+	// Format is json or protobuf.
+	Format       string        `yaml:"format"`
+	PollInterval time.Duration `yaml:"poll_interval"`
+	BatchSize    int           `yaml:"batch_size"`
+	// MaxAttempts is how often a sink is tried per event before the event
+	// goes to the dead-letter file.
+	MaxAttempts int           `yaml:"max_attempts"`
+	Backoff     time.Duration `yaml:"backoff"`
+	MaxBackoff  time.Duration `yaml:"max_backoff"`
+	// DeadLetterFile receives the events sinks failed to take. Without it
+	// they are retried until delivered.
+	DeadLetterFile string           `yaml:"dead_letter_file"`
+	File           CDCFileConfig    `yaml:"file"`
+	Webhook        CDCWebhookConfig `yaml:"webhook"`
+	NATS           CDCNATSConfig    `yaml:"nats"`
+}
+
+// CDCFileConfig enables the file sink when Path is set.
+type CDCFileConfig struct {
+	Path     string `yaml:"path"`
+	MaxBytes int    `yaml:"max_bytes"`
+	MaxFiles int    `yaml:"max_files"`
+}
+
+// CDCWebhookConfig enables the webhook sink when URL is set.
+type CDCWebhookConfig struct {
+	URL     string        `yaml:"url"`
+	Secret  string        `yaml:"secret"`
+	Timeout time.Duration `yaml:"timeout"`
+}
+
+// CDCNATSConfig enables the NATS sink when URL is set. A JetStream stream
+// has to store Subject.
+type CDCNATSConfig struct {
+	URL     string `yaml:"url"`
+	Subject string `yaml:"subject"`
+}
+
+// ForTenant is the storage of a tenant: the file backend keeps each tenant
+// in a file of its own next to Path, e.g. users.acme.json.
+func (c StorageConfig) ForTenant(name string) StorageConfig {
+	if c.Path != "" {
+		ext := filepath.Ext(c.Path)
+		c.Path = strings.TrimSuffix(c.Path, ext) + "." + name + ext
+	}
+	return c
+}
+
+const (
+	BackendMemory = "memory"
+	BackendFile   = "file"
+)
+
+func Default() Config {
+	return Config{
+		Server: ServerConfig{
+			ListenAddress:   ":8080",
+			ShutdownTimeout: 10 * time.Second,
+		},
+		Storage: StorageConfig{
+			Backend:       BackendMemory,
+			FlushInterval: 5 * time.Second,
+		},
+		Seed: SeedConfig{
+			Mode: "strict",
+		},
+		TLS: TLSConfig{
+			ReloadInterval: 30 * time.Second,
+		},
+		Limits: LimitsConfig{
+			MaxRecvMsgSize:       4 << 20,
+			MaxSendMsgSize:       4 << 20,
+			MaxConcurrentStreams: 100,
+			ConnectionTimeout:    120 * time.Second,
+		},
+		Log: LogConfig{
+			Level:        "info",
+			Format:       "text",
+			SampleRate:   1,
+			RedactFields: []string{"phone", "email", "date_of_birth"},
+		},
+		Metrics: MetricsConfig{
+			ListenAddress: ":9090",
+		},
+		Tracing: TracingConfig{
+			Exporter:     "none",
+			OTLPEndpoint: "localhost:4317",
+			SampleRatio:  1,
+		},
+		Auth: AuthConfig{
+			ExemptMethods: []string{
+				"/grpc.health.v1.Health/*",
+				"/grpc.reflection.v1.ServerReflection/*",
+				"/grpc.reflection.v1alpha.ServerReflection/*",
+			},
+		},
+		RateLimit: RateLimitConfig{
+			Rate:  50,
+			Burst: 100,
+			ExemptMethods: []string{
+				"/grpc.health.v1.Health/*",
+			},
+		},
+		LoadShed: LoadShedConfig{
+			InitialLimit:     100,
+			MinLimit:         10,
+			MaxLimit:         1000,
+			LatencyThreshold: 250 * time.Millisecond,
+			ExemptMethods: []string{
+				"/grpc.health.v1.Health/*",
+				"/admin.v1.AdminService/*",
+			},
+		},
+		Deadlines: DeadlinesConfig{
+			Default: 30 * time.Second,
+			Max:     5 * time.Minute,
+		},
+		IDs: IDsConfig{
+			Generator: "sequential",
+		},
+		Idempotency: IdempotencyConfig{
+			Enabled:    true,
+			TTL:        24 * time.Hour,
+			MaxEntries: 100000,
+			Methods: []string{
+				"/UserService/AddUser",
+				"/UserService/CreateUser",
+				"/users.v1.UserService/AddUser",
+				"/users.v1.UserService/CreateUser",
+				"/users.v2.UserService/AddUser",
+				"/users.v2.UserService/CreateUser",
+				"/users.v2.UserService/UpdateUser",
+				"/users.v2.UserService/DeleteUser",
+				"/users.v2.UserService/BatchWrite",
+			},
+		},
+		Audit: AuditConfig{
+			Path: "audit.log",
+			Methods: []string{
+				"/UserService/AddUser",
+				"/UserService/CreateUser",
+				"/users.v1.UserService/AddUser",
+				"/users.v1.UserService/CreateUser",
+				"/users.v2.UserService/AddUser",
+				"/users.v2.UserService/CreateUser",
+				"/users.v2.UserService/UpdateUser",
+				"/users.v2.UserService/DeleteUser",
+				"/users.v2.UserService/BatchWrite",
+				"/admin.v1.AdminService/QueryAuditLog",
+			},
+			SensitiveFields: []string{"phone"},
+		},
+		Tenancy: TenancyConfig{
+			ExemptMethods: []string{
+				"/grpc.health.v1.Health/*",
+				"/grpc.reflection.v1.ServerReflection/*",
+				"/grpc.reflection.v1alpha.ServerReflection/*",
+				"/admin.v1.AdminService/*",
+			},
+		},
+		CDC: CDCConfig{
+			Format:       "json",
+			PollInterval: time.Second,
+			BatchSize:    100,
+			MaxAttempts:  5,
+			Backoff:      100 * time.Millisecond,
+			MaxBackoff:   30 * time.Second,
+			File:         CDCFileConfig{MaxBytes: 100 << 20, MaxFiles: 5},
+			Webhook:      CDCWebhookConfig{Timeout: 10 * time.Second},
+			NATS:         CDCNATSConfig{Subject: "users.changes"},
+		},
+	}
+}
+
+// LoadFile merges the YAML file at path on top of c. Keys missing from the
+// file keep their current value, unknown keys are an error.
+func (c *Config) LoadFile(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	dec := yaml.NewDecoder(f)
+	dec.KnownFields(true)
+	if err := dec.Decode(c); err != nil && err != io.EOF {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+	return nil
+}
+
+func (c Config) Validate() error {
+	var errs []error
+	invalid := func(name string, format string, args ...any) {
+		errs = append(errs, fmt.Errorf("%s: %s", name, fmt.Sprintf(format, args...)))
+	}
+
+	if _, _, err := net.SplitHostPort(c.Server.ListenAddress); err != nil {
+		invalid("server.listen_address", "%v", err)
+	}
+	if c.Server.ShutdownTimeout <= 0 {
+		invalid("server.shutdown_timeout", "must be positive, got %v", c.Server.ShutdownTimeout)
+	}
+
+	switch c.Storage.Backend {
+	case BackendMemory:
+	case BackendFile:
+		if c.Storage.Path == "" {
+			invalid("storage.path", "required when storage.backend is %q", BackendFile)
+		}
+		if c.Storage.FlushInterval <= 0 {
+			invalid("storage.flush_interval", "must be positive, got %v", c.Storage.FlushInterval)
+		}
+	default:
+		invalid("storage.backend", "must be %q or %q, got %q", BackendMemory, BackendFile, c.Storage.Backend)
+	}
+
+	validSeedFile := func(name, path string) {
+		if path == "" {
+			return
+		}
+		if _, err := os.Stat(path); err != nil {
+			invalid(name, "%v", err)
+		}
+		switch strings.ToLower(filepath.Ext(path)) {
+		case ".json", ".jsonl", ".ndjson", ".csv":
+		default:
+			invalid(name, "must be a .json, .jsonl or .csv file, got %q", path)
+		}
+	}
+	validSeedFile("seed.file", c.Seed.File)
+	switch c.Seed.Mode {
+	case "strict", "lenient":
+	default:
+		invalid("seed.mode", "must be strict or lenient, got %q", c.Seed.Mode)
+	}
+
+	if c.TLS.Enabled {
+		requireFile := func(name, path string) {
+			if path == "" {
+				invalid(name, "required when tls.enabled is true")
+				return
+			}
+			if _, err := os.Stat(path); err != nil {
+				invalid(name, "%v", err)
+			}
+		}
+		requireFile("tls.cert_file", c.TLS.CertFile)
+		requireFile("tls.key_file", c.TLS.KeyFile)
+		if c.TLS.ClientCAFile != "" {
+			requireFile("tls.client_ca_file", c.TLS.ClientCAFile)
+		} else if c.TLS.RequireClientCert {
+			invalid("tls.client_ca_file", "required when tls.require_client_cert is true")
+		}
+		if c.TLS.ReloadInterval <= 0 {
+			invalid("tls.reload_interval", "must be positive, got %v", c.TLS.ReloadInterval)
+		}
+	}
+
+	if c.Limits.MaxRecvMsgSize <= 0 {
+		invalid("limits.max_recv_msg_size", "must be positive, got %d", c.Limits.MaxRecvMsgSize)
+	}
+	if c.Limits.MaxSendMsgSize <= 0 {
+		invalid("limits.max_send_msg_size", "must be positive, got %d", c.Limits.MaxSendMsgSize)
+	}
+	if c.Limits.MaxConcurrentStreams == 0 {
+		invalid("limits.max_concurrent_streams", "must be positive")
+	}
+	if c.Limits.ConnectionTimeout <= 0 {
+		invalid("limits.connection_timeout", "must be positive, got %v", c.Limits.ConnectionTimeout)
+	}
+
+	switch c.Log.Level {
+	case "debug", "info", "warn", "error":
+	default:
+		invalid("log.level", "must be one of debug, info, warn, error, got %q", c.Log.Level)
+	}
+	switch c.Log.Format {
+	case "text", "json":
+	default:
+		invalid("log.format", "must be text or json, got %q", c.Log.Format)
+	}
+	if c.Log.SampleRate < 0 || c.Log.SampleRate > 1 {
+		invalid("log.sample_rate", "must be between 0 and 1, got %v", c.Log.SampleRate)
+	}
+	for method, rate := range c.Log.MethodSampleRates {
+		if rate < 0 || rate > 1 {
+			invalid("log.method_sample_rates", "%s must be between 0 and 1, got %v", method, rate)
+		}
+	}
+
+	if c.Metrics.ListenAddress != "" {
+		if _, _, err := net.SplitHostPort(c.Metrics.ListenAddress); err != nil {
+			invalid("metrics.listen_address", "%v", err)
+		} else if c.Metrics.ListenAddress == c.Server.ListenAddress {
+			invalid("metrics.listen_address", "must differ from server.listen_address")
+		}
+	}
+
+	switch c.Tracing.Exporter {
+	case "none", "stdout", "otlp":
+	case "file":
+		if c.Tracing.File == "" {
+			invalid("tracing.file", "required when tracing.exporter is file")
+		}
+	default:
+		invalid("tracing.exporter", "must be one of none, stdout, file, otlp, got %q", c.Tracing.Exporter)
+	}
+	if c.Tracing.Exporter == "otlp" && c.Tracing.OTLPEndpoint == "" {
+		invalid("tracing.otlp_endpoint", "required when tracing.exporter is otlp")
+	}
+	if c.Tracing.SampleRatio < 0 || c.Tracing.SampleRatio > 1 {
+		invalid("tracing.sample_ratio", "must be between 0 and 1, got %v", c.Tracing.SampleRatio)
+	}
+
+	if c.Auth.Enabled {
+		if c.Auth.APIKeysFile == "" && c.Auth.JWTSecret == "" && c.Auth.JWKSFile == "" && c.TLS.ClientCAFile == "" {
+			invalid("auth", "api_keys_file, jwt_secret, jwks_file or tls.client_ca_file is required when auth.enabled is true")
+		}
+		for name, path := range map[string]string{"auth.api_keys_file": c.Auth.APIKeysFile, "auth.jwks_file": c.Auth.JWKSFile, "auth.policy_file": c.Auth.PolicyFile} {
+			if path == "" {
+				continue
+			}
+			if _, err := os.Stat(path); err != nil {
+				invalid(name, "%v", err)
+			}
+		}
+		if c.Auth.JWTSecret != "" && c.Auth.JWKSFile != "" {
+			invalid("auth.jwt_secret", "cannot be combined with auth.jwks_file")
+		}
+		for _, pattern := range c.Auth.ExemptMethods {
+			if exemptsAdmin(pattern) {
+				invalid("auth.exempt_methods", "must not exempt AdminService, got %q", pattern)
+			}
+		}
+	} else if c.Auth.PolicyFile != "" {
+		invalid("auth.policy_file", "requires auth.enabled")
+	}
+
+	validLimit := func(name string, rate float64, burst, quota int) {
+		if rate < 0 {
+			invalid(name+".rate", "must not be negative, got %v", rate)
+		}
+		if rate > 0 && burst < 1 {
+			invalid(name+".burst", "must be at least 1 when rate is set, got %d", burst)
+		}
+		if quota < 0 {
+			invalid(name+".daily_quota", "must not be negative, got %d", quota)
+		}
+	}
+	validLimit("rate_limit", c.RateLimit.Rate, c.RateLimit.Burst, c.RateLimit.DailyQuota)
+	for method, limit := range c.RateLimit.Methods {
+		validLimit("rate_limit.methods."+method, limit.Rate, limit.Burst, limit.DailyQuota)
+	}
+
+	if c.Tenancy.Enabled {
+		if len(c.Tenancy.Tenants) == 0 {
+			invalid("tenancy.tenants", "must name at least one tenant when tenancy is enabled")
+		}
+		for name, t := range c.Tenancy.Tenants {
+			if !tenant.ValidName(name) {
+				invalid("tenancy.tenants."+name, "name must be lower case letters, digits, - and _")
+			}
+			validSeedFile("tenancy.tenants."+name+".seed_file", t.SeedFile)
+			validLimit("tenancy.tenants."+name+".rate_limit", t.RateLimit.Rate, t.RateLimit.Burst, t.RateLimit.DailyQuota)
+		}
+		if _, ok := c.Tenancy.Tenants[c.Tenancy.DefaultTenant]; c.Tenancy.DefaultTenant != "" && !ok {
+			invalid("tenancy.default_tenant", "must be one of tenancy.tenants, got %q", c.Tenancy.DefaultTenant)
+		}
+	}
+
+	if c.LoadShed.MinLimit < 1 {
+		invalid("load_shedding.min_limit", "must be at least 1, got %d", c.LoadShed.MinLimit)
+	}
+	if c.LoadShed.MaxLimit < c.LoadShed.MinLimit {
+		invalid("load_shedding.max_limit", "must be at least min_limit, got %d", c.LoadShed.MaxLimit)
+	}
+	if c.LoadShed.InitialLimit < c.LoadShed.MinLimit || c.LoadShed.InitialLimit > c.LoadShed.MaxLimit {
+		invalid("load_shedding.initial_limit", "must be between min_limit and max_limit, got %d", c.LoadShed.InitialLimit)
+	}
+	if c.LoadShed.LatencyThreshold <= 0 {
+		invalid("load_shedding.latency_threshold", "must be positive, got %v", c.LoadShed.LatencyThreshold)
+	}
+
+	validDeadline := func(name string, d MethodDeadline) {
+		if d.Default < 0 {
+			invalid(name+".default", "must not be negative, got %v", d.Default)
+		}
+		if d.Max < 0 {
+			invalid(name+".max", "must not be negative, got %v", d.Max)
+		} else if d.Max > 0 && d.Default > d.Max {
+			invalid(name+".default", "must not exceed max %v, got %v", d.Max, d.Default)
+		}
+	}
+	validDeadline("deadlines", MethodDeadline{Default: c.Deadlines.Default, Max: c.Deadlines.Max})
+	for method, d := range c.Deadlines.Methods {
+		validDeadline("deadlines.methods."+method, d)
+	}
+
+	switch c.IDs.Generator {
+	case "sequential", "snowflake", "uuidv7":
+	default:
+		invalid("ids.generator", "must be one of sequential, snowflake, uuidv7, got %q", c.IDs.Generator)
+	}
+	if c.IDs.NodeID < 0 || c.IDs.NodeID > 1023 {
+		invalid("ids.node_id", "must be between 0 and 1023, got %d", c.IDs.NodeID)
+	}
+
+	if c.Idempotency.Enabled && c.Idempotency.TTL <= 0 {
+		invalid("idempotency.ttl", "must be positive, got %v", c.Idempotency.TTL)
+	}
+	if c.Idempotency.Enabled && c.Idempotency.MaxEntries <= 0 {
+		invalid("idempotency.max_entries", "must be positive, got %d", c.Idempotency.MaxEntries)
+	}
+	if c.Audit.Enabled && c.Audit.Path == "" {
+		invalid("audit.path", "is required when audit logging is enabled")
+	}
+
+	if c.CDC.Enabled {
+		if c.CDC.File.Path == "" && c.CDC.Webhook.URL == "" && c.CDC.NATS.URL == "" {
+			invalid("cdc", "file.path, webhook.url or nats.url is required when cdc.enabled is true")
+		}
+		switch c.CDC.Format {
+		case "json", "protobuf":
+		default:
+			invalid("cdc.format", "must be json or protobuf, got %q", c.CDC.Format)
+		}
+		if c.CDC.PollInterval <= 0 {
+			invalid("cdc.poll_interval", "must be positive, got %v", c.CDC.PollInterval)
+		}
+		if c.CDC.BatchSize < 1 {
+			invalid("cdc.batch_size", "must be at least 1, got %d", c.CDC.BatchSize)
+		}
+		if c.CDC.MaxAttempts < 1 {
+			invalid("cdc.max_attempts", "must be at least 1, got %d", c.CDC.MaxAttempts)
+		}
+		if c.CDC.Backoff <= 0 || c.CDC.MaxBackoff < c.CDC.Backoff {
+			invalid("cdc.backoff", "must be positive and at most max_backoff, got %v and %v", c.CDC.Backoff, c.CDC.MaxBackoff)
+		}
+		if c.CDC.File.Path != "" && (c.CDC.File.MaxBytes < 1 || c.CDC.File.MaxFiles < 1) {
+			invalid("cdc.file", "max_bytes and max_files must be at least 1")
+		}
+		if c.CDC.Webhook.URL != "" {
+			if u, err := url.Parse(c.CDC.Webhook.URL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+				invalid("cdc.webhook.url", "must be an http or https URL, got %q", c.CDC.Webhook.URL)
+			}
+			if c.CDC.Webhook.Timeout <= 0 {
+				invalid("cdc.webhook.timeout", "must be positive, got %v", c.CDC.Webhook.Timeout)
+			}
+		}
+		if c.CDC.NATS.URL != "" {
+			if u, err := url.Parse(c.CDC.NATS.URL); err != nil || u.Scheme != "nats" || u.Host == "" {
+				invalid("cdc.nats.url", "must be a nats://host:port URL, got %q", c.CDC.NATS.URL)
+			}
+			if c.CDC.NATS.Subject == "" {
+				invalid("cdc.nats.subject", "required with cdc.nats.url")
+			}
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// redacted replaces secrets in YAML, which is printed and pasted into logs.
+const redacted = "<redacted>"
+
+// YAML is the configuration with its secrets redacted.
+func (c Config) YAML() ([]byte, error) {
+	if c.Auth.JWTSecret != "" {
+		c.Auth.JWTSecret = redacted
+	}
+	if c.CDC.Webhook.Secret != "" {
+		c.CDC.Webhook.Secret = redacted
+	}
+	return yaml.Marshal(c)
+}
+
+// adminServicePrefix starts the full method names of AdminService, which is
+// only served to authenticated callers.
+const adminServicePrefix = "/admin.v1.AdminService/"
+
+// exemptsAdmin reports whether a method pattern, a full method name or a
+// prefix ending in "*", matches an AdminService method.
+func exemptsAdmin(pattern string) bool {
+	if prefix, ok := strings.CutSuffix(pattern, "*"); ok {
+		return strings.HasPrefix(adminServicePrefix, prefix) || strings.HasPrefix(prefix, adminServicePrefix)
+	}
+	return strings.HasPrefix(pattern, adminServicePrefix)
+}
@@ -0,0 +1,146 @@
+package config
+
+import (
+	"flag"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func env(vars map[string]string) func(string) (string, bool) {
+	return func(key string) (string, bool) {
+		v, ok := vars[key]
+		return v, ok
+	}
+}
+
+func TestLoad(t *testing.T) {
+	t.Run("Defaults", func(t *testing.T) {
+		cfg, opts, err := Load(flag.NewFlagSet("test", flag.ContinueOnError), nil, env(nil))
+		require.NoError(t, err)
+		assert.Equal(t, Default(), cfg)
+		assert.False(t, opts.PrintConfig)
+	})
+
+	t.Run("File, env and flags are layered", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "config.yaml")
+		require.NoError(t, os.WriteFile(path, []byte(`
+server:
+  listen_address: ":9000"
+  shutdown_timeout: 3s
+log:
+  level: debug
+  format: json
+`), 0o600))
+
+		cfg, opts, err := Load(flag.NewFlagSet("test", flag.ContinueOnError), []string{"--config", path, "-log.level=warn", "--print-config"}, env(map[string]string{
+			"USERSVC_SERVER_LISTEN_ADDRESS": ":9001",
+			"USERSVC_LOG_LEVEL":             "error",
+		}))
+		require.NoError(t, err)
+		assert.True(t, opts.PrintConfig)
+		assert.Equal(t, ":9001", cfg.Server.ListenAddress)
+		assert.Equal(t, 3*time.Second, cfg.Server.ShutdownTimeout)
+		assert.Equal(t, "warn", cfg.Log.Level)
+		assert.Equal(t, "json", cfg.Log.Format)
+	})
+
+	t.Run("Printed config redacts secrets", func(t *testing.T) {
+		cfg, _, err := Load(flag.NewFlagSet("test", flag.ContinueOnError), []string{"-auth.enabled", "-auth.jwt-secret=s3cret", "-cdc.enabled", "-cdc.webhook.url=https://example.com/hook", "-cdc.webhook.secret=h00k"}, env(nil))
+		require.NoError(t, err)
+		out, err := cfg.YAML()
+		require.NoError(t, err)
+		assert.NotContains(t, string(out), "s3cret")
+		assert.NotContains(t, string(out), "h00k")
+		assert.Equal(t, 2, strings.Count(string(out), "secret: <redacted>"))
+		assert.Equal(t, "s3cret", cfg.Auth.JWTSecret)
+	})
+
+	t.Run("Config file from env", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "config.yaml")
+		require.NoError(t, os.WriteFile(path, []byte("server:\n  reflection: true\n"), 0o600))
+
+		cfg, _, err := Load(flag.NewFlagSet("test", flag.ContinueOnError), nil, env(map[string]string{"USERSVC_CONFIG": path}))
+		require.NoError(t, err)
+		assert.True(t, cfg.Server.Reflection)
+	})
+
+	t.Run("Unknown file key", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "config.yaml")
+		require.NoError(t, os.WriteFile(path, []byte("server:\n  listen: \":9000\"\n"), 0o600))
+
+		_, _, err := Load(flag.NewFlagSet("test", flag.ContinueOnError), []string{"-config", path}, env(nil))
+		assert.ErrorContains(t, err, "field listen not found")
+	})
+
+	t.Run("Malformed env value", func(t *testing.T) {
+		_, _, err := Load(flag.NewFlagSet("test", flag.ContinueOnError), nil, env(map[string]string{"USERSVC_SERVER_SHUTDOWN_TIMEOUT": "soon"}))
+		assert.ErrorContains(t, err, "USERSVC_SERVER_SHUTDOWN_TIMEOUT")
+	})
+
+	t.Run("Malformed flag value", func(t *testing.T) {
+		_, _, err := Load(flag.NewFlagSet("test", flag.ContinueOnError), []string{"-limits.max-recv-msg-size=big"}, env(nil))
+		assert.Error(t, err)
+	})
+
+	t.Run("Invalid values", func(t *testing.T) {
+		_, _, err := Load(flag.NewFlagSet("test", flag.ContinueOnError), []string{"-storage.backend=file", "-tls.enabled"}, env(nil))
+		assert.ErrorContains(t, err, "storage.path: required")
+		assert.ErrorContains(t, err, "tls.cert_file: required")
+		assert.ErrorContains(t, err, "tls.key_file: required")
+	})
+
+	t.Run("Tenancy", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "config.yaml")
+		require.NoError(t, os.WriteFile(path, []byte(`
+storage:
+  backend: file
+  path: data/users.json
+tenancy:
+  enabled: true
+  tenants:
+    acme: {rate_limit: {rate: 10, burst: 20}}
+    globex: {}
+  default_tenant: acme
+`), 0o600))
+
+		cfg, _, err := Load(flag.NewFlagSet("test", flag.ContinueOnError), []string{"--config", path}, env(nil))
+		require.NoError(t, err)
+		assert.Len(t, cfg.Tenancy.Tenants, 2)
+		assert.Equal(t, "data/users.acme.json", cfg.Storage.ForTenant("acme").Path)
+
+		_, _, err = Load(flag.NewFlagSet("test", flag.ContinueOnError), []string{"--config", path, "-tenancy.default-tenant=initech"}, env(nil))
+		assert.ErrorContains(t, err, "tenancy.default_tenant")
+
+		_, _, err = Load(flag.NewFlagSet("test", flag.ContinueOnError), []string{"-tenancy.enabled"}, env(nil))
+		assert.ErrorContains(t, err, "tenancy.tenants")
+	})
+
+	t.Run("Change data capture", func(t *testing.T) {
+		_, _, err := Load(flag.NewFlagSet("test", flag.ContinueOnError), []string{"-cdc.enabled"}, env(nil))
+		assert.ErrorContains(t, err, "cdc: file.path, webhook.url or nats.url is required")
+
+		_, _, err = Load(flag.NewFlagSet("test", flag.ContinueOnError), []string{"-cdc.enabled", "-cdc.format=xml", "-cdc.webhook.url=ftp://example.com", "-cdc.nats.url=localhost:4222"}, env(nil))
+		assert.ErrorContains(t, err, "cdc.format")
+		assert.ErrorContains(t, err, "cdc.webhook.url")
+		assert.ErrorContains(t, err, "cdc.nats.url")
+
+		cfg, _, err := Load(flag.NewFlagSet("test", flag.ContinueOnError), []string{"-cdc.enabled", "-cdc.nats.url=nats://localhost:4222"}, env(nil))
+		require.NoError(t, err)
+		assert.Equal(t, "users.changes", cfg.CDC.NATS.Subject)
+	})
+
+	t.Run("AdminService cannot be exempted from auth", func(t *testing.T) {
+		for _, pattern := range []string{"*", "/admin.*", "/admin.v1.AdminService/*", "/admin.v1.AdminService/GetUsage"} {
+			_, _, err := Load(flag.NewFlagSet("test", flag.ContinueOnError), []string{"-auth.enabled", "-auth.jwt-secret=s3cret", "-auth.exempt-methods=" + pattern}, env(nil))
+			assert.ErrorContains(t, err, "auth.exempt_methods", pattern)
+		}
+		_, _, err := Load(flag.NewFlagSet("test", flag.ContinueOnError), []string{"-auth.enabled", "-auth.jwt-secret=s3cret", "-auth.exempt-methods=/grpc.health.v1.Health/*"}, env(nil))
+		assert.NoError(t, err)
+	})
+}
@@ -0,0 +1,265 @@
+package config
+
+import (
+	"flag"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// EnvPrefix is prepended to every environment variable, e.g. the setting
+// server.listen_address is read from USERSVC_SERVER_LISTEN_ADDRESS.
+const EnvPrefix = "USERSVC_"
+
+// setting is a single configuration key that can be overridden from the
+// environment and the command line.
+type setting struct {
+	name  string
+	usage string
+	bool  bool
+	set   func(c *Config, value string) error
+}
+
+func (s setting) env() string {
+	return EnvPrefix + strings.ToUpper(strings.ReplaceAll(s.name, ".", "_"))
+}
+
+func (s setting) flag() string {
+	return strings.ReplaceAll(s.name, "_", "-")
+}
+
+func stringSetting(name, usage string, field func(c *Config) *string) setting {
+	return setting{name: name, usage: usage, set: func(c *Config, value string) error {
+		*field(c) = value
+		return nil
+	}}
+}
+
+func boolSetting(name, usage string, field func(c *Config) *bool) setting {
+	return setting{name: name, usage: usage, bool: true, set: func(c *Config, value string) error {
+		v, err := strconv.ParseBool(value)
+		if err != nil {
+			return err
+		}
+		*field(c) = v
+		return nil
+	}}
+}
+
+func intSetting(name, usage string, field func(c *Config) *int) setting {
+	return setting{name: name, usage: usage, set: func(c *Config, value string) error {
+		v, err := strconv.Atoi(value)
+		if err != nil {
+			return err
+		}
+		*field(c) = v
+		return nil
+	}}
+}
+
+func uint32Setting(name, usage string, field func(c *Config) *uint32) setting {
+	return setting{name: name, usage: usage, set: func(c *Config, value string) error {
+		v, err := strconv.ParseUint(value, 10, 32)
+		if err != nil {
+			return err
+		}
+		*field(c) = uint32(v)
+		return nil
+	}}
+}
+
+func floatSetting(name, usage string, field func(c *Config) *float64) setting {
+	return setting{name: name, usage: usage, set: func(c *Config, value string) error {
+		v, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return err
+		}
+		*field(c) = v
+		return nil
+	}}
+}
+
+// listSetting takes a comma separated list, an empty value clears it.
+func listSetting(name, usage string, field func(c *Config) *[]string) setting {
+	return setting{name: name, usage: usage, set: func(c *Config, value string) error {
+		var list []string
+		for _, v := range strings.Split(value, ",") {
+			if v = strings.TrimSpace(v); v != "" {
+				list = append(list, v)
+			}
+		}
+		*field(c) = list
+		return nil
+	}}
+}
+
+func durationSetting(name, usage string, field func(c *Config) *time.Duration) setting {
+	return setting{name: name, usage: usage, set: func(c *Config, value string) error {
+		v, err := time.ParseDuration(value)
+		if err != nil {
+			return err
+		}
+		*field(c) = v
+		return nil
+	}}
+}
+
+var settings = []setting{
+	stringSetting("server.listen_address", "address the gRPC server listens on", func(c *Config) *string { return &c.Server.ListenAddress }),
+	boolSetting("server.reflection", "register the gRPC server reflection service", func(c *Config) *bool { return &c.Server.Reflection }),
+	durationSetting("server.shutdown_timeout", "how long in-flight RPCs may run after SIGINT/SIGTERM before they are cancelled", func(c *Config) *time.Duration { return &c.Server.ShutdownTimeout }),
+	stringSetting("storage.backend", "storage backend, memory or file", func(c *Config) *string { return &c.Storage.Backend }),
+	stringSetting("storage.path", "data file of the file storage backend", func(c *Config) *string { return &c.Storage.Path }),
+	durationSetting("storage.flush_interval", "how often the file storage backend writes pending changes", func(c *Config) *time.Duration { return &c.Storage.FlushInterval }),
+	stringSetting("seed.file", "JSON, JSONL or CSV file of users loaded into an empty repository", func(c *Config) *string { return &c.Seed.File }),
+	stringSetting("seed.mode", "strict aborts on any invalid seed row, lenient skips them", func(c *Config) *string { return &c.Seed.Mode }),
+	boolSetting("tls.enabled", "serve gRPC over TLS", func(c *Config) *bool { return &c.TLS.Enabled }),
+	stringSetting("tls.cert_file", "PEM encoded server certificate", func(c *Config) *string { return &c.TLS.CertFile }),
+	stringSetting("tls.key_file", "PEM encoded server private key", func(c *Config) *string { return &c.TLS.KeyFile }),
+	stringSetting("tls.client_ca_file", "PEM CA bundle verifying client certificates, enables mutual TLS", func(c *Config) *string { return &c.TLS.ClientCAFile }),
+	boolSetting("tls.require_client_cert", "reject clients without a valid certificate", func(c *Config) *bool { return &c.TLS.RequireClientCert }),
+	durationSetting("tls.reload_interval", "how often certificate files are checked for changes", func(c *Config) *time.Duration { return &c.TLS.ReloadInterval }),
+	intSetting("limits.max_recv_msg_size", "largest request message in bytes", func(c *Config) *int { return &c.Limits.MaxRecvMsgSize }),
+	intSetting("limits.max_send_msg_size", "largest response message in bytes", func(c *Config) *int { return &c.Limits.MaxSendMsgSize }),
+	uint32Setting("limits.max_concurrent_streams", "concurrent RPCs allowed per connection", func(c *Config) *uint32 { return &c.Limits.MaxConcurrentStreams }),
+	durationSetting("limits.connection_timeout", "deadline for new connections to complete the handshake", func(c *Config) *time.Duration { return &c.Limits.ConnectionTimeout }),
+	stringSetting("log.level", "log level, one of debug, info, warn, error", func(c *Config) *string { return &c.Log.Level }),
+	stringSetting("log.format", "log format, text or json", func(c *Config) *string { return &c.Log.Format }),
+	floatSetting("log.sample_rate", "fraction of successful RPCs logged, failures are always logged", func(c *Config) *float64 { return &c.Log.SampleRate }),
+	boolSetting("log.payloads", "log request and response messages", func(c *Config) *bool { return &c.Log.Payloads }),
+	listSetting("log.redact_fields", "comma separated proto fields masked in logged messages", func(c *Config) *[]string { return &c.Log.RedactFields }),
+	stringSetting("metrics.listen_address", "HTTP address serving Prometheus metrics on /metrics, empty disables it", func(c *Config) *string { return &c.Metrics.ListenAddress }),
+	stringSetting("tracing.exporter", "trace exporter, one of none, stdout, file, otlp", func(c *Config) *string { return &c.Tracing.Exporter }),
+	stringSetting("tracing.file", "file the file trace exporter appends spans to", func(c *Config) *string { return &c.Tracing.File }),
+	stringSetting("tracing.otlp_endpoint", "host:port of the OTLP/gRPC collector", func(c *Config) *string { return &c.Tracing.OTLPEndpoint }),
+	boolSetting("tracing.otlp_insecure", "connect to the OTLP collector without TLS", func(c *Config) *bool { return &c.Tracing.OTLPInsecure }),
+	floatSetting("tracing.sample_ratio", "fraction of new traces recorded", func(c *Config) *float64 { return &c.Tracing.SampleRatio }),
+	boolSetting("auth.enabled", "require an API key or bearer token on every RPC", func(c *Config) *bool { return &c.Auth.Enabled }),
+	stringSetting("auth.api_keys_file", "YAML file of hashed API keys", func(c *Config) *string { return &c.Auth.APIKeysFile }),
+	stringSetting("auth.jwt_secret", "shared secret verifying HS256/384/512 tokens", func(c *Config) *string { return &c.Auth.JWTSecret }),
+	stringSetting("auth.jwks_file", "JSON Web Key Set verifying RS, PS and ES tokens", func(c *Config) *string { return &c.Auth.JWKSFile }),
+	stringSetting("auth.jwt_issuer", "required iss claim of tokens", func(c *Config) *string { return &c.Auth.JWTIssuer }),
+	stringSetting("auth.jwt_audience", "required aud claim of tokens", func(c *Config) *string { return &c.Auth.JWTAudience }),
+	stringSetting("auth.policy_file", "YAML file of roles and the permissions RPCs and fields require", func(c *Config) *string { return &c.Auth.PolicyFile }),
+	listSetting("auth.exempt_methods", "comma separated full methods, or prefixes ending in *, callable without credentials", func(c *Config) *[]string { return &c.Auth.ExemptMethods }),
+	boolSetting("rate_limit.enabled", "limit the request rate and daily requests of every client", func(c *Config) *bool { return &c.RateLimit.Enabled }),
+	floatSetting("rate_limit.rate", "requests per second per client", func(c *Config) *float64 { return &c.RateLimit.Rate }),
+	intSetting("rate_limit.burst", "requests a client may make at once", func(c *Config) *int { return &c.RateLimit.Burst }),
+	intSetting("rate_limit.daily_quota", "requests per client per UTC day, 0 is unlimited", func(c *Config) *int { return &c.RateLimit.DailyQuota }),
+	listSetting("rate_limit.exempt_methods", "comma separated full methods, or prefixes ending in *, that are never limited", func(c *Config) *[]string { return &c.RateLimit.ExemptMethods }),
+	boolSetting("load_shedding.enabled", "shed RPCs beyond an adaptive concurrency limit", func(c *Config) *bool { return &c.LoadShed.Enabled }),
+	intSetting("load_shedding.initial_limit", "concurrency limit at startup", func(c *Config) *int { return &c.LoadShed.InitialLimit }),
+	intSetting("load_shedding.min_limit", "lowest concurrency limit", func(c *Config) *int { return &c.LoadShed.MinLimit }),
+	intSetting("load_shedding.max_limit", "highest concurrency limit", func(c *Config) *int { return &c.LoadShed.MaxLimit }),
+	durationSetting("load_shedding.latency_threshold", "RPC duration above which the concurrency limit shrinks", func(c *Config) *time.Duration { return &c.LoadShed.LatencyThreshold }),
+	listSetting("load_shedding.exempt_methods", "comma separated full methods, or prefixes ending in *, that are never shed", func(c *Config) *[]string { return &c.LoadShed.ExemptMethods }),
+	durationSetting("deadlines.default", "deadline of unary RPCs sent without one, 0 for none", func(c *Config) *time.Duration { return &c.Deadlines.Default }),
+	durationSetting("deadlines.max", "longest deadline a client may send, 0 for no limit", func(c *Config) *time.Duration { return &c.Deadlines.Max }),
+	stringSetting("ids.generator", "ID generator of CreateUser, one of sequential, snowflake, uuidv7", func(c *Config) *string { return &c.IDs.Generator }),
+	intSetting("ids.node_id", "node of this server in Snowflake IDs, 0 to 1023", func(c *Config) *int { return &c.IDs.NodeID }),
+	boolSetting("idempotency.enabled", "replay the outcome of mutations retried with the same idempotency-key", func(c *Config) *bool { return &c.Idempotency.Enabled }),
+	durationSetting("idempotency.ttl", "how long outcomes are kept for replay", func(c *Config) *time.Duration { return &c.Idempotency.TTL }),
+	intSetting("idempotency.max_entries", "outcomes kept at most, new keys are rejected beyond", func(c *Config) *int { return &c.Idempotency.MaxEntries }),
+	listSetting("idempotency.methods", "comma separated full methods, or prefixes ending in *, that honour idempotency keys", func(c *Config) *[]string { return &c.Idempotency.Methods }),
+	boolSetting("audit.enabled", "record mutations and reads of sensitive fields in a hash-chained audit log", func(c *Config) *bool { return &c.Audit.Enabled }),
+	stringSetting("audit.path", "append-only audit log file", func(c *Config) *string { return &c.Audit.Path }),
+	listSetting("audit.methods", "comma separated full methods, or prefixes ending in *, audited on every call", func(c *Config) *[]string { return &c.Audit.Methods }),
+	listSetting("audit.sensitive_fields", "comma separated response fields that get reads returning them audited", func(c *Config) *[]string { return &c.Audit.SensitiveFields }),
+	boolSetting("tenancy.enabled", "keep the users of every tenant apart, tenants are listed in the config file", func(c *Config) *bool { return &c.Tenancy.Enabled }),
+	stringSetting("tenancy.default_tenant", "tenant of calls naming none, empty rejects them", func(c *Config) *string { return &c.Tenancy.DefaultTenant }),
+	listSetting("tenancy.exempt_methods", "comma separated full methods, or prefixes ending in *, that belong to no tenant", func(c *Config) *[]string { return &c.Tenancy.ExemptMethods }),
+	boolSetting("cdc.enabled", "publish every committed user change to the configured sinks", func(c *Config) *bool { return &c.CDC.Enabled }),
+	stringSetting("cdc.format", "event encoding, json or protobuf", func(c *Config) *string { return &c.CDC.Format }),
+	durationSetting("cdc.poll_interval", "how often the outbox is checked for changes", func(c *Config) *time.Duration { return &c.CDC.PollInterval }),
+	intSetting("cdc.batch_size", "changes read from the outbox at once", func(c *Config) *int { return &c.CDC.BatchSize }),
+	intSetting("cdc.max_attempts", "deliveries tried per sink and event before it is dead lettered", func(c *Config) *int { return &c.CDC.MaxAttempts }),
+	durationSetting("cdc.backoff", "wait before the first retry of a delivery, doubled on every retry", func(c *Config) *time.Duration { return &c.CDC.Backoff }),
+	durationSetting("cdc.max_backoff", "longest wait between retries of a delivery", func(c *Config) *time.Duration { return &c.CDC.MaxBackoff }),
+	stringSetting("cdc.dead_letter_file", "file receiving events a sink failed to take, empty retries them forever", func(c *Config) *string { return &c.CDC.DeadLetterFile }),
+	stringSetting("cdc.file.path", "file the file sink appends events to", func(c *Config) *string { return &c.CDC.File.Path }),
+	intSetting("cdc.file.max_bytes", "size at which the file sink rotates its file", func(c *Config) *int { return &c.CDC.File.MaxBytes }),
+	intSetting("cdc.file.max_files", "rotated files the file sink keeps", func(c *Config) *int { return &c.CDC.File.MaxFiles }),
+	stringSetting("cdc.webhook.url", "URL the webhook sink POSTs events to", func(c *Config) *string { return &c.CDC.Webhook.URL }),
+	stringSetting("cdc.webhook.secret", "secret signing webhook requests with HMAC-SHA256", func(c *Config) *string { return &c.CDC.Webhook.Secret }),
+	durationSetting("cdc.webhook.timeout", "deadline of every webhook request", func(c *Config) *time.Duration { return &c.CDC.Webhook.Timeout }),
+	stringSetting("cdc.nats.url", "nats://host:port of the NATS server of the NATS sink", func(c *Config) *string { return &c.CDC.NATS.URL }),
+	stringSetting("cdc.nats.subject", "subject the NATS sink publishes events to", func(c *Config) *string { return &c.CDC.NATS.Subject }),
+}
+
+// flagValue records a command line override so it can be applied after the
+// config file and the environment.
+type flagValue struct {
+	setting   setting
+	overrides map[string]string
+}
+
+func (v flagValue) String() string { return "" }
+
+func (v flagValue) Set(value string) error {
+	if err := v.setting.set(&Config{}, value); err != nil {
+		return err
+	}
+	v.overrides[v.setting.name] = value
+	return nil
+}
+
+func (v flagValue) IsBoolFlag() bool { return v.setting.bool }
+
+type Options struct {
+	// PrintConfig is set by --print-config.
+	PrintConfig bool
+}
+
+// Load builds the configuration from, in increasing order of precedence, the
+// defaults, the YAML file given by --config (or USERSVC_CONFIG), USERSVC_*
+// environment variables and command line flags. The config flags are added
+// to fs, which may already define flags of its own, before parsing args.
+// The result is validated.
+func Load(fs *flag.FlagSet, args []string, lookupEnv func(string) (string, bool)) (Config, Options, error) {
+	var opts Options
+	configPath := fs.String("config", "", "YAML config file (env "+EnvPrefix+"CONFIG)")
+	fs.BoolVar(&opts.PrintConfig, "print-config", false, "print the effective configuration and exit")
+
+	overrides := map[string]string{}
+	for _, s := range settings {
+		fs.Var(flagValue{setting: s, overrides: overrides}, s.flag(), fmt.Sprintf("%s (env %s)", s.usage, s.env()))
+	}
+	if err := fs.Parse(args); err != nil {
+		return Config{}, opts, err
+	}
+
+	cfg := Default()
+
+	path := *configPath
+	if path == "" {
+		path, _ = lookupEnv(EnvPrefix + "CONFIG")
+	}
+	if path != "" {
+		if err := cfg.LoadFile(path); err != nil {
+			return Config{}, opts, fmt.Errorf("invalid config: %w", err)
+		}
+	}
+
+	for _, s := range settings {
+		value, ok := lookupEnv(s.env())
+		if !ok {
+			continue
+		}
+		if err := s.set(&cfg, value); err != nil {
+			return Config{}, opts, fmt.Errorf("invalid config: %s: %w", s.env(), err)
+		}
+	}
+
+	for _, s := range settings {
+		if value, ok := overrides[s.name]; ok {
+			// already parsed successfully by flagValue.Set
+			_ = s.set(&cfg, value)
+		}
+	}
+
+	if err := cfg.Validate(); err != nil {
+		return Config{}, opts, fmt.Errorf("invalid config:\n%w", err)
+	}
+	return cfg, opts, nil
+}
@@ -1,11 +1,38 @@
 package db
 
-import "github.com/kunal768/go-grpc-tc/user"
+import (
+	"context"
+	"sort"
+	"time"
+
+	"github.com/kunal768/go-grpc-tc/user"
+)
 
 func InitDb() user.UserDB {
 	db := user.UserDB{
-		1: {ID: 1, FName: "John", City: "New York", Phone: 1234567890, Height: 180.5, Married: true},
-		2: {ID: 2, FName: "Jane", City: "Los Angeles", Phone: 9876543210, Height: 165.2, Married: false},
+		1: {ID: 1, FName: "John", Address: user.Address{City: "New York"}, Phone: 1234567890, Height: 180.5, Married: true},
+		2: {ID: 2, FName: "Jane", Address: user.Address{City: "Los Angeles"}, Phone: 9876543210, Height: 165.2, Married: false},
 	}
 	return db
 }
+
+// Seed adds the InitDb users to repo in ID order.
+func Seed(ctx context.Context, repo user.Repository) error {
+	seed := InitDb()
+
+	ids := make([]user.UserId, 0, len(seed))
+	for id := range seed {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool {
+		return ids[i] < ids[j]
+	})
+
+	now := time.Now()
+	for _, id := range ids {
+		if _, err := repo.AddUser(ctx, stampTimes(seed[id], now)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
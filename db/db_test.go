@@ -0,0 +1,253 @@
+package db
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/kunal768/go-grpc-tc/user"
+	"github.com/kunal768/go-grpc-tc/utility"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func writeFile(t *testing.T, name, content string) string {
+	path := filepath.Join(t.TempDir(), name)
+	require.NoError(t, os.WriteFile(path, []byte(content), 0o600))
+	return path
+}
+
+func listUsers(t *testing.T, repo user.Repository) []user.User {
+	users, err := repo.ListUsers(context.Background(), 0, 0)
+	require.NoError(t, err)
+	return users
+}
+
+func TestReadUsers(t *testing.T) {
+	john := user.User{ID: 1, FName: "John", Address: user.Address{City: "New York"}, Phone: 1234567890, Height: 180.5, Married: true}
+
+	t.Run("JSON", func(t *testing.T) {
+		records, err := ReadUsers(strings.NewReader(`[
+			{"id": 1, "fname": "John", "city": "New York", "phone": 1234567890, "height": 180.5, "married": true},
+			{"id": "two"}
+		]`), FormatJSON)
+		require.NoError(t, err)
+		require.Len(t, records, 2)
+		assert.Equal(t, Record{Row: 1, User: john}, records[0])
+		assert.Equal(t, 2, records[1].Row)
+		assert.Error(t, records[1].Err)
+	})
+
+	t.Run("JSONL", func(t *testing.T) {
+		records, err := ReadUsers(strings.NewReader(
+			`{"id": 1, "fname": "John", "city": "New York", "phone": 1234567890, "height": 180.5, "married": true}
+
+{"id": 2, "nickname": "JJ", "address": {"city": "Boston", "county": "Suffolk"}}
+{"id": "three"}
+`), FormatJSONL)
+		require.NoError(t, err)
+		require.Len(t, records, 3)
+		assert.Equal(t, Record{Row: 1, User: john}, records[0])
+		assert.Equal(t, 3, records[1].Row)
+		assert.NoError(t, records[1].Err, "unknown fields are ignored")
+		assert.Equal(t, "Boston", records[1].User.Address.City)
+		assert.Equal(t, []string{"address.county", "nickname"}, records[1].Unknown)
+		assert.Error(t, records[2].Err)
+	})
+
+	t.Run("CSV", func(t *testing.T) {
+		records, err := ReadUsers(strings.NewReader(
+			"id,fname,city,phone,height,married\n"+
+				"1,John,New York,1234567890,180.5,true\n"+
+				"2,Jane,Los Angeles,not-a-phone,165.2,false\n"+
+				"3,Bob\n"), FormatCSV)
+		require.NoError(t, err)
+		require.Len(t, records, 3)
+		assert.Equal(t, Record{Row: 1, User: john}, records[0])
+		assert.ErrorContains(t, records[1].Err, "phone")
+		assert.ErrorContains(t, records[2].Err, "expected 6 fields")
+	})
+
+	t.Run("CSV with unknown column", func(t *testing.T) {
+		_, err := ReadUsers(strings.NewReader("id,nickname\n1,JJ\n"), FormatCSV)
+		assert.ErrorContains(t, err, "nickname")
+	})
+}
+
+func TestLoadSeedFile(t *testing.T) {
+	content := `{"id": 1, "fname": "John", "city": "New York", "phone": 1234567890, "height": 180.5, "married": true}
+{"id": 2, "fname": "Jane", "city": "", "phone": 9876543210, "height": 165.2}
+{"id": 1, "fname": "Johnny", "city": "Boston", "phone": 5555555555, "height": 170}
+{"id": 3, "fname": "Bob", "city": "Chicago", "phone": 5555555555, "height": 175.0, "married": true}
+`
+
+	t.Run("Lenient mode skips rejected rows", func(t *testing.T) {
+		repo := user.NewRepository(user.UserDB{})
+		report, err := LoadSeedFile(context.Background(), repo, writeFile(t, "users.jsonl", content), SeedLenient)
+		require.NoError(t, err)
+		assert.Equal(t, 2, report.Loaded)
+		require.Len(t, report.Rejected, 2)
+		assert.Equal(t, 2, report.Rejected[0].Row)
+		assert.ErrorIs(t, report.Rejected[0].Err, utility.ErrInvalidCityInput)
+		assert.Equal(t, 3, report.Rejected[1].Row)
+		assert.ErrorIs(t, report.Rejected[1].Err, utility.ErrUserIdAlreadyExists)
+
+		users := listUsers(t, repo)
+		assert.Len(t, users, 2)
+		assert.Equal(t, "John", users[0].FName)
+		assert.Equal(t, "Bob", users[1].FName)
+	})
+
+	t.Run("Strict mode aborts without loading", func(t *testing.T) {
+		repo := user.NewRepository(user.UserDB{})
+		report, err := LoadSeedFile(context.Background(), repo, writeFile(t, "users.jsonl", content), SeedStrict)
+		assert.ErrorIs(t, err, utility.ErrInvalidCityInput)
+		assert.Len(t, report.Rejected, 2)
+		assert.Equal(t, 0, report.Loaded)
+		assert.Empty(t, listUsers(t, repo))
+	})
+
+	t.Run("Rows already in the repository are rejected", func(t *testing.T) {
+		repo := user.NewRepository(user.UserDB{
+			3: {ID: 3, FName: "Bob", Address: user.Address{City: "Chicago"}, Phone: 5555555555, Height: 175.0, Married: true},
+		})
+		report, err := LoadSeedFile(context.Background(), repo, writeFile(t, "users.csv",
+			"id,fname,city,phone,height,married\n3,Bob,Chicago,5555555555,175,true\n"), SeedLenient)
+		require.NoError(t, err)
+		assert.Equal(t, 0, report.Loaded)
+		require.Len(t, report.Rejected, 1)
+		assert.ErrorIs(t, report.Rejected[0].Err, utility.ErrUserIdAlreadyExists)
+	})
+
+	t.Run("Unknown extension", func(t *testing.T) {
+		_, err := LoadSeedFile(context.Background(), user.NewRepository(user.UserDB{}), writeFile(t, "users.xml", ""), SeedLenient)
+		assert.Error(t, err)
+	})
+}
+
+func TestLoadSeedFile_Emails(t *testing.T) {
+	repo := user.NewRepository(user.UserDB{
+		1: {ID: 1, FName: "John", Email: "john@example.com", Address: user.Address{City: "New York"}, Phone: 1234567890, Height: 180.5},
+	})
+	report, err := LoadSeedFile(context.Background(), repo, writeFile(t, "users.jsonl",
+		`{"id": 2, "fname": "Jane", "email": "JOHN@example.com", "address": {"city": "Los Angeles"}, "phone": 9876543210, "height": 165.2}
+{"id": 3, "fname": "Bob", "email": "bob@example.com", "address": {"city": "Chicago"}, "phone": 5555555555, "height": 175}
+{"id": 4, "fname": "Bobby", "email": "Bob@Example.com", "address": {"city": "Chicago"}, "phone": 5555555556, "height": 170}
+{"id": 5, "fname": "Eve", "email": "not an email", "address": {"city": "Chicago"}, "phone": 5555555557, "height": 160}
+{"id": 6, "fname": "Old", "date_of_birth": "1 May 1980", "address": {"city": "Chicago"}, "phone": 5555555558, "height": 160}
+`), SeedLenient)
+	require.NoError(t, err)
+	assert.Equal(t, 1, report.Loaded)
+	require.Len(t, report.Rejected, 4)
+	assert.ErrorIs(t, report.Rejected[0].Err, utility.ErrEmailAlreadyExists)
+	assert.ErrorIs(t, report.Rejected[1].Err, utility.ErrEmailAlreadyExists)
+	assert.ErrorIs(t, report.Rejected[2].Err, utility.ErrInvalidEmailInput)
+	assert.ErrorIs(t, report.Rejected[3].Err, utility.ErrInvalidDateOfBirthInput)
+
+	bob, err := repo.GetUserById(context.Background(), 3)
+	require.NoError(t, err)
+	assert.False(t, bob.CreateTime.IsZero())
+	assert.Equal(t, bob.CreateTime, bob.UpdateTime)
+}
+
+func TestWriterRoundTrip(t *testing.T) {
+	users := []user.User{
+		{ID: 1, FName: "John", Address: user.Address{City: "New York"}, Phone: 1234567890, Height: 180.5, Married: true},
+		{
+			ID: 2, FName: "Jane, Jr.", LName: "Doe", Email: "jane@example.com", DateOfBirth: "1990-04-01",
+			Address: user.Address{Street: "1 Main St", City: "Los Angeles", State: "CA", PostalCode: "90001", Country: "US"},
+			Phone:   9876543210, Height: 165.2, Married: false,
+			CreateTime: time.Date(2024, 6, 1, 12, 0, 0, 500, time.UTC),
+			UpdateTime: time.Date(2024, 6, 2, 8, 30, 0, 0, time.UTC),
+		},
+	}
+
+	for _, format := range []Format{FormatJSON, FormatJSONL, FormatCSV, FormatProto} {
+		t.Run(string(format), func(t *testing.T) {
+			var buf bytes.Buffer
+			writer, err := NewWriter(&buf, format)
+			require.NoError(t, err)
+			for _, u := range users {
+				require.NoError(t, writer.Write(u))
+			}
+			require.NoError(t, writer.Close())
+
+			records, err := ReadUsers(&buf, format)
+			require.NoError(t, err)
+			require.Len(t, records, 2)
+			for i, record := range records {
+				assert.NoError(t, record.Err)
+				assert.Equal(t, users[i], record.User)
+			}
+		})
+	}
+
+	t.Run("empty JSON", func(t *testing.T) {
+		var buf bytes.Buffer
+		writer, err := NewWriter(&buf, FormatJSON)
+		require.NoError(t, err)
+		require.NoError(t, writer.Close())
+		records, err := ReadUsers(&buf, FormatJSON)
+		require.NoError(t, err)
+		assert.Empty(t, records)
+	})
+}
+
+func TestImport(t *testing.T) {
+	existing := user.User{ID: 1, FName: "John", Address: user.Address{City: "New York"}, Phone: 1234567890, Height: 180.5, Married: true}
+	updated := user.User{ID: 1, FName: "John", Address: user.Address{City: "Boston"}, Phone: 1234567890, Height: 180.5, Married: true, Revision: 7}
+	added := user.User{ID: 2, FName: "Jane", Address: user.Address{City: "Los Angeles"}, Phone: 9876543210, Height: 165.2, Married: false}
+	records := []Record{{Row: 1, User: updated}, {Row: 2, User: added}}
+
+	newRepo := func() user.Repository {
+		return user.NewRepository(user.UserDB{1: existing})
+	}
+
+	t.Run("Upsert", func(t *testing.T) {
+		repo := newRepo()
+		report, err := Import(context.Background(), repo, records, ImportOptions{Conflict: ConflictUpsert})
+		require.NoError(t, err)
+		assert.Equal(t, ImportReport{Created: 1, Updated: 1}, report)
+		updated := updated
+		updated.Revision = 2
+		assert.Equal(t, []user.User{updated, added}, listUsers(t, repo))
+	})
+
+	t.Run("Skip", func(t *testing.T) {
+		repo := newRepo()
+		report, err := Import(context.Background(), repo, records, ImportOptions{Conflict: ConflictSkip})
+		require.NoError(t, err)
+		assert.Equal(t, ImportReport{Created: 1, Skipped: 1}, report)
+		assert.Equal(t, []user.User{existing, added}, listUsers(t, repo))
+	})
+
+	t.Run("Fail writes nothing", func(t *testing.T) {
+		repo := newRepo()
+		report, err := Import(context.Background(), repo, records, ImportOptions{Conflict: ConflictFail})
+		assert.Error(t, err)
+		require.Len(t, report.Rejected, 1)
+		assert.ErrorIs(t, report.Rejected[0].Err, utility.ErrUserIdAlreadyExists)
+		assert.Equal(t, []user.User{existing}, listUsers(t, repo))
+	})
+
+	t.Run("Dry run writes nothing", func(t *testing.T) {
+		repo := newRepo()
+		report, err := Import(context.Background(), repo, records, ImportOptions{Conflict: ConflictUpsert, DryRun: true})
+		require.NoError(t, err)
+		assert.Equal(t, ImportReport{Created: 1, Updated: 1}, report)
+		assert.Equal(t, []user.User{existing}, listUsers(t, repo))
+	})
+
+	t.Run("Invalid record writes nothing", func(t *testing.T) {
+		repo := newRepo()
+		report, err := Import(context.Background(), repo, append(records, Record{Row: 3, User: user.User{ID: 3}}), ImportOptions{Conflict: ConflictUpsert})
+		assert.Error(t, err)
+		require.Len(t, report.Rejected, 1)
+		assert.Equal(t, 3, report.Rejected[0].Row)
+		assert.Equal(t, []user.User{existing}, listUsers(t, repo))
+	})
+}
@@ -0,0 +1,390 @@
+package db
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	pbv1 "github.com/kunal768/go-grpc-tc/proto/users/v1"
+	"github.com/kunal768/go-grpc-tc/user"
+	"google.golang.org/protobuf/encoding/protodelim"
+)
+
+type Format string
+
+const (
+	FormatJSON  Format = "json"
+	FormatJSONL Format = "jsonl"
+	FormatCSV   Format = "csv"
+	// FormatProto is a stream of varint length-delimited users.v1 User
+	// messages, the wire format of files written before the proto packages.
+	FormatProto Format = "pb"
+)
+
+// csvHeader is the column order written to CSV files. Reading accepts any
+// subset in any order.
+var csvHeader = []string{
+	"id", "fname", "lname", "email", "date_of_birth",
+	"street", "city", "state", "postal_code", "country",
+	"phone", "height", "married", "uuid", "create_time", "update_time",
+}
+
+func ParseFormat(s string) (Format, error) {
+	switch Format(strings.ToLower(s)) {
+	case FormatJSON:
+		return FormatJSON, nil
+	case FormatJSONL, "ndjson":
+		return FormatJSONL, nil
+	case FormatCSV:
+		return FormatCSV, nil
+	case FormatProto, "binpb", "protobuf":
+		return FormatProto, nil
+	}
+	return "", fmt.Errorf("unknown format %q", s)
+}
+
+// FormatFromPath picks the format from the file extension.
+func FormatFromPath(path string) (Format, error) {
+	return ParseFormat(strings.TrimPrefix(filepath.Ext(path), "."))
+}
+
+// Record is one user read from a file. Row is the 1-based position of the
+// record: the array index for JSON, the line for JSONL and the data row
+// (excluding the header) for CSV. Err is set when the record could not be
+// decoded, User is then incomplete.
+type Record struct {
+	Row  int
+	User user.User
+	Err  error
+	// Unknown lists the fields of a JSON record that were ignored, e.g.
+	// "nickname" or "address.county".
+	Unknown []string
+}
+
+// ReadUsers decodes every record of r. Malformed records are returned with
+// Err set, only a file that cannot be read at all is an error.
+func ReadUsers(r io.Reader, format Format) ([]Record, error) {
+	switch format {
+	case FormatJSON:
+		return readJSON(r)
+	case FormatJSONL:
+		return readJSONL(r)
+	case FormatCSV:
+		return readCSV(r)
+	case FormatProto:
+		return readProto(r)
+	}
+	return nil, fmt.Errorf("unknown format %q", format)
+}
+
+// decodeUser decodes one JSON user. Unknown fields are ignored and returned,
+// so files written by other tools or later versions still load.
+func decodeUser(data []byte) (Record, error) {
+	var u user.User
+	if err := json.Unmarshal(data, &u); err != nil {
+		return Record{User: u}, err
+	}
+	return Record{User: u, Unknown: unknownFields(data)}, nil
+}
+
+// userFields and addressFields are the JSON keys of users and addresses, in
+// lower case as encoding/json matches keys case-insensitively. "city" is the
+// top level city of files written before addresses.
+var (
+	userFields    = jsonFields(reflect.TypeOf(user.User{}), "city")
+	addressFields = jsonFields(reflect.TypeOf(user.Address{}))
+)
+
+func jsonFields(t reflect.Type, extra ...string) map[string]bool {
+	fields := map[string]bool{}
+	for i := 0; i < t.NumField(); i++ {
+		name, _, _ := strings.Cut(t.Field(i).Tag.Get("json"), ",")
+		fields[strings.ToLower(name)] = true
+	}
+	for _, name := range extra {
+		fields[name] = true
+	}
+	return fields
+}
+
+// unknownFields lists the keys of a JSON user that do not map to a field.
+func unknownFields(data []byte) []string {
+	var top map[string]json.RawMessage
+	if json.Unmarshal(data, &top) != nil {
+		return nil
+	}
+	var unknown []string
+	for key, value := range top {
+		switch lower := strings.ToLower(key); {
+		case !userFields[lower]:
+			unknown = append(unknown, key)
+		case lower == "address":
+			var address map[string]json.RawMessage
+			json.Unmarshal(value, &address)
+			for key := range address {
+				if !addressFields[strings.ToLower(key)] {
+					unknown = append(unknown, "address."+key)
+				}
+			}
+		}
+	}
+	sort.Strings(unknown)
+	return unknown
+}
+
+func readJSON(r io.Reader) ([]Record, error) {
+	var raw []json.RawMessage
+	if err := json.NewDecoder(r).Decode(&raw); err != nil {
+		return nil, err
+	}
+
+	records := make([]Record, 0, len(raw))
+	for i, data := range raw {
+		record, err := decodeUser(data)
+		record.Row, record.Err = i+1, err
+		records = append(records, record)
+	}
+	return records, nil
+}
+
+func readJSONL(r io.Reader) ([]Record, error) {
+	var records []Record
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+
+	line := 0
+	for scanner.Scan() {
+		line++
+		data := bytes.TrimSpace(scanner.Bytes())
+		if len(data) == 0 {
+			continue
+		}
+		record, err := decodeUser(data)
+		record.Row, record.Err = line, err
+		records = append(records, record)
+	}
+	return records, scanner.Err()
+}
+
+func readCSV(r io.Reader) ([]Record, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+
+	header, err := reader.Read()
+	if err != nil {
+		return nil, fmt.Errorf("reading CSV header: %w", err)
+	}
+	columns := map[string]int{}
+	for i, name := range header {
+		name = strings.ToLower(strings.TrimSpace(name))
+		if !slices.Contains(csvHeader, name) {
+			return nil, fmt.Errorf("unknown CSV column %q", name)
+		}
+		columns[name] = i
+	}
+
+	var records []Record
+	for row := 1; ; row++ {
+		fields, err := reader.Read()
+		if err == io.EOF {
+			return records, nil
+		}
+		if err != nil {
+			if _, ok := err.(*csv.ParseError); !ok {
+				return nil, err
+			}
+			records = append(records, Record{Row: row, Err: err})
+			continue
+		}
+		if len(fields) != len(header) {
+			records = append(records, Record{Row: row, Err: fmt.Errorf("expected %d fields, got %d", len(header), len(fields))})
+			continue
+		}
+		u, err := csvUser(fields, columns)
+		records = append(records, Record{Row: row, User: u, Err: err})
+	}
+}
+
+func readProto(r io.Reader) ([]Record, error) {
+	var records []Record
+	reader := bufio.NewReader(r)
+	for row := 1; ; row++ {
+		var msg pbv1.User
+		err := protodelim.UnmarshalFrom(reader, &msg)
+		if err == io.EOF {
+			return records, nil
+		}
+		if err != nil {
+			// the stream can't be resynchronised after a bad length prefix
+			return nil, fmt.Errorf("message %d: %w", row, err)
+		}
+		records = append(records, Record{Row: row, User: user.FromProto(user.FromV1(&msg))})
+	}
+}
+
+func csvUser(fields []string, columns map[string]int) (user.User, error) {
+	var u user.User
+	field := func(name string) (string, bool) {
+		i, ok := columns[name]
+		if !ok || fields[i] == "" {
+			return "", false
+		}
+		return fields[i], true
+	}
+
+	if v, ok := field("id"); ok {
+		id, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			return u, fmt.Errorf("id: %w", err)
+		}
+		u.ID = user.UserId(id)
+	}
+	u.FName, _ = field("fname")
+	u.LName, _ = field("lname")
+	u.Email, _ = field("email")
+	u.DateOfBirth, _ = field("date_of_birth")
+	u.Address.Street, _ = field("street")
+	u.Address.City, _ = field("city")
+	u.Address.State, _ = field("state")
+	u.Address.PostalCode, _ = field("postal_code")
+	u.Address.Country, _ = field("country")
+	if v, ok := field("phone"); ok {
+		phone, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			return u, fmt.Errorf("phone: %w", err)
+		}
+		u.Phone = phone
+	}
+	if v, ok := field("height"); ok {
+		height, err := strconv.ParseFloat(v, 64)
+		if err != nil {
+			return u, fmt.Errorf("height: %w", err)
+		}
+		u.Height = height
+	}
+	if v, ok := field("married"); ok {
+		married, err := strconv.ParseBool(v)
+		if err != nil {
+			return u, fmt.Errorf("married: %w", err)
+		}
+		u.Married = married
+	}
+	u.UUID, _ = field("uuid")
+	for name, t := range map[string]*time.Time{"create_time": &u.CreateTime, "update_time": &u.UpdateTime} {
+		if v, ok := field(name); ok {
+			parsed, err := time.Parse(time.RFC3339Nano, v)
+			if err != nil {
+				return u, fmt.Errorf("%s: %w", name, err)
+			}
+			*t = parsed
+		}
+	}
+	return u, nil
+}
+
+// csvTime formats t for CSV, empty for the zero time.
+func csvTime(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	return t.Format(time.RFC3339Nano)
+}
+
+// Writer encodes users one at a time in one of the file formats.
+type Writer struct {
+	format Format
+	w      *bufio.Writer
+	csv    *csv.Writer
+	count  int
+}
+
+func NewWriter(w io.Writer, format Format) (*Writer, error) {
+	writer := &Writer{format: format, w: bufio.NewWriter(w)}
+	switch format {
+	case FormatJSON, FormatJSONL, FormatProto:
+	case FormatCSV:
+		writer.csv = csv.NewWriter(writer.w)
+		if err := writer.csv.Write(csvHeader); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("unknown format %q", format)
+	}
+	return writer, nil
+}
+
+func (w *Writer) Write(u user.User) error {
+	w.count++
+	switch w.format {
+	case FormatJSON:
+		data, err := json.Marshal(u)
+		if err != nil {
+			return err
+		}
+		if w.count == 1 {
+			w.w.WriteString("[\n  ")
+		} else {
+			w.w.WriteString(",\n  ")
+		}
+		_, err = w.w.Write(data)
+		return err
+	case FormatJSONL:
+		data, err := json.Marshal(u)
+		if err != nil {
+			return err
+		}
+		w.w.Write(data)
+		return w.w.WriteByte('\n')
+	case FormatCSV:
+		return w.csv.Write([]string{
+			strconv.FormatInt(int64(u.ID), 10),
+			u.FName,
+			u.LName,
+			u.Email,
+			u.DateOfBirth,
+			u.Address.Street,
+			u.Address.City,
+			u.Address.State,
+			u.Address.PostalCode,
+			u.Address.Country,
+			strconv.FormatInt(u.Phone, 10),
+			strconv.FormatFloat(u.Height, 'f', -1, 64),
+			strconv.FormatBool(u.Married),
+			u.UUID,
+			csvTime(u.CreateTime),
+			csvTime(u.UpdateTime),
+		})
+	default:
+		_, err := protodelim.MarshalTo(w.w, user.ToV1(user.ToProto(u)))
+		return err
+	}
+}
+
+// Close terminates the encoding and flushes buffered output. It does not
+// close the underlying io.Writer.
+func (w *Writer) Close() error {
+	switch w.format {
+	case FormatJSON:
+		if w.count == 0 {
+			w.w.WriteString("[")
+		}
+		w.w.WriteString("\n]\n")
+	case FormatCSV:
+		w.csv.Flush()
+		if err := w.csv.Error(); err != nil {
+			return err
+		}
+	}
+	return w.w.Flush()
+}
@@ -0,0 +1,137 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/kunal768/go-grpc-tc/user"
+	"github.com/kunal768/go-grpc-tc/utility"
+)
+
+// ConflictPolicy decides what Import does with a record whose ID already
+// exists in the target.
+type ConflictPolicy string
+
+const (
+	ConflictUpsert ConflictPolicy = "upsert"
+	ConflictSkip   ConflictPolicy = "skip"
+	ConflictFail   ConflictPolicy = "fail"
+)
+
+func ParseConflictPolicy(s string) (ConflictPolicy, error) {
+	switch policy := ConflictPolicy(s); policy {
+	case ConflictUpsert, ConflictSkip, ConflictFail:
+		return policy, nil
+	}
+	return "", fmt.Errorf("unknown conflict policy %q, must be upsert, skip or fail", s)
+}
+
+// ImportTarget is where Import writes users, a user.Repository or a client
+// of a running server.
+type ImportTarget interface {
+	GetUserById(ctx context.Context, Id user.UserId) (user.User, error)
+	AddUser(ctx context.Context, user user.User) (user.User, error)
+	UpdateUser(ctx context.Context, user user.User) (user.User, error)
+}
+
+type ImportOptions struct {
+	Conflict ConflictPolicy
+	// DryRun validates and plans the import without writing anything.
+	DryRun bool
+}
+
+type ImportReport struct {
+	Created  int
+	Updated  int
+	Skipped  int
+	Rejected []Rejection
+	// Warnings are records imported despite a problem, such as unknown
+	// fields.
+	Warnings []Rejection
+}
+
+type importAction int
+
+const (
+	actionCreate importAction = iota
+	actionUpdate
+	actionSkip
+)
+
+// Import writes records to target. Every record is validated and checked for
+// conflicts first; if any record is rejected nothing is written. With
+// DryRun the report shows what would have happened.
+func Import(ctx context.Context, target ImportTarget, records []Record, opts ImportOptions) (ImportReport, error) {
+	var report ImportReport
+	actions := make([]importAction, len(records))
+	seen := map[user.UserId]bool{}
+	emails := map[string]bool{}
+
+	for i, record := range records {
+		err := record.Err
+		if err == nil {
+			err = user.ValidateUser(record.User)
+		}
+		if err == nil && seen[record.User.ID] {
+			err = fmt.Errorf("duplicate ID in input: %w", utility.ErrUserIdAlreadyExists)
+		}
+		email := user.NormalizeEmail(record.User.Email)
+		if err == nil && email != "" && emails[email] {
+			err = fmt.Errorf("duplicate email in input: %w", utility.ErrEmailAlreadyExists)
+		}
+		if err != nil {
+			report.Rejected = append(report.Rejected, Rejection{Row: record.Row, ID: record.User.ID, Err: err})
+			continue
+		}
+		seen[record.User.ID] = true
+		if email != "" {
+			emails[email] = true
+		}
+		if w, ok := warning(record); ok {
+			report.Warnings = append(report.Warnings, w)
+		}
+
+		_, err = target.GetUserById(ctx, record.User.ID)
+		switch {
+		case errors.Is(err, utility.ErrUserNotFound):
+			actions[i] = actionCreate
+			report.Created++
+		case err != nil:
+			return report, fmt.Errorf("row %d: looking up user %d: %w", record.Row, record.User.ID, err)
+		case opts.Conflict == ConflictUpsert:
+			actions[i] = actionUpdate
+			report.Updated++
+		case opts.Conflict == ConflictSkip:
+			actions[i] = actionSkip
+			report.Skipped++
+		default:
+			report.Rejected = append(report.Rejected, Rejection{Row: record.Row, ID: record.User.ID, Err: utility.ErrUserIdAlreadyExists})
+		}
+	}
+
+	if len(report.Rejected) > 0 {
+		return report, fmt.Errorf("%d records rejected, nothing imported: %w", len(report.Rejected), SeedReport{Rejected: report.Rejected}.Err())
+	}
+	if opts.DryRun {
+		return report, nil
+	}
+
+	for i, record := range records {
+		var err error
+		switch actions[i] {
+		case actionCreate:
+			_, err = target.AddUser(ctx, record.User)
+		case actionUpdate:
+			// upserts overwrite the user whatever its revision, the one
+			// in the file is likely stale
+			u := record.User
+			u.Revision = 0
+			_, err = target.UpdateUser(ctx, u)
+		}
+		if err != nil {
+			return report, fmt.Errorf("row %d: importing user %d: %w", record.Row, record.User.ID, err)
+		}
+	}
+	return report, nil
+}
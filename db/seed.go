@@ -0,0 +1,157 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/kunal768/go-grpc-tc/user"
+	"github.com/kunal768/go-grpc-tc/utility"
+)
+
+type SeedMode string
+
+const (
+	// SeedStrict loads nothing if any row is rejected.
+	SeedStrict SeedMode = "strict"
+	// SeedLenient skips rejected rows and loads the rest.
+	SeedLenient SeedMode = "lenient"
+)
+
+type Rejection struct {
+	Row int
+	ID  user.UserId
+	Err error
+}
+
+func (r Rejection) Error() string {
+	if r.ID == 0 {
+		return fmt.Sprintf("row %d: %v", r.Row, r.Err)
+	}
+	return fmt.Sprintf("row %d (id %d): %v", r.Row, r.ID, r.Err)
+}
+
+func (r Rejection) Unwrap() error {
+	return r.Err
+}
+
+type SeedReport struct {
+	Loaded   int
+	Rejected []Rejection
+	// Warnings are rows loaded despite a problem, such as unknown fields.
+	Warnings []Rejection
+}
+
+// warning is the problem a record was loaded despite, false for none.
+func warning(record Record) (Rejection, bool) {
+	if len(record.Unknown) == 0 {
+		return Rejection{}, false
+	}
+	return Rejection{Row: record.Row, ID: record.User.ID, Err: fmt.Errorf("ignored unknown fields %s", strings.Join(record.Unknown, ", "))}, true
+}
+
+// LoadSeedFile adds the users in the JSON, JSONL or CSV file at path to repo.
+// Every row is checked with user.ValidateUser and against IDs and emails
+// already in the file or the repository. Rows without timestamps are stamped
+// with the load time. In strict mode any rejected row aborts the load
+// before anything is written.
+func LoadSeedFile(ctx context.Context, repo user.Repository, path string, mode SeedMode) (SeedReport, error) {
+	format, err := FormatFromPath(path)
+	if err != nil {
+		return SeedReport{}, err
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return SeedReport{}, err
+	}
+	defer f.Close()
+
+	records, err := ReadUsers(f, format)
+	if err != nil {
+		return SeedReport{}, fmt.Errorf("%s: %w", path, err)
+	}
+
+	var report SeedReport
+	var valid []Record
+	seen := map[user.UserId]bool{}
+	emails := map[string]bool{}
+	for _, record := range records {
+		if err := ctx.Err(); err != nil {
+			return report, err
+		}
+		err := record.Err
+		if err == nil {
+			err = user.ValidateUser(record.User)
+		}
+		if err == nil && seen[record.User.ID] {
+			err = utility.ErrUserIdAlreadyExists
+		}
+		if err == nil {
+			if _, getErr := repo.GetUserById(ctx, record.User.ID); getErr == nil {
+				err = utility.ErrUserIdAlreadyExists
+			}
+		}
+		email := user.NormalizeEmail(record.User.Email)
+		if err == nil && email != "" {
+			if emails[email] {
+				err = utility.ErrEmailAlreadyExists
+			} else if taken, searchErr := repo.SearchUsers(ctx, user.UsersSearchRequest{Email: email}); searchErr == nil && len(taken) > 0 {
+				err = utility.ErrEmailAlreadyExists
+			}
+		}
+
+		if err != nil {
+			report.Rejected = append(report.Rejected, Rejection{Row: record.Row, ID: record.User.ID, Err: err})
+			continue
+		}
+		seen[record.User.ID] = true
+		if email != "" {
+			emails[email] = true
+		}
+		if w, ok := warning(record); ok {
+			report.Warnings = append(report.Warnings, w)
+		}
+		valid = append(valid, record)
+	}
+
+	if mode == SeedStrict && len(report.Rejected) > 0 {
+		return report, fmt.Errorf("%s: %d rows rejected in strict mode: %w", path, len(report.Rejected), report.Err())
+	}
+
+	now := time.Now()
+	for _, record := range valid {
+		if _, err := repo.AddUser(ctx, stampTimes(record.User, now)); err != nil {
+			if mode == SeedStrict || ctx.Err() != nil {
+				return report, fmt.Errorf("%s: row %d: %w", path, record.Row, err)
+			}
+			report.Rejected = append(report.Rejected, Rejection{Row: record.Row, ID: record.User.ID, Err: err})
+			continue
+		}
+		report.Loaded++
+	}
+	return report, nil
+}
+
+// Err joins the rejections into one error, nil if every row was loaded.
+func (r SeedReport) Err() error {
+	errs := make([]error, 0, len(r.Rejected))
+	for _, rejection := range r.Rejected {
+		errs = append(errs, rejection)
+	}
+	return errors.Join(errs...)
+}
+
+// stampTimes sets the create and update times the file left out to now.
+func stampTimes(u user.User, now time.Time) user.User {
+	if u.CreateTime.IsZero() {
+		u.CreateTime = now.UTC()
+	}
+	if u.UpdateTime.IsZero() {
+		u.UpdateTime = u.CreateTime
+	}
+	return u
+}
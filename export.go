@@ -0,0 +1,204 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/kunal768/go-grpc-tc/auth"
+	"github.com/kunal768/go-grpc-tc/config"
+	"github.com/kunal768/go-grpc-tc/db"
+	pb "github.com/kunal768/go-grpc-tc/proto/users/v2"
+	"github.com/kunal768/go-grpc-tc/tenant"
+	"github.com/kunal768/go-grpc-tc/user"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+)
+
+// runExport writes every user, read from a running server with -server or
+// else from the configured storage backend, to -out.
+func runExport(args []string) error {
+	fs := flag.NewFlagSet("export", flag.ContinueOnError)
+	out := fs.String("out", "", "output file, stdout if empty")
+	formatName := fs.String("format", "", "jsonl, csv, json or pb (length-delimited protobuf), defaults to the -out extension")
+	serverAddr := fs.String("server", "", "export from the server at this address instead of the storage backend")
+	serverCA := fs.String("server-ca", "", "PEM CA bundle to verify the server with, plaintext if empty")
+	clientCert := fs.String("client-cert", "", "PEM client certificate for servers requiring mutual TLS")
+	clientKey := fs.String("client-key", "", "PEM private key of -client-cert")
+	pageSize := fs.Int("page-size", 500, "users per ListUsers call when exporting from a server")
+	tenantName := fs.String("tenant", "", "tenant to export, for servers and storage with tenancy enabled")
+
+	cfg, _, err := config.Load(fs, args, os.LookupEnv)
+	if err != nil {
+		return err
+	}
+
+	format, err := fileFormat(*formatName, *out, db.FormatJSONL)
+	if err != nil {
+		return err
+	}
+	storage, err := tenantStorage(cfg.Storage, *tenantName)
+	if err != nil {
+		return err
+	}
+
+	ctx := context.Background()
+	var users []user.User
+	if *serverAddr != "" {
+		conn, err := dialServer(*serverAddr, *serverCA, *clientCert, *clientKey, *tenantName)
+		if err != nil {
+			return err
+		}
+		defer conn.Close()
+		users, err = listAllUsers(ctx, pb.NewUserServiceClient(conn), *pageSize)
+		if err != nil {
+			return err
+		}
+	} else {
+		repo, err := openStorage(storage, user.RepositoryOptions{Outbox: cfg.CDC.Enabled})
+		if err != nil {
+			return err
+		}
+		users, err = repo.ListUsers(ctx, 0, 0)
+		if closeErr := repo.Close(); err == nil {
+			err = closeErr
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	var w io.Writer = os.Stdout
+	if *out != "" {
+		f, err := os.Create(*out)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		w = f
+	}
+
+	writer, err := db.NewWriter(w, format)
+	if err != nil {
+		return err
+	}
+	for _, u := range users {
+		if err := writer.Write(u); err != nil {
+			return err
+		}
+	}
+	if err := writer.Close(); err != nil {
+		return err
+	}
+	if f, ok := w.(*os.File); ok && f != os.Stdout {
+		return f.Close()
+	}
+	return nil
+}
+
+// fileFormat resolves -format, falling back to the extension of path and
+// then to def.
+func fileFormat(name, path string, def db.Format) (db.Format, error) {
+	if name != "" {
+		return db.ParseFormat(name)
+	}
+	if path == "" {
+		return def, nil
+	}
+	return db.FormatFromPath(path)
+}
+
+// openStorage opens the configured backend directly. Only the file backend
+// holds data outside of a running server. Imports keep the outbox, so their
+// writes are published by the next server too.
+func openStorage(cfg config.StorageConfig, opts user.RepositoryOptions) (user.Repository, error) {
+	if cfg.Backend != config.BackendFile {
+		return nil, errors.New("the memory backend only exists inside a running server, use -server or storage.backend=file")
+	}
+	return user.NewFileRepositoryWithOptions(cfg.Path, cfg.FlushInterval, opts)
+}
+
+// tenantStorage is the storage of the tenant name, or storage itself when
+// name is empty.
+func tenantStorage(storage config.StorageConfig, name string) (config.StorageConfig, error) {
+	if name == "" {
+		return storage, nil
+	}
+	if !tenant.ValidName(name) {
+		return config.StorageConfig{}, fmt.Errorf("invalid tenant name %q", name)
+	}
+	return storage.ForTenant(name), nil
+}
+
+// apiKeyEnv holds the API key sent to a server with authentication enabled.
+const apiKeyEnv = "USERSVC_API_KEY"
+
+// dialServer connects to addr, sending the API key from the environment and
+// tenantName, if set, with every call.
+func dialServer(addr, caFile, certFile, keyFile, tenantName string) (*grpc.ClientConn, error) {
+	creds := insecure.NewCredentials()
+	if caFile != "" {
+		pem, err := os.ReadFile(caFile)
+		if err != nil {
+			return nil, err
+		}
+		roots := x509.NewCertPool()
+		if !roots.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("%s: no PEM certificates", caFile)
+		}
+		tlsConfig := &tls.Config{RootCAs: roots, MinVersion: tls.VersionTLS12}
+		if certFile != "" {
+			cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+			if err != nil {
+				return nil, err
+			}
+			tlsConfig.Certificates = []tls.Certificate{cert}
+		}
+		creds = credentials.NewTLS(tlsConfig)
+	} else if certFile != "" {
+		return nil, errors.New("-client-cert requires -server-ca")
+	}
+	opts := []grpc.DialOption{grpc.WithTransportCredentials(creds)}
+	var md []string
+	if key := os.Getenv(apiKeyEnv); key != "" {
+		md = append(md, auth.APIKeyHeader, key)
+	}
+	if tenantName != "" {
+		md = append(md, tenant.Header, tenantName)
+	}
+	if len(md) > 0 {
+		opts = append(opts, grpc.WithUnaryInterceptor(func(ctx context.Context, method string, req, reply any, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+			ctx = metadata.AppendToOutgoingContext(ctx, md...)
+			return invoker(ctx, method, req, reply, cc, opts...)
+		}))
+	}
+	return grpc.NewClient(addr, opts...)
+}
+
+// listAllUsers pages through ListUsers. A page past the end returns every
+// user, so paging also stops once IDs stop increasing.
+func listAllUsers(ctx context.Context, client pb.UserServiceClient, pageSize int) ([]user.User, error) {
+	var users []user.User
+	for page := 0; ; page++ {
+		resp, err := client.ListUsers(ctx, &pb.ListUsersRequest{Page: int32(page), PageSize: int32(pageSize)})
+		if err != nil {
+			return nil, err
+		}
+		if len(resp.Users) == 0 || (len(users) > 0 && user.UserId(resp.Users[0].Id) <= users[len(users)-1].ID) {
+			return users, nil
+		}
+		for _, u := range resp.Users {
+			users = append(users, user.FromProto(u))
+		}
+		if len(resp.Users) < pageSize {
+			return users, nil
+		}
+	}
+}
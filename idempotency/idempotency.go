@@ -0,0 +1,234 @@
+package idempotency
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/kunal768/go-grpc-tc/auth"
+	"github.com/kunal768/go-grpc-tc/tenant"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+)
+
+const (
+	// Header is the request metadata carrying the idempotency key.
+	Header = "idempotency-key"
+	// ReplayedHeader is set on responses replayed from an earlier call.
+	ReplayedHeader = "idempotent-replayed"
+	// MaxKeyLength bounds the keys clients may send.
+	MaxKeyLength = 255
+)
+
+type Options struct {
+	// TTL is how long outcomes are kept for replay.
+	TTL time.Duration
+	// Methods are full method names, or prefixes ending in "*", whose
+	// outcomes are stored. Other calls ignore the key.
+	Methods []string
+	// MaxEntries bounds the stored and pending keys, calls with a new key
+	// fail with ResourceExhausted while the store is full. 0 is unbounded.
+	MaxEntries int
+	// Now is the clock, time.Now if nil.
+	Now func() time.Time
+}
+
+// Store remembers the outcome of calls made with an idempotency key, so a
+// retried call gets the original response instead of running again. Keys are
+// scoped to the method, the tenant and the authenticated principal.
+type Store struct {
+	opts Options
+
+	mu        sync.Mutex
+	entries   map[entryKey]*entry
+	lastSweep time.Time
+}
+
+type entryKey struct {
+	tenant, client, method, key string
+}
+
+type entry struct {
+	digest  [sha256.Size]byte
+	done    chan struct{}
+	resp    any
+	err     error
+	expires time.Time
+}
+
+func New(opts Options) *Store {
+	if opts.Now == nil {
+		opts.Now = time.Now
+	}
+	return &Store{opts: opts, entries: map[entryKey]*entry{}}
+}
+
+func (s *Store) applies(method string) bool {
+	for _, pattern := range s.opts.Methods {
+		if prefix, ok := strings.CutSuffix(pattern, "*"); ok {
+			if strings.HasPrefix(method, prefix) {
+				return true
+			}
+		} else if method == pattern {
+			return true
+		}
+	}
+	return false
+}
+
+// client scopes keys to the principal. Anonymous callers share one scope, the
+// peer address of a retry can differ from the first attempt.
+func client(ctx context.Context) string {
+	if p, ok := auth.FromContext(ctx); ok {
+		return p.Subject
+	}
+	return ""
+}
+
+// retryable reports whether a failed call may succeed when run again, such
+// outcomes are not stored.
+func retryable(err error) bool {
+	switch status.Code(err) {
+	case codes.Canceled, codes.DeadlineExceeded, codes.Unavailable, codes.ResourceExhausted, codes.Aborted, codes.Internal, codes.Unknown:
+		return true
+	}
+	return false
+}
+
+// claim returns the stored entry for k, or a new pending entry owned by the
+// caller when there is none.
+func (s *Store) claim(k entryKey, digest [sha256.Size]byte) (e *entry, owner bool, err error) {
+	now := s.opts.Now()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.sweep(now, time.Minute)
+
+	if e, ok := s.entries[k]; ok && (e.expires.IsZero() || now.Before(e.expires)) {
+		return e, false, nil
+	}
+	if max := s.opts.MaxEntries; max > 0 && len(s.entries) >= max {
+		if s.sweep(now, time.Second); len(s.entries) >= max {
+			return nil, false, status.Errorf(codes.ResourceExhausted, "idempotency: too many outstanding %s values, retry later", Header)
+		}
+	}
+	e = &entry{digest: digest, done: make(chan struct{})}
+	s.entries[k] = e
+	return e, true, nil
+}
+
+// finish records the outcome of a claimed entry, or forgets it if the call
+// should run again on retry.
+func (s *Store) finish(k entryKey, e *entry, resp any, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if retryable(err) {
+		delete(s.entries, k)
+	} else {
+		if m, ok := resp.(proto.Message); ok && err == nil {
+			resp = proto.Clone(m)
+		}
+		e.resp, e.err = resp, err
+		e.expires = s.opts.Now().Add(s.opts.TTL)
+	}
+	close(e.done)
+}
+
+// sweep forgets expired outcomes, at most once every interval. A full store
+// sweeps more often.
+func (s *Store) sweep(now time.Time, interval time.Duration) {
+	if now.Sub(s.lastSweep) < interval {
+		return
+	}
+	s.lastSweep = now
+	for k, e := range s.entries {
+		if !e.expires.IsZero() && !now.Before(e.expires) {
+			delete(s.entries, k)
+		}
+	}
+}
+
+// Len is the number of stored and pending keys.
+func (s *Store) Len() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.entries)
+}
+
+func digest(req any) ([sha256.Size]byte, error) {
+	m, ok := req.(proto.Message)
+	if !ok {
+		return [sha256.Size]byte{}, status.Error(codes.Internal, "idempotency: request is not a protobuf message")
+	}
+	b, err := proto.MarshalOptions{Deterministic: true}.Marshal(m)
+	if err != nil {
+		return [sha256.Size]byte{}, status.Errorf(codes.Internal, "idempotency: %v", err)
+	}
+	return sha256.Sum256(b), nil
+}
+
+// run calls the handler for a claimed entry. A panic releases the entry
+// before the recovery interceptor sees it, so retries are not stuck waiting.
+func (s *Store) run(ctx context.Context, req any, handler grpc.UnaryHandler, k entryKey, e *entry) (any, error) {
+	defer func() {
+		if r := recover(); r != nil {
+			s.finish(k, e, nil, status.Error(codes.Internal, "panic"))
+			panic(r)
+		}
+	}()
+	resp, err := handler(ctx, req)
+	s.finish(k, e, resp, err)
+	return resp, err
+}
+
+func (s *Store) UnaryInterceptor() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		md, _ := metadata.FromIncomingContext(ctx)
+		keys := md.Get(Header)
+		if len(keys) == 0 || !s.applies(info.FullMethod) {
+			return handler(ctx, req)
+		}
+		key := keys[0]
+		if key == "" || len(key) > MaxKeyLength {
+			return nil, status.Errorf(codes.InvalidArgument, "%s must be 1 to %d characters", Header, MaxKeyLength)
+		}
+		sum, err := digest(req)
+		if err != nil {
+			return nil, err
+		}
+
+		name, _ := tenant.FromContext(ctx)
+		k := entryKey{tenant: name, client: client(ctx), method: info.FullMethod, key: key}
+		for {
+			e, owner, err := s.claim(k, sum)
+			if err != nil {
+				return nil, err
+			}
+			if owner {
+				return s.run(ctx, req, handler, k, e)
+			}
+			if !bytes.Equal(e.digest[:], sum[:]) {
+				return nil, status.Errorf(codes.InvalidArgument, "%s %q was already used with a different request", Header, key)
+			}
+			select {
+			case <-e.done:
+			case <-ctx.Done():
+				return nil, status.FromContextError(ctx.Err()).Err()
+			}
+			if e.expires.IsZero() {
+				// the first call failed and may be run again
+				continue
+			}
+			_ = grpc.SetHeader(ctx, metadata.Pairs(ReplayedHeader, "true"))
+			if m, ok := e.resp.(proto.Message); ok && e.err == nil {
+				return proto.Clone(m), e.err
+			}
+			return e.resp, e.err
+		}
+	}
+}
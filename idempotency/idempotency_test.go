@@ -0,0 +1,153 @@
+package idempotency
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/kunal768/go-grpc-tc/auth"
+	pb "github.com/kunal768/go-grpc-tc/proto/users/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+)
+
+const addUser = "/users.v2.UserService/AddUser"
+
+func withKey(ctx context.Context, key string) context.Context {
+	return metadata.NewIncomingContext(ctx, metadata.Pairs(Header, key))
+}
+
+func TestStore(t *testing.T) {
+	now := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+	newStore := func() *Store {
+		return New(Options{TTL: time.Hour, Methods: []string{"/users.v2.UserService/*"}, Now: func() time.Time { return now }})
+	}
+	john := &pb.AddUserRequest{User: &pb.User{Id: 1, Fname: "John"}}
+
+	var calls int
+	handler := func(err error) grpc.UnaryHandler {
+		return func(ctx context.Context, req any) (any, error) {
+			calls++
+			if err != nil {
+				return nil, err
+			}
+			return &pb.UserResponse{User: req.(*pb.AddUserRequest).User}, nil
+		}
+	}
+	call := func(s *Store, ctx context.Context, req *pb.AddUserRequest, err error) (any, error) {
+		return s.UnaryInterceptor()(ctx, req, &grpc.UnaryServerInfo{FullMethod: addUser}, handler(err))
+	}
+
+	t.Run("Retries are replayed", func(t *testing.T) {
+		s, calls0 := newStore(), calls
+		first, err := call(s, withKey(context.Background(), "k1"), john, nil)
+		require.NoError(t, err)
+		retry, err := call(s, withKey(context.Background(), "k1"), john, status.Error(codes.AlreadyExists, "user ID already exists"))
+		require.NoError(t, err)
+		assert.True(t, proto.Equal(first.(proto.Message), retry.(proto.Message)))
+		assert.Equal(t, 1, calls-calls0)
+
+		_, err = call(s, withKey(context.Background(), "k1"), &pb.AddUserRequest{User: &pb.User{Id: 1, Fname: "Johnny"}}, nil)
+		assert.Equal(t, codes.InvalidArgument, status.Code(err))
+	})
+
+	t.Run("Errors are replayed unless retryable", func(t *testing.T) {
+		s, calls0 := newStore(), calls
+		_, err := call(s, withKey(context.Background(), "k1"), john, status.Error(codes.InvalidArgument, "bad"))
+		assert.Equal(t, codes.InvalidArgument, status.Code(err))
+		_, err = call(s, withKey(context.Background(), "k1"), john, nil)
+		assert.Equal(t, codes.InvalidArgument, status.Code(err))
+
+		_, err = call(s, withKey(context.Background(), "k2"), john, status.Error(codes.Unavailable, "down"))
+		assert.Equal(t, codes.Unavailable, status.Code(err))
+		_, err = call(s, withKey(context.Background(), "k2"), john, nil)
+		assert.NoError(t, err)
+		assert.Equal(t, 3, calls-calls0)
+	})
+
+	t.Run("Keys are scoped and expire", func(t *testing.T) {
+		s, calls0 := newStore(), calls
+		alice := auth.NewContext(withKey(context.Background(), "k1"), auth.Principal{Subject: "alice"})
+		bob := auth.NewContext(withKey(context.Background(), "k1"), auth.Principal{Subject: "bob"})
+		_, err := call(s, alice, john, nil)
+		require.NoError(t, err)
+		_, err = call(s, bob, &pb.AddUserRequest{User: &pb.User{Id: 2, Fname: "Bob"}}, nil)
+		require.NoError(t, err)
+		assert.Equal(t, 2, calls-calls0)
+
+		now = now.Add(2 * time.Hour)
+		_, err = call(s, alice, &pb.AddUserRequest{User: &pb.User{Id: 3, Fname: "Alice"}}, nil)
+		require.NoError(t, err)
+		assert.Equal(t, 3, calls-calls0)
+	})
+
+	t.Run("A full store rejects new keys", func(t *testing.T) {
+		s := New(Options{TTL: time.Hour, Methods: []string{"/users.v2.UserService/*"}, MaxEntries: 2, Now: func() time.Time { return now }})
+		for _, key := range []string{"k1", "k2"} {
+			_, err := call(s, withKey(context.Background(), key), john, nil)
+			require.NoError(t, err)
+		}
+		_, err := call(s, withKey(context.Background(), "k3"), john, nil)
+		assert.Equal(t, codes.ResourceExhausted, status.Code(err))
+		_, err = call(s, withKey(context.Background(), "k1"), john, nil)
+		assert.NoError(t, err, "stored keys are still replayed")
+
+		now = now.Add(2 * time.Hour)
+		_, err = call(s, withKey(context.Background(), "k3"), john, nil)
+		assert.NoError(t, err, "expired outcomes make room")
+		assert.Equal(t, 1, s.Len())
+	})
+
+	t.Run("Calls without a key or to other methods run", func(t *testing.T) {
+		s, calls0 := newStore(), calls
+		_, _ = call(s, context.Background(), john, nil)
+		_, _ = call(s, context.Background(), john, nil)
+		_, err := s.UnaryInterceptor()(withKey(context.Background(), "k1"), john, &grpc.UnaryServerInfo{FullMethod: "/users.v1.UserService/AddUser"}, handler(nil))
+		require.NoError(t, err)
+		assert.Equal(t, 3, calls-calls0)
+		assert.Zero(t, s.Len())
+
+		_, err = call(s, withKey(context.Background(), ""), john, nil)
+		assert.Equal(t, codes.InvalidArgument, status.Code(err))
+	})
+}
+
+func TestStore_ConcurrentRetries(t *testing.T) {
+	s := New(Options{TTL: time.Hour, Methods: []string{addUser}})
+	started, release := make(chan struct{}), make(chan struct{})
+	var calls int
+	handler := func(ctx context.Context, req any) (any, error) {
+		calls++
+		close(started)
+		<-release
+		return &pb.UserResponse{User: &pb.User{Id: 1}}, nil
+	}
+
+	var wg sync.WaitGroup
+	responses := make([]any, 2)
+	for i := range responses {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			if i == 1 {
+				<-started
+			}
+			resp, err := s.UnaryInterceptor()(withKey(context.Background(), "k1"), &pb.AddUserRequest{User: &pb.User{Id: 1}}, &grpc.UnaryServerInfo{FullMethod: addUser}, handler)
+			assert.NoError(t, err)
+			responses[i] = resp
+		}(i)
+	}
+	<-started
+	time.Sleep(10 * time.Millisecond)
+	close(release)
+	wg.Wait()
+
+	assert.Equal(t, 1, calls)
+	assert.True(t, proto.Equal(responses[0].(proto.Message), responses[1].(proto.Message)))
+}
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/kunal768/go-grpc-tc/config"
+	"github.com/kunal768/go-grpc-tc/db"
+	pb "github.com/kunal768/go-grpc-tc/proto/users/v2"
+	"github.com/kunal768/go-grpc-tc/user"
+	"github.com/kunal768/go-grpc-tc/utility"
+)
+
+// runImport reads users from -in and writes them to a running server with
+// -server or else to the configured storage backend.
+func runImport(args []string) error {
+	fs := flag.NewFlagSet("import", flag.ContinueOnError)
+	in := fs.String("in", "", "input file, stdin if empty")
+	formatName := fs.String("format", "", "jsonl, csv, json or pb (length-delimited protobuf), defaults to the -in extension")
+	conflict := fs.String("on-conflict", string(db.ConflictFail), "what to do with users whose ID already exists: upsert, skip or fail")
+	dryRun := fs.Bool("dry-run", false, "validate and report what would be imported without writing")
+	serverAddr := fs.String("server", "", "import into the server at this address instead of the storage backend")
+	serverCA := fs.String("server-ca", "", "PEM CA bundle to verify the server with, plaintext if empty")
+	clientCert := fs.String("client-cert", "", "PEM client certificate for servers requiring mutual TLS")
+	clientKey := fs.String("client-key", "", "PEM private key of -client-cert")
+	tenantName := fs.String("tenant", "", "tenant to import into, for servers and storage with tenancy enabled")
+
+	cfg, _, err := config.Load(fs, args, os.LookupEnv)
+	if err != nil {
+		return err
+	}
+
+	format, err := fileFormat(*formatName, *in, db.FormatJSONL)
+	if err != nil {
+		return err
+	}
+	policy, err := db.ParseConflictPolicy(*conflict)
+	if err != nil {
+		return err
+	}
+	storage, err := tenantStorage(cfg.Storage, *tenantName)
+	if err != nil {
+		return err
+	}
+
+	var r io.Reader = os.Stdin
+	if *in != "" {
+		f, err := os.Open(*in)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		r = f
+	}
+	records, err := db.ReadUsers(r, format)
+	if err != nil {
+		return err
+	}
+
+	var target db.ImportTarget
+	if *serverAddr != "" {
+		conn, err := dialServer(*serverAddr, *serverCA, *clientCert, *clientKey, *tenantName)
+		if err != nil {
+			return err
+		}
+		defer conn.Close()
+		target = grpcTarget{client: pb.NewUserServiceClient(conn)}
+	} else {
+		repo, err := openStorage(storage, user.RepositoryOptions{Outbox: cfg.CDC.Enabled})
+		if err != nil {
+			return err
+		}
+		defer repo.Close()
+		target = repo
+	}
+
+	report, err := db.Import(user.WithActor(context.Background(), "import"), target, records, db.ImportOptions{Conflict: policy, DryRun: *dryRun})
+	for _, w := range report.Warnings {
+		fmt.Fprintf(os.Stderr, "warning %v\n", w)
+	}
+	for _, rejection := range report.Rejected {
+		fmt.Fprintf(os.Stderr, "rejected %v\n", rejection)
+	}
+	if err != nil {
+		return err
+	}
+
+	prefix := "imported"
+	if *dryRun {
+		prefix = "dry run, would import"
+	}
+	fmt.Fprintf(os.Stderr, "%s: %d created, %d updated, %d skipped\n", prefix, report.Created, report.Updated, report.Skipped)
+	return nil
+}
+
+// grpcTarget imports through the UserService API of a running server.
+type grpcTarget struct {
+	client pb.UserServiceClient
+}
+
+func (t grpcTarget) GetUserById(ctx context.Context, Id user.UserId) (user.User, error) {
+	resp, err := t.client.GetUsersByIDs(ctx, &pb.GetUsersByIDsRequest{Ids: []int64{int64(Id)}})
+	if err != nil {
+		return user.User{}, err
+	}
+	if len(resp.Users) == 0 {
+		return user.User{}, utility.ErrUserNotFound
+	}
+	return user.FromProto(resp.Users[0]), nil
+}
+
+func (t grpcTarget) AddUser(ctx context.Context, u user.User) (user.User, error) {
+	resp, err := t.client.AddUser(ctx, &pb.AddUserRequest{User: user.ToProto(u)})
+	if err != nil {
+		return user.User{}, err
+	}
+	return user.FromProto(resp.User), nil
+}
+
+// UpdateUser overwrites the user whatever its etag.
+func (t grpcTarget) UpdateUser(ctx context.Context, u user.User) (user.User, error) {
+	msg := user.ToProto(u)
+	msg.Etag = ""
+	resp, err := t.client.UpdateUser(ctx, &pb.UpdateUserRequest{User: msg})
+	if err != nil {
+		return user.User{}, err
+	}
+	return user.FromProto(resp.User), nil
+}
@@ -0,0 +1,47 @@
+package interceptor
+
+import (
+	"context"
+	"time"
+
+	"google.golang.org/grpc"
+)
+
+// Deadline bounds how long an RPC may run. Default applies when the client
+// sends no deadline, Max caps the one it sends. Zero leaves either unset.
+type Deadline struct {
+	Default time.Duration
+	Max     time.Duration
+}
+
+type DeadlineOptions struct {
+	Deadline
+	// Methods overrides the deadlines per full method name.
+	Methods map[string]Deadline
+}
+
+// UnaryDeadline enforces the deadlines of DeadlineOptions. It only applies to
+// unary RPCs, streams such as health watches may legitimately stay open.
+func UnaryDeadline(opts DeadlineOptions) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		limit, ok := opts.Methods[info.FullMethod]
+		if !ok {
+			limit = opts.Deadline
+		}
+
+		deadline, hasDeadline := ctx.Deadline()
+		var timeout time.Duration
+		switch {
+		case !hasDeadline:
+			timeout = limit.Default
+		case limit.Max > 0 && time.Until(deadline) > limit.Max:
+			timeout = limit.Max
+		}
+		if timeout > 0 {
+			var cancel context.CancelFunc
+			ctx, cancel = context.WithTimeout(ctx, timeout)
+			defer cancel()
+		}
+		return handler(ctx, req)
+	}
+}
@@ -0,0 +1,204 @@
+package interceptor
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log/slog"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/kunal768/go-grpc-tc/config"
+	pb "github.com/kunal768/go-grpc-tc/proto/users/v1"
+	"github.com/kunal768/go-grpc-tc/utility"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+func logLines(t *testing.T, buf *bytes.Buffer) []map[string]any {
+	var lines []map[string]any
+	for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+		if line == "" {
+			continue
+		}
+		var entry map[string]any
+		require.NoError(t, json.Unmarshal([]byte(line), &entry))
+		lines = append(lines, entry)
+	}
+	return lines
+}
+
+func TestUnaryLogging(t *testing.T) {
+	info := &grpc.UnaryServerInfo{FullMethod: "/UserService/GetUserByID"}
+	john := &pb.UserResponse{User: &pb.User{Id: 1, Fname: "John", City: "New York", Phone: 1234567890, Height: 180.5, Married: true, Email: "john@example.com", DateOfBirth: "1990-01-02"}}
+
+	t.Run("Logs the RPC with redacted payloads", func(t *testing.T) {
+		var buf bytes.Buffer
+		interceptor := UnaryLogging(LoggingOptions{
+			Logger:       slog.New(slog.NewJSONHandler(&buf, nil)),
+			SampleRate:   1,
+			Payloads:     true,
+			RedactFields: config.Default().Log.RedactFields,
+		})
+
+		ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs(RequestIDHeader, "req-1"))
+		_, err := interceptor(ctx, &pb.UserIDRequest{Id: 1}, info, func(ctx context.Context, req any) (any, error) {
+			assert.Equal(t, "req-1", RequestID(ctx))
+			return john, nil
+		})
+		require.NoError(t, err)
+
+		lines := logLines(t, &buf)
+		require.Len(t, lines, 1)
+		assert.Equal(t, "INFO", lines[0]["level"])
+		assert.Equal(t, "/UserService/GetUserByID", lines[0]["method"])
+		assert.Equal(t, "req-1", lines[0]["request_id"])
+		assert.Equal(t, "OK", lines[0]["code"])
+		assert.EqualValues(t, 2, lines[0]["request_size"])
+		assert.Contains(t, lines[0], "duration")
+		assert.Contains(t, lines[0]["response"], `"phone":"[REDACTED]"`)
+		assert.Contains(t, lines[0]["response"], `"fname":"John"`)
+		assert.Contains(t, lines[0]["response"], `"email":"[REDACTED]"`)
+		assert.Contains(t, lines[0]["response"], `"date_of_birth":"[REDACTED]"`)
+		assert.NotContains(t, buf.String(), "1234567890")
+		assert.NotContains(t, buf.String(), "john@example.com")
+		assert.NotContains(t, buf.String(), "1990-01-02")
+	})
+
+	t.Run("Generates a request ID", func(t *testing.T) {
+		var buf bytes.Buffer
+		interceptor := UnaryLogging(LoggingOptions{Logger: slog.New(slog.NewJSONHandler(&buf, nil)), SampleRate: 1})
+
+		var id string
+		_, err := interceptor(context.Background(), &pb.UserIDRequest{Id: 1}, info, func(ctx context.Context, req any) (any, error) {
+			id = RequestID(ctx)
+			return john, nil
+		})
+		require.NoError(t, err)
+		assert.Len(t, id, 32)
+		assert.Equal(t, id, logLines(t, &buf)[0]["request_id"])
+	})
+
+	t.Run("Sampling skips successes but not failures", func(t *testing.T) {
+		var buf bytes.Buffer
+		interceptor := UnaryLogging(LoggingOptions{
+			Logger:            slog.New(slog.NewJSONHandler(&buf, nil)),
+			SampleRate:        1,
+			MethodSampleRates: map[string]float64{info.FullMethod: 0},
+		})
+
+		_, err := interceptor(context.Background(), &pb.UserIDRequest{Id: 1}, info, func(ctx context.Context, req any) (any, error) {
+			return john, nil
+		})
+		require.NoError(t, err)
+		assert.Empty(t, buf.String())
+
+		_, err = interceptor(context.Background(), &pb.UserIDRequest{Id: 0}, info, func(ctx context.Context, req any) (any, error) {
+			return nil, status.Error(codes.InvalidArgument, utility.ErrInvalidIdInput.Error())
+		})
+		assert.Error(t, err)
+		lines := logLines(t, &buf)
+		require.Len(t, lines, 1)
+		assert.Equal(t, "WARN", lines[0]["level"])
+		assert.Equal(t, "InvalidArgument", lines[0]["code"])
+		assert.Equal(t, utility.ErrInvalidIdInput.Error(), lines[0]["error"])
+	})
+}
+
+func TestUnaryRecovery(t *testing.T) {
+	var buf bytes.Buffer
+	var panicked []string
+	interceptor := UnaryRecovery(RecoveryOptions{
+		Logger:  slog.New(slog.NewJSONHandler(&buf, nil)),
+		OnPanic: func(method string) { panicked = append(panicked, method) },
+	})
+	info := &grpc.UnaryServerInfo{FullMethod: "/UserService/SearchUsers"}
+
+	t.Run("Panic becomes Internal with an incident ID", func(t *testing.T) {
+		_, err := interceptor(context.Background(), &pb.SearchRequest{}, info, func(ctx context.Context, req any) (any, error) {
+			var users map[int]string
+			users[1] = "John"
+			return nil, nil
+		})
+
+		st := status.Convert(err)
+		assert.Equal(t, codes.Internal, st.Code())
+		assert.NotContains(t, st.Message(), "nil map")
+
+		lines := logLines(t, &buf)
+		require.Len(t, lines, 1)
+		assert.Equal(t, "ERROR", lines[0]["level"])
+		assert.Equal(t, "/UserService/SearchUsers", lines[0]["method"])
+		assert.Contains(t, lines[0]["panic"], "assignment to entry in nil map")
+		assert.Contains(t, lines[0]["stack"], "TestUnaryRecovery")
+		assert.Contains(t, st.Message(), lines[0]["incident_id"])
+		assert.Equal(t, []string{"/UserService/SearchUsers"}, panicked)
+	})
+
+	t.Run("Panics passing through logging are logged as Internal", func(t *testing.T) {
+		buf.Reset()
+		logging := UnaryLogging(LoggingOptions{Logger: slog.New(slog.NewJSONHandler(&buf, nil))})
+		_, err := interceptor(context.Background(), &pb.SearchRequest{}, info, func(ctx context.Context, req any) (any, error) {
+			return logging(ctx, req, info, func(ctx context.Context, req any) (any, error) {
+				panic("boom")
+			})
+		})
+		assert.Equal(t, codes.Internal, status.Code(err))
+
+		lines := logLines(t, &buf)
+		require.Len(t, lines, 2)
+		assert.Equal(t, "Internal", lines[0]["code"])
+		assert.Equal(t, "boom", lines[1]["panic"])
+		assert.NotEmpty(t, lines[0]["request_id"])
+		assert.Equal(t, lines[0]["request_id"], lines[1]["request_id"])
+		assert.Len(t, panicked, 2)
+	})
+
+	t.Run("Results pass through", func(t *testing.T) {
+		buf.Reset()
+		resp, err := interceptor(context.Background(), &pb.SearchRequest{}, info, func(ctx context.Context, req any) (any, error) {
+			return &pb.UsersResponse{}, nil
+		})
+		assert.NoError(t, err)
+		assert.Equal(t, &pb.UsersResponse{}, resp)
+		assert.Empty(t, buf.String())
+		assert.Len(t, panicked, 2)
+	})
+}
+
+func TestUnaryDeadline(t *testing.T) {
+	interceptor := UnaryDeadline(DeadlineOptions{
+		Deadline: Deadline{Default: time.Second, Max: time.Minute},
+		Methods: map[string]Deadline{
+			"/UserService/SearchUsers": {Default: 100 * time.Millisecond, Max: time.Second},
+		},
+	})
+	remaining := func(ctx context.Context, method string) time.Duration {
+		var d time.Duration
+		_, err := interceptor(ctx, nil, &grpc.UnaryServerInfo{FullMethod: method}, func(ctx context.Context, req any) (any, error) {
+			deadline, ok := ctx.Deadline()
+			require.True(t, ok)
+			d = time.Until(deadline)
+			return nil, nil
+		})
+		require.NoError(t, err)
+		return d
+	}
+
+	assert.InDelta(t, time.Second, remaining(context.Background(), "/UserService/GetUserByID"), float64(100*time.Millisecond), "default when the client sends none")
+	assert.InDelta(t, 100*time.Millisecond, remaining(context.Background(), "/UserService/SearchUsers"), float64(50*time.Millisecond), "per method default")
+
+	long, cancel := context.WithTimeout(context.Background(), time.Hour)
+	defer cancel()
+	assert.InDelta(t, time.Minute, remaining(long, "/UserService/GetUserByID"), float64(time.Second), "capped at the maximum")
+	assert.InDelta(t, time.Second, remaining(long, "/UserService/SearchUsers"), float64(100*time.Millisecond), "per method maximum")
+
+	short, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	assert.InDelta(t, 10*time.Second, remaining(short, "/UserService/GetUserByID"), float64(time.Second), "a shorter client deadline is kept")
+}
@@ -0,0 +1,264 @@
+package interceptor
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"log/slog"
+	mathrand "math/rand"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+)
+
+// RequestIDHeader is the metadata key a caller may set to correlate its
+// logs with ours. The server echoes it, or the ID it generated, back in the
+// response header.
+const RequestIDHeader = "x-request-id"
+
+type requestIDKey struct{}
+
+// RequestID returns the ID assigned to the RPC by the logging interceptor.
+func RequestID(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey{}).(string)
+	return id
+}
+
+type LoggingOptions struct {
+	Logger *slog.Logger
+	// SampleRate is the fraction of successful RPCs that are logged, unless
+	// MethodSampleRates has an entry for the full method name. Failed RPCs
+	// are always logged.
+	SampleRate        float64
+	MethodSampleRates map[string]float64
+	// Payloads adds the request and response messages, as JSON with the
+	// RedactFields masked, to every logged RPC.
+	Payloads     bool
+	RedactFields []string
+}
+
+type requestLogger struct {
+	LoggingOptions
+	redact map[string]bool
+}
+
+func newRequestLogger(opts LoggingOptions) *requestLogger {
+	if opts.Logger == nil {
+		opts.Logger = slog.Default()
+	}
+	l := &requestLogger{LoggingOptions: opts, redact: map[string]bool{}}
+	for _, field := range opts.RedactFields {
+		l.redact[field] = true
+	}
+	return l
+}
+
+func UnaryLogging(opts LoggingOptions) grpc.UnaryServerInterceptor {
+	l := newRequestLogger(opts)
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		ctx = l.start(ctx)
+		start := time.Now()
+		// a panic passes through to the recovery interceptor outside, log
+		// it as the Internal error that one turns it into
+		finished := false
+		defer func() {
+			if !finished {
+				l.log(ctx, info.FullMethod, start, errPanic)
+			}
+		}()
+		resp, err := handler(ctx, req)
+		finished = true
+
+		attrs := []slog.Attr{
+			slog.Int("request_size", messageSize(req)),
+			slog.Int("response_size", messageSize(resp)),
+		}
+		if l.Payloads {
+			attrs = append(attrs, slog.String("request", l.payload(req)), slog.String("response", l.payload(resp)))
+		}
+		l.log(ctx, info.FullMethod, start, err, attrs...)
+		return resp, err
+	}
+}
+
+func StreamLogging(opts LoggingOptions) grpc.StreamServerInterceptor {
+	l := newRequestLogger(opts)
+	return func(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		stream := &loggedStream{ServerStream: ss, ctx: l.start(ss.Context())}
+		start := time.Now()
+		finished := false
+		defer func() {
+			if !finished {
+				l.log(stream.ctx, info.FullMethod, start, errPanic)
+			}
+		}()
+		err := handler(srv, stream)
+		finished = true
+
+		l.log(stream.ctx, info.FullMethod, start, err,
+			slog.Int("request_size", stream.received),
+			slog.Int("response_size", stream.sent),
+			slog.Int("messages_received", stream.receivedMsgs),
+			slog.Int("messages_sent", stream.sentMsgs),
+		)
+		return err
+	}
+}
+
+// start attaches the request ID to ctx and to the response header.
+func (l *requestLogger) start(ctx context.Context) context.Context {
+	return withRequestID(ctx)
+}
+
+// withRequestID attaches the request ID to ctx and to the response header,
+// unless ctx has one already.
+func withRequestID(ctx context.Context) context.Context {
+	if RequestID(ctx) != "" {
+		return ctx
+	}
+	var id string
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		if values := md.Get(RequestIDHeader); len(values) > 0 && values[0] != "" {
+			id = values[0]
+		}
+	}
+	if id == "" {
+		id = newRequestID()
+	}
+	// fails only outside of an RPC, e.g. when the interceptor is unit tested
+	_ = grpc.SetHeader(ctx, metadata.Pairs(RequestIDHeader, id))
+	return context.WithValue(ctx, requestIDKey{}, id)
+}
+
+func (l *requestLogger) log(ctx context.Context, method string, start time.Time, err error, extra ...slog.Attr) {
+	code := status.Code(err)
+	if code == codes.OK && !l.sampled(method) {
+		return
+	}
+
+	attrs := []slog.Attr{
+		slog.String("method", method),
+		slog.String("request_id", RequestID(ctx)),
+		slog.String("peer", peerAddr(ctx)),
+		slog.Duration("duration", time.Since(start)),
+		slog.String("code", code.String()),
+	}
+	attrs = append(attrs, extra...)
+	if err != nil {
+		attrs = append(attrs, slog.String("error", status.Convert(err).Message()))
+	}
+	l.Logger.LogAttrs(ctx, level(code), "rpc", attrs...)
+}
+
+func (l *requestLogger) sampled(method string) bool {
+	rate, ok := l.MethodSampleRates[method]
+	if !ok {
+		rate = l.SampleRate
+	}
+	return rate >= 1 || (rate > 0 && mathrand.Float64() < rate)
+}
+
+// payload renders msg as JSON with the redacted fields replaced, at any depth.
+func (l *requestLogger) payload(msg any) string {
+	m, ok := msg.(proto.Message)
+	if !ok || m == nil {
+		return ""
+	}
+	data, err := protojson.MarshalOptions{UseProtoNames: true}.Marshal(m)
+	if err != nil {
+		return ""
+	}
+	var v any
+	if err := json.Unmarshal(data, &v); err != nil {
+		return ""
+	}
+	data, _ = json.Marshal(l.redactValue(v))
+	return string(data)
+}
+
+func (l *requestLogger) redactValue(v any) any {
+	switch v := v.(type) {
+	case map[string]any:
+		for key, value := range v {
+			if l.redact[key] {
+				v[key] = "[REDACTED]"
+			} else {
+				v[key] = l.redactValue(value)
+			}
+		}
+	case []any:
+		for i, value := range v {
+			v[i] = l.redactValue(value)
+		}
+	}
+	return v
+}
+
+func level(code codes.Code) slog.Level {
+	switch code {
+	case codes.OK:
+		return slog.LevelInfo
+	case codes.Internal, codes.Unknown, codes.DataLoss, codes.Unimplemented:
+		return slog.LevelError
+	}
+	return slog.LevelWarn
+}
+
+func messageSize(msg any) int {
+	if m, ok := msg.(proto.Message); ok && m != nil {
+		return proto.Size(m)
+	}
+	return 0
+}
+
+func peerAddr(ctx context.Context) string {
+	if p, ok := peer.FromContext(ctx); ok && p.Addr != nil {
+		return p.Addr.String()
+	}
+	return ""
+}
+
+func newRequestID() string {
+	b := make([]byte, 16)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// loggedStream counts the messages and bytes passing through a stream.
+type loggedStream struct {
+	grpc.ServerStream
+	ctx          context.Context
+	received     int
+	sent         int
+	receivedMsgs int
+	sentMsgs     int
+}
+
+func (s *loggedStream) Context() context.Context {
+	return s.ctx
+}
+
+func (s *loggedStream) RecvMsg(m any) error {
+	err := s.ServerStream.RecvMsg(m)
+	if err == nil {
+		s.receivedMsgs++
+		s.received += messageSize(m)
+	}
+	return err
+}
+
+func (s *loggedStream) SendMsg(m any) error {
+	err := s.ServerStream.SendMsg(m)
+	if err == nil {
+		s.sentMsgs++
+		s.sent += messageSize(m)
+	}
+	return err
+}
@@ -0,0 +1,83 @@
+package interceptor
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"runtime/debug"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// errPanic is how interceptors inside the recovery interceptor see a panic
+// passing through them.
+var errPanic = status.Error(codes.Internal, "panic in RPC handler")
+
+type RecoveryOptions struct {
+	Logger *slog.Logger
+	// OnPanic is called with the full method name of every recovered panic.
+	OnPanic func(method string)
+}
+
+// UnaryRecovery turns a panic in the handler into codes.Internal. The caller
+// only sees an incident ID, the panic value and stack trace are logged
+// under that ID and the request ID. Install it outermost, so panics in other
+// interceptors are recovered too; the logging interceptor and metrics record
+// a panic passing through them as Internal.
+func UnaryRecovery(opts RecoveryOptions) grpc.UnaryServerInterceptor {
+	if opts.Logger == nil {
+		opts.Logger = slog.Default()
+	}
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (resp any, err error) {
+		// the request ID is shared with the logging interceptor inside
+		ctx = withRequestID(ctx)
+		defer func() {
+			if r := recover(); r != nil {
+				err = recovered(ctx, opts, info.FullMethod, r)
+			}
+		}()
+		return handler(ctx, req)
+	}
+}
+
+func StreamRecovery(opts RecoveryOptions) grpc.StreamServerInterceptor {
+	if opts.Logger == nil {
+		opts.Logger = slog.Default()
+	}
+	return func(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) (err error) {
+		stream := &recoveredStream{ServerStream: ss, ctx: withRequestID(ss.Context())}
+		defer func() {
+			if r := recover(); r != nil {
+				err = recovered(stream.ctx, opts, info.FullMethod, r)
+			}
+		}()
+		return handler(srv, stream)
+	}
+}
+
+// recoveredStream carries the request ID to the interceptors inside.
+type recoveredStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *recoveredStream) Context() context.Context {
+	return s.ctx
+}
+
+func recovered(ctx context.Context, opts RecoveryOptions, method string, r any) error {
+	incident := newRequestID()
+	opts.Logger.ErrorContext(ctx, "panic in RPC handler",
+		slog.String("method", method),
+		slog.String("incident_id", incident),
+		slog.String("request_id", RequestID(ctx)),
+		slog.String("panic", fmt.Sprint(r)),
+		slog.String("stack", string(debug.Stack())),
+	)
+	if opts.OnPanic != nil {
+		opts.OnPanic(method)
+	}
+	return status.Errorf(codes.Internal, "internal error, incident %s", incident)
+}
@@ -0,0 +1,182 @@
+package loadshed
+
+import (
+	"context"
+	"math"
+	"strings"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+type Priority int
+
+const (
+	// PriorityLow is for expensive scans, shed first.
+	PriorityLow Priority = iota
+	PriorityNormal
+	// PriorityHigh is for cheap point reads, shed last.
+	PriorityHigh
+)
+
+// share is the fraction of the concurrency limit requests of a priority may
+// fill, so cheap reads still get through while scans are being shed.
+var share = map[Priority]float64{
+	PriorityLow:    0.5,
+	PriorityNormal: 0.8,
+	PriorityHigh:   1,
+}
+
+func (p Priority) String() string {
+	switch p {
+	case PriorityLow:
+		return "low"
+	case PriorityHigh:
+		return "high"
+	}
+	return "normal"
+}
+
+type Options struct {
+	InitialLimit int
+	MinLimit     int
+	MaxLimit     int
+	// LatencyThreshold is the RPC duration above which the server is
+	// considered overloaded. A DeadlineExceeded RPC counts as overloaded too.
+	LatencyThreshold time.Duration
+	// Backoff multiplies the limit on overload, 0.9 if zero.
+	Backoff float64
+	// Classify gives the priority of an RPC, PriorityNormal if nil. req is nil
+	// for streams.
+	Classify func(method string, req any) Priority
+	// ExemptMethods are full method names, or prefixes ending in "*", that
+	// are never shed nor counted.
+	ExemptMethods []string
+	// OnShed is called for every rejected RPC.
+	OnShed func(method string, priority Priority)
+}
+
+// Limiter is an AIMD concurrency limiter: the number of RPCs handled at once
+// grows by one while RPCs complete fast with the limit in use, and shrinks by
+// Backoff whenever one is slow.
+type Limiter struct {
+	opts Options
+
+	mu       sync.Mutex
+	limit    float64
+	inFlight int
+}
+
+func New(opts Options) *Limiter {
+	if opts.Backoff <= 0 || opts.Backoff >= 1 {
+		opts.Backoff = 0.9
+	}
+	if opts.MinLimit < 1 {
+		opts.MinLimit = 1
+	}
+	if opts.MaxLimit < opts.MinLimit {
+		opts.MaxLimit = opts.MinLimit
+	}
+	if opts.Classify == nil {
+		opts.Classify = func(string, any) Priority { return PriorityNormal }
+	}
+	limit := math.Max(float64(opts.MinLimit), math.Min(float64(opts.MaxLimit), float64(opts.InitialLimit)))
+	return &Limiter{opts: opts, limit: limit}
+}
+
+// Limit returns the current concurrency limit.
+func (l *Limiter) Limit() float64 {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.limit
+}
+
+// InFlight returns the number of RPCs holding a slot.
+func (l *Limiter) InFlight() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.inFlight
+}
+
+// Acquire takes a slot for an RPC of priority. When it succeeds the caller
+// must call release with the RPC's duration and error.
+func (l *Limiter) Acquire(priority Priority) (release func(time.Duration, error), ok bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if float64(l.inFlight) >= math.Max(1, math.Floor(l.limit*share[priority])) {
+		return nil, false
+	}
+	l.inFlight++
+	return l.release, true
+}
+
+func (l *Limiter) release(d time.Duration, err error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	used := l.inFlight
+	l.inFlight--
+	if d > l.opts.LatencyThreshold || status.Code(err) == codes.DeadlineExceeded {
+		l.limit = math.Max(float64(l.opts.MinLimit), l.limit*l.opts.Backoff)
+	} else if float64(used)*2 >= l.limit {
+		// only grow while the limit is actually being used
+		l.limit = math.Min(float64(l.opts.MaxLimit), l.limit+1)
+	}
+}
+
+func (l *Limiter) exempt(method string) bool {
+	for _, pattern := range l.opts.ExemptMethods {
+		if prefix, ok := strings.CutSuffix(pattern, "*"); ok {
+			if strings.HasPrefix(method, prefix) {
+				return true
+			}
+		} else if method == pattern {
+			return true
+		}
+	}
+	return false
+}
+
+func (l *Limiter) admit(method string, req any) (func(time.Duration, error), error) {
+	if l.exempt(method) {
+		return func(time.Duration, error) {}, nil
+	}
+	priority := l.opts.Classify(method, req)
+	release, ok := l.Acquire(priority)
+	if !ok {
+		if l.opts.OnShed != nil {
+			l.opts.OnShed(method, priority)
+		}
+		return nil, status.Error(codes.Unavailable, "server overloaded, retry later")
+	}
+	return release, nil
+}
+
+func (l *Limiter) UnaryInterceptor() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (resp any, err error) {
+		release, err := l.admit(info.FullMethod, req)
+		if err != nil {
+			return nil, err
+		}
+		// deferred so a panicking handler gives its slot back
+		start := time.Now()
+		defer func() { release(time.Since(start), err) }()
+		return handler(ctx, req)
+	}
+}
+
+func (l *Limiter) StreamInterceptor() grpc.StreamServerInterceptor {
+	return func(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) (err error) {
+		release, err := l.admit(info.FullMethod, nil)
+		if err != nil {
+			return err
+		}
+		start := time.Now()
+		defer func() { release(time.Since(start), err) }()
+		return handler(srv, ss)
+	}
+}
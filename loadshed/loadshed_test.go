@@ -0,0 +1,118 @@
+package loadshed
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestLimiter(t *testing.T) {
+	newLimiter := func() *Limiter {
+		return New(Options{InitialLimit: 10, MinLimit: 2, MaxLimit: 12, LatencyThreshold: 100 * time.Millisecond})
+	}
+
+	t.Run("Lower priorities get a smaller share", func(t *testing.T) {
+		l := newLimiter()
+		admitted := map[Priority]int{}
+		for _, priority := range []Priority{PriorityLow, PriorityNormal, PriorityHigh} {
+			for {
+				if _, ok := l.Acquire(priority); !ok {
+					break
+				}
+				admitted[priority]++
+			}
+		}
+		assert.Equal(t, map[Priority]int{PriorityLow: 5, PriorityNormal: 3, PriorityHigh: 2}, admitted)
+		assert.Equal(t, 10, l.InFlight())
+	})
+
+	t.Run("Backs off on slow RPCs", func(t *testing.T) {
+		l := newLimiter()
+		release, ok := l.Acquire(PriorityHigh)
+		require.True(t, ok)
+		release(time.Second, nil)
+		assert.Equal(t, 9.0, l.Limit())
+
+		for i := 0; i < 50; i++ {
+			release, _ := l.Acquire(PriorityHigh)
+			release(0, status.Error(codes.DeadlineExceeded, ""))
+		}
+		assert.Equal(t, 2.0, l.Limit(), "never below MinLimit")
+		assert.Zero(t, l.InFlight())
+	})
+
+	t.Run("Grows while the limit is used", func(t *testing.T) {
+		l := newLimiter()
+		release, _ := l.Acquire(PriorityHigh)
+		release(time.Millisecond, nil)
+		assert.Equal(t, 10.0, l.Limit(), "one RPC in flight does not use the limit")
+
+		var releases []func(time.Duration, error)
+		for i := 0; i < 10; i++ {
+			release, ok := l.Acquire(PriorityHigh)
+			require.True(t, ok)
+			releases = append(releases, release)
+		}
+		for _, release := range releases {
+			release(time.Millisecond, nil)
+		}
+		assert.Equal(t, 12.0, l.Limit(), "never above MaxLimit")
+	})
+}
+
+func TestUnaryInterceptor(t *testing.T) {
+	var shed []string
+	l := New(Options{
+		InitialLimit:     2,
+		MinLimit:         2,
+		MaxLimit:         2,
+		LatencyThreshold: time.Second,
+		Classify: func(method string, req any) Priority {
+			if method == "/UserService/SearchUsers" {
+				return PriorityLow
+			}
+			return PriorityHigh
+		},
+		ExemptMethods: []string{"/grpc.health.v1.Health/*"},
+		OnShed:        func(method string, priority Priority) { shed = append(shed, method+" "+priority.String()) },
+	})
+	interceptor := l.UnaryInterceptor()
+
+	release := make(chan struct{})
+	started := make(chan struct{})
+	go interceptor(context.Background(), nil, &grpc.UnaryServerInfo{FullMethod: "/UserService/GetUserByID"}, func(ctx context.Context, req any) (any, error) {
+		close(started)
+		<-release
+		return nil, nil
+	})
+	<-started
+
+	call := func(method string) error {
+		_, err := interceptor(context.Background(), nil, &grpc.UnaryServerInfo{FullMethod: method}, func(ctx context.Context, req any) (any, error) {
+			return nil, nil
+		})
+		return err
+	}
+	assert.Equal(t, codes.Unavailable, status.Code(call("/UserService/SearchUsers")), "scans only get half the limit")
+	assert.NoError(t, call("/UserService/GetUserByID"))
+	assert.NoError(t, call("/grpc.health.v1.Health/Check"))
+	assert.Equal(t, []string{"/UserService/SearchUsers low"}, shed)
+
+	t.Run("A panicking handler releases its slot", func(t *testing.T) {
+		assert.Panics(t, func() {
+			interceptor(context.Background(), nil, &grpc.UnaryServerInfo{FullMethod: "/UserService/GetUserByID"}, func(ctx context.Context, req any) (any, error) {
+				panic("boom")
+			})
+		})
+		assert.Equal(t, 1, l.InFlight())
+	})
+
+	close(release)
+	require.Eventually(t, func() bool { return l.InFlight() == 0 }, time.Second, time.Millisecond)
+}
@@ -1,30 +1,614 @@
 package main
 
 import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
 	"log"
+	"log/slog"
 	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"path"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
 
+	"github.com/kunal768/go-grpc-tc/admin"
+	"github.com/kunal768/go-grpc-tc/audit"
+	"github.com/kunal768/go-grpc-tc/auth"
+	"github.com/kunal768/go-grpc-tc/cdc"
+	"github.com/kunal768/go-grpc-tc/config"
 	"github.com/kunal768/go-grpc-tc/db"
-	pb "github.com/kunal768/go-grpc-tc/proto"
+	"github.com/kunal768/go-grpc-tc/idempotency"
+	"github.com/kunal768/go-grpc-tc/interceptor"
+	"github.com/kunal768/go-grpc-tc/loadshed"
+	"github.com/kunal768/go-grpc-tc/metrics"
+	usersv1 "github.com/kunal768/go-grpc-tc/proto/users/v1"
+	usersv2 "github.com/kunal768/go-grpc-tc/proto/users/v2"
+	"github.com/kunal768/go-grpc-tc/ratelimit"
+	"github.com/kunal768/go-grpc-tc/server"
+	"github.com/kunal768/go-grpc-tc/tenant"
+	"github.com/kunal768/go-grpc-tc/tracing"
 	"github.com/kunal768/go-grpc-tc/user"
+	"github.com/kunal768/go-grpc-tc/utility"
+	"go.opentelemetry.io/contrib/instrumentation/google.golang.org/grpc/otelgrpc"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
 )
 
+const usage = `usage:
+  go-grpc-tc [serve] [flags]          run the gRPC server
+  go-grpc-tc export [flags]           write every user to a file
+  go-grpc-tc import [flags]           read users from a file into the store
+  go-grpc-tc verify-audit [flags]     check the hash chain of the audit log
+
+Run a command with -h to list its flags.
+`
+
 func main() {
+	command, args := "serve", os.Args[1:]
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		command, args = args[0], args[1:]
+	}
+
+	var err error
+	switch command {
+	case "serve":
+		serve(args)
+		return
+	case "export":
+		err = runExport(args)
+	case "import":
+		err = runImport(args)
+	case "verify-audit":
+		err = runVerifyAudit(args)
+	default:
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+
+	if errors.Is(err, flag.ErrHelp) {
+		os.Exit(2)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s: %v\n", command, err)
+		os.Exit(1)
+	}
+}
+
+func serve(args []string) {
+	cfg, opts, err := config.Load(flag.NewFlagSet("serve", flag.ContinueOnError), args, os.LookupEnv)
+	if errors.Is(err, flag.ErrHelp) {
+		os.Exit(2)
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
 
-	repo := user.NewRepository(db.InitDb())
+	if opts.PrintConfig {
+		out, err := cfg.YAML()
+		if err != nil {
+			log.Fatalf("failed to print config: %v", err)
+		}
+		os.Stdout.Write(out)
+		return
+	}
 
-	service := user.NewService(repo)
+	slog.SetDefault(newLogger(cfg.Log))
 
-	server := grpc.NewServer()
-	pb.RegisterUserServiceServer(server, user.NewUserServiceServer(service))
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
 
-	lis, err := net.Listen("tcp", ":8080")
+	shutdownTracing, err := tracing.Setup(ctx, tracing.Options{
+		ServiceName:  "go-grpc-tc",
+		Exporter:     cfg.Tracing.Exporter,
+		File:         cfg.Tracing.File,
+		OTLPEndpoint: cfg.Tracing.OTLPEndpoint,
+		OTLPInsecure: cfg.Tracing.OTLPInsecure,
+		SampleRatio:  cfg.Tracing.SampleRatio,
+	})
+	if err != nil {
+		log.Fatalf("failed to set up tracing: %v", err)
+	}
+
+	m := metrics.New()
+
+	repo, err := newTenantRepository(cfg)
+	if err != nil {
+		log.Fatalf("failed to open repository: %v", err)
+	}
+	feed, _ := repo.(user.ChangeFeed)
+	// metrics go first, the user count gauge sums the tenants of repo
+	repo = tracing.Repository(m.InstrumentRepository(repo))
+
+	ids, err := newIDGenerator(cfg, repo)
+	if err != nil {
+		log.Fatalf("failed to configure IDs: %v", err)
+	}
+	service := tracing.Service(user.NewServiceWithOptions(repo, user.ServiceOptions{IDs: ids}))
+
+	var limiter *ratelimit.Limiter
+	if cfg.RateLimit.Enabled {
+		limiter = newLimiter(cfg.RateLimit, cfg.Tenancy)
+	}
+
+	var auditLog *audit.Log
+	if cfg.Audit.Enabled {
+		auditLog, err = audit.Open(cfg.Audit.Path)
+		if err != nil {
+			log.Fatalf("failed to open audit log: %v", err)
+		}
+		defer auditLog.Close()
+	}
+
+	serverOptions, err := grpcServerOptions(ctx, cfg, m, limiter, auditLog)
+	if err != nil {
+		log.Fatalf("failed to configure server: %v", err)
+	}
+
+	serverOpts := server.Options{
+		Reflection:    cfg.Server.Reflection,
+		ServerOptions: serverOptions,
+	}
+	// AdminService exposes every client and the audit log, it is only served
+	// to authenticated callers
+	if cfg.Auth.Enabled {
+		serverOpts.Admin = admin.NewServer(admin.Options{Limiter: limiter, AuditLog: auditLog})
+	} else {
+		log.Printf("AdminService is not served, it requires auth.enabled")
+	}
+	srv := server.New(service, serverOpts)
+
+	lis, err := net.Listen("tcp", cfg.Server.ListenAddress)
 	if err != nil {
 		log.Fatalf("failed to listen: %v", err)
 	}
+
+	var publishers sync.WaitGroup
+	if cfg.CDC.Enabled {
+		publisher, closeSinks, err := newPublisher(cfg.CDC, feed)
+		if err != nil {
+			log.Fatalf("failed to set up change data capture: %v", err)
+		}
+		defer closeSinks()
+		// one publisher per tenant, each tenant has an outbox of its own
+		contexts := []context.Context{ctx}
+		if cfg.Tenancy.Enabled {
+			contexts = contexts[:0]
+			for name := range cfg.Tenancy.Tenants {
+				contexts = append(contexts, tenant.NewContext(ctx, name))
+			}
+		}
+		for _, ctx := range contexts {
+			publishers.Add(1)
+			go func(ctx context.Context) {
+				defer publishers.Done()
+				publisher.Run(ctx)
+			}(ctx)
+		}
+	}
+
+	// health reports NOT_SERVING until the repository has been seeded, a
+	// failed seed stops serving and shuts down like a signal
+	serveCtx, cancelServe := context.WithCancel(ctx)
+	defer cancelServe()
+	var seedErr error
+	seeded := make(chan struct{})
+	go func() {
+		defer close(seeded)
+		if seedErr = seedTenants(ctx, cfg, repo); seedErr != nil {
+			cancelServe()
+			return
+		}
+		srv.SetServing(true)
+	}()
+
+	var metricsServer *http.Server
+	if cfg.Metrics.ListenAddress != "" {
+		metricsServer = m.NewHTTPServer(cfg.Metrics.ListenAddress)
+		metricsLis, err := net.Listen("tcp", cfg.Metrics.ListenAddress)
+		if err != nil {
+			log.Fatalf("failed to listen for metrics: %v", err)
+		}
+		go func() {
+			if err := metricsServer.Serve(metricsLis); err != nil && err != http.ErrServerClosed {
+				log.Printf("metrics server stopped: %v", err)
+			}
+		}()
+		log.Printf("metrics listening at %v", metricsLis.Addr())
+	}
+
 	log.Printf("server listening at %v", lis.Addr())
-	if err := server.Serve(lis); err != nil {
-		log.Fatalf("failed to serve: %v", err)
+	serveErr := srv.Run(serveCtx, lis, cfg.Server.ShutdownTimeout)
+	if errors.Is(serveErr, utility.ErrDrainTimeout) {
+		log.Printf("shutdown: %v", serveErr)
+		serveErr = nil
+	}
+
+	if metricsServer != nil {
+		metricsServer.Close()
+	}
+
+	// serving may have failed without a signal, stop the publishers either
+	// way; their acknowledgements are part of the last flush
+	stop()
+	publishers.Wait()
+	<-seeded
+	// flush the repository even if serving failed
+	if err := repo.Close(); err != nil {
+		log.Fatalf("failed to close repository: %v", err)
+	}
+	// the signal context is done, flushing spans gets its own deadline
+	flushCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := shutdownTracing(flushCtx); err != nil {
+		log.Printf("failed to flush traces: %v", err)
+	}
+
+	if seedErr != nil && !errors.Is(seedErr, context.Canceled) {
+		log.Fatalf("failed to seed repository: %v", seedErr)
+	}
+	if serveErr != nil {
+		log.Fatalf("failed to serve: %v", serveErr)
+	}
+	log.Printf("server stopped")
+}
+
+// seedTenants seeds the repository, or with tenancy enabled the store of
+// every tenant from its own seed file.
+func seedTenants(ctx context.Context, cfg config.Config, repo user.Repository) error {
+	if !cfg.Tenancy.Enabled {
+		return seedRepository(ctx, cfg.Seed, repo)
+	}
+	for name, t := range cfg.Tenancy.Tenants {
+		if t.SeedFile == "" {
+			continue
+		}
+		seed := config.SeedConfig{File: t.SeedFile, Mode: cfg.Seed.Mode}
+		if err := seedRepository(tenant.NewContext(ctx, name), seed, repo); err != nil {
+			return fmt.Errorf("tenant %s: %w", name, err)
+		}
+	}
+	return nil
+}
+
+// seedRepository loads the seed file, or the built-in sample users when none
+// is configured. A repository that already holds users is left untouched.
+func seedRepository(ctx context.Context, cfg config.SeedConfig, repo user.Repository) error {
+	if repo.CountUsers(ctx) > 0 {
+		return nil
+	}
+	ctx = user.WithActor(ctx, "seed")
+	if cfg.File == "" {
+		return db.Seed(ctx, repo)
+	}
+
+	report, err := db.LoadSeedFile(ctx, repo, cfg.File, db.SeedMode(cfg.Mode))
+	for _, w := range report.Warnings {
+		slog.Warn("seed row loaded with a warning", "file", cfg.File, "row", w.Row, "id", w.ID, "warning", w.Err)
+	}
+	for _, rejection := range report.Rejected {
+		slog.Warn("rejected seed row", "file", cfg.File, "row", rejection.Row, "id", rejection.ID, "error", rejection.Err)
+	}
+	if err != nil {
+		return err
+	}
+	slog.Info("seeded repository", "file", cfg.File, "loaded", report.Loaded, "rejected", len(report.Rejected))
+	return nil
+}
+
+func newLogger(cfg config.LogConfig) *slog.Logger {
+	var level slog.Level
+	// Validate has already checked the level
+	_ = level.UnmarshalText([]byte(cfg.Level))
+
+	handlerOptions := &slog.HandlerOptions{Level: level}
+	if cfg.Format == "json" {
+		return slog.New(slog.NewJSONHandler(os.Stderr, handlerOptions))
+	}
+	return slog.New(slog.NewTextHandler(os.Stderr, handlerOptions))
+}
+
+// newTenantRepository opens the repository, or with tenancy enabled one
+// repository per tenant behind a router.
+func newTenantRepository(cfg config.Config) (user.Repository, error) {
+	if !cfg.Tenancy.Enabled {
+		return newRepository(cfg.Storage, cfg.CDC.Enabled)
+	}
+	repos := map[string]user.Repository{}
+	for name := range cfg.Tenancy.Tenants {
+		repo, err := newRepository(cfg.Storage.ForTenant(name), cfg.CDC.Enabled)
+		if err != nil {
+			return nil, fmt.Errorf("tenant %s: %w", name, err)
+		}
+		repos[name] = repo
+	}
+	return user.NewTenantRepository(repos), nil
+}
+
+// newRepository opens the storage backend, with an outbox for change data
+// capture if outbox is set.
+func newRepository(cfg config.StorageConfig, outbox bool) (user.Repository, error) {
+	opts := user.RepositoryOptions{Outbox: outbox}
+	if cfg.Backend == config.BackendFile {
+		return user.NewFileRepositoryWithOptions(cfg.Path, cfg.FlushInterval, opts)
+	}
+	return user.NewRepositoryWithOptions(user.UserDB{}, opts), nil
+}
+
+// newPublisher builds the change data capture publisher and its sinks, and
+// returns a function closing them.
+func newPublisher(cfg config.CDCConfig, feed user.ChangeFeed) (*cdc.Publisher, func(), error) {
+	format, err := cdc.ParseFormat(cfg.Format)
+	if err != nil {
+		return nil, nil, err
+	}
+	sinks := map[string]cdc.Sink{}
+	var deadLetter cdc.Sink
+	closeSinks := func() {
+		for name, sink := range sinks {
+			if err := sink.Close(); err != nil {
+				slog.Warn("failed to close change data capture sink", "sink", name, "error", err)
+			}
+		}
+		if deadLetter != nil {
+			deadLetter.Close()
+		}
+	}
+	if cfg.File.Path != "" {
+		sink, err := cdc.NewFileSink(cdc.FileOptions{Path: cfg.File.Path, MaxBytes: int64(cfg.File.MaxBytes), MaxFiles: cfg.File.MaxFiles})
+		if err != nil {
+			return nil, nil, err
+		}
+		sinks["file"] = sink
+	}
+	if cfg.Webhook.URL != "" {
+		sinks["webhook"] = cdc.NewWebhookSink(cdc.WebhookOptions{URL: cfg.Webhook.URL, Secret: cfg.Webhook.Secret, Timeout: cfg.Webhook.Timeout})
+	}
+	if cfg.NATS.URL != "" {
+		sink, err := cdc.NewNATSSink(cdc.NATSOptions{URL: cfg.NATS.URL, Subject: cfg.NATS.Subject})
+		if err != nil {
+			closeSinks()
+			return nil, nil, err
+		}
+		sinks["nats"] = sink
+	}
+
+	opts := cdc.Options{
+		Format:       format,
+		Sinks:        sinks,
+		MaxAttempts:  cfg.MaxAttempts,
+		Backoff:      cfg.Backoff,
+		MaxBackoff:   cfg.MaxBackoff,
+		PollInterval: cfg.PollInterval,
+		BatchSize:    cfg.BatchSize,
+		OnError: func(sink string, msg cdc.Message, err error) {
+			slog.Warn("change data capture delivery failed", "sink", sink, "event", msg.ID, "error", err)
+		},
+	}
+	if cfg.DeadLetterFile != "" {
+		file, err := cdc.NewFileSink(cdc.FileOptions{Path: cfg.DeadLetterFile})
+		if err != nil {
+			closeSinks()
+			return nil, nil, err
+		}
+		deadLetter = file
+		opts.DeadLetter = file
+	}
+	return cdc.NewPublisher(feed, opts), closeSinks, nil
+}
+
+func newAuthenticator(cfg config.AuthConfig) (*auth.Authenticator, error) {
+	opts := auth.Options{ExemptMethods: cfg.ExemptMethods}
+	if cfg.APIKeysFile != "" {
+		keys, err := auth.LoadAPIKeys(cfg.APIKeysFile)
+		if err != nil {
+			return nil, err
+		}
+		opts.APIKeys = keys
+	}
+	if cfg.JWTSecret != "" || cfg.JWKSFile != "" {
+		verifier, err := auth.NewJWTVerifier(auth.JWTOptions{
+			Secret:   []byte(cfg.JWTSecret),
+			JWKSFile: cfg.JWKSFile,
+			Issuer:   cfg.JWTIssuer,
+			Audience: cfg.JWTAudience,
+		})
+		if err != nil {
+			return nil, err
+		}
+		opts.JWT = verifier
+	}
+	return auth.NewAuthenticator(opts), nil
+}
+
+func newIDGenerator(cfg config.Config, repo user.Repository) (user.IDGenerator, error) {
+	switch cfg.IDs.Generator {
+	case "snowflake":
+		return user.NewSnowflakeGenerator(int64(cfg.IDs.NodeID))
+	case "uuidv7":
+		return user.NewUUIDv7Generator(int64(cfg.IDs.NodeID))
+	}
+	if cfg.Tenancy.Enabled {
+		return user.NewTenantGenerator(func() user.IDGenerator { return user.NewSequentialGenerator(repo) }), nil
+	}
+	return user.NewSequentialGenerator(repo), nil
+}
+
+func newLimiter(cfg config.RateLimitConfig, tenancy config.TenancyConfig) *ratelimit.Limiter {
+	opts := ratelimit.Options{
+		Default:       ratelimit.Limit{Rate: cfg.Rate, Burst: cfg.Burst, DailyQuota: int64(cfg.DailyQuota)},
+		Methods:       map[string]ratelimit.Limit{},
+		Tenants:       map[string]ratelimit.Limit{},
+		ExemptMethods: cfg.ExemptMethods,
+	}
+	for method, limit := range cfg.Methods {
+		opts.Methods[method] = ratelimit.Limit{Rate: limit.Rate, Burst: limit.Burst, DailyQuota: int64(limit.DailyQuota)}
+	}
+	if tenancy.Enabled {
+		for name, t := range tenancy.Tenants {
+			if limit := t.RateLimit; limit.Rate > 0 || limit.DailyQuota > 0 {
+				opts.Tenants[name] = ratelimit.Limit{Rate: limit.Rate, Burst: limit.Burst, DailyQuota: int64(limit.DailyQuota)}
+			}
+		}
+	}
+	return ratelimit.New(opts)
+}
+
+// requestPriority ranks point reads above writes and pages, and those above
+// searches and unpaged lists, which scan every user. All API versions,
+// including the unpackaged legacy service, rank the same.
+func requestPriority(method string, req any) loadshed.Priority {
+	service, name := path.Split(method)
+	switch strings.Trim(service, "/") {
+	case usersv1.UserService_ServiceDesc.ServiceName, usersv2.UserService_ServiceDesc.ServiceName, server.LegacyUserServiceName:
+	default:
+		return loadshed.PriorityNormal
+	}
+	switch name {
+	case "GetUserByID", "GetUsersByIDs":
+		return loadshed.PriorityHigh
+	case "SearchUsers":
+		return loadshed.PriorityLow
+	case "ListUsers":
+		if r, ok := req.(interface{ GetPageSize() int32 }); ok && r.GetPageSize() > 0 && r.GetPageSize() <= 100 {
+			return loadshed.PriorityNormal
+		}
+		return loadshed.PriorityLow
+	}
+	return loadshed.PriorityNormal
+}
+
+func grpcServerOptions(ctx context.Context, cfg config.Config, m *metrics.Metrics, limiter *ratelimit.Limiter, auditLog *audit.Log) ([]grpc.ServerOption, error) {
+	loggingOptions := interceptor.LoggingOptions{
+		Logger:            slog.Default(),
+		SampleRate:        cfg.Log.SampleRate,
+		MethodSampleRates: cfg.Log.MethodSampleRates,
+		Payloads:          cfg.Log.Payloads,
+		RedactFields:      cfg.Log.RedactFields,
+	}
+	recoveryOptions := interceptor.RecoveryOptions{
+		Logger:  slog.Default(),
+		OnPanic: m.PanicRecovered,
+	}
+
+	deadlineOptions := interceptor.DeadlineOptions{
+		Deadline: interceptor.Deadline{Default: cfg.Deadlines.Default, Max: cfg.Deadlines.Max},
+		Methods:  map[string]interceptor.Deadline{},
+	}
+	for method, d := range cfg.Deadlines.Methods {
+		deadlineOptions.Methods[method] = interceptor.Deadline{Default: d.Default, Max: d.Max}
+	}
+
+	// recovery is outermost so a panic in any interceptor is recovered,
+	// metrics and logging record a panic passing through as Internal
+	unary := []grpc.UnaryServerInterceptor{
+		interceptor.UnaryRecovery(recoveryOptions),
+		m.UnaryInterceptor(),
+		interceptor.UnaryLogging(loggingOptions),
+		interceptor.UnaryDeadline(deadlineOptions),
+	}
+	stream := []grpc.StreamServerInterceptor{
+		interceptor.StreamRecovery(recoveryOptions),
+		m.StreamInterceptor(),
+		interceptor.StreamLogging(loggingOptions),
+	}
+	// shed before authenticating, rejecting must stay cheap under overload
+	if cfg.LoadShed.Enabled {
+		shedder := loadshed.New(loadshed.Options{
+			InitialLimit:     cfg.LoadShed.InitialLimit,
+			MinLimit:         cfg.LoadShed.MinLimit,
+			MaxLimit:         cfg.LoadShed.MaxLimit,
+			LatencyThreshold: cfg.LoadShed.LatencyThreshold,
+			Classify:         requestPriority,
+			ExemptMethods:    cfg.LoadShed.ExemptMethods,
+			OnShed: func(method string, priority loadshed.Priority) {
+				m.RequestShed(method, priority.String())
+			},
+		})
+		m.ObserveConcurrency(shedder.Limit, shedder.InFlight)
+		unary = append(unary, shedder.UnaryInterceptor())
+		stream = append(stream, shedder.StreamInterceptor())
+	}
+	if cfg.Auth.Enabled {
+		authenticator, err := newAuthenticator(cfg.Auth)
+		if err != nil {
+			return nil, err
+		}
+		unary = append(unary, authenticator.UnaryInterceptor())
+		stream = append(stream, authenticator.StreamInterceptor())
+	}
+	if cfg.Tenancy.Enabled {
+		tenants := make([]string, 0, len(cfg.Tenancy.Tenants))
+		for name := range cfg.Tenancy.Tenants {
+			tenants = append(tenants, name)
+		}
+		resolver := tenant.NewResolver(tenant.Options{
+			Tenants:       tenants,
+			Default:       cfg.Tenancy.DefaultTenant,
+			ExemptMethods: cfg.Tenancy.ExemptMethods,
+		})
+		unary = append(unary, resolver.UnaryInterceptor())
+		stream = append(stream, resolver.StreamInterceptor())
+	}
+	// audit before authorizing, so denied calls are recorded too
+	if auditLog != nil {
+		unary = append(unary, audit.NewAuditor(auditLog, audit.Options{
+			Methods:         cfg.Audit.Methods,
+			SensitiveFields: cfg.Audit.SensitiveFields,
+			OnError: func(method string, err error) {
+				slog.Error("failed to write audit record", "method", method, "error", err)
+			},
+		}).UnaryInterceptor())
+	}
+	if cfg.Auth.PolicyFile != "" {
+		policy, err := auth.LoadPolicy(cfg.Auth.PolicyFile)
+		if err != nil {
+			return nil, err
+		}
+		unary = append(unary, policy.UnaryInterceptor())
+		stream = append(stream, policy.StreamInterceptor())
+	}
+	if limiter != nil {
+		unary = append(unary, limiter.UnaryInterceptor())
+		stream = append(stream, limiter.StreamInterceptor())
+	}
+	// innermost, so calls rejected by auth or limits are never stored
+	if cfg.Idempotency.Enabled {
+		unary = append(unary, idempotency.New(idempotency.Options{
+			TTL:        cfg.Idempotency.TTL,
+			Methods:    cfg.Idempotency.Methods,
+			MaxEntries: cfg.Idempotency.MaxEntries,
+		}).UnaryInterceptor())
+	}
+
+	opts := []grpc.ServerOption{
+		grpc.MaxRecvMsgSize(cfg.Limits.MaxRecvMsgSize),
+		grpc.MaxSendMsgSize(cfg.Limits.MaxSendMsgSize),
+		grpc.MaxConcurrentStreams(cfg.Limits.MaxConcurrentStreams),
+		grpc.ConnectionTimeout(cfg.Limits.ConnectionTimeout),
+		grpc.StatsHandler(otelgrpc.NewServerHandler()),
+		grpc.ChainUnaryInterceptor(unary...),
+		grpc.ChainStreamInterceptor(stream...),
+	}
+
+	if cfg.TLS.Enabled {
+		reloader, err := server.NewCertReloader(server.TLSOptions{
+			CertFile:          cfg.TLS.CertFile,
+			KeyFile:           cfg.TLS.KeyFile,
+			ClientCAFile:      cfg.TLS.ClientCAFile,
+			RequireClientCert: cfg.TLS.RequireClientCert,
+		})
+		if err != nil {
+			return nil, err
+		}
+		go reloader.Watch(ctx, cfg.TLS.ReloadInterval)
+		opts = append(opts, grpc.Creds(credentials.NewTLS(reloader.TLSConfig())))
 	}
+	return opts, nil
 }
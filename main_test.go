@@ -0,0 +1,34 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/kunal768/go-grpc-tc/loadshed"
+	usersv1 "github.com/kunal768/go-grpc-tc/proto/users/v1"
+	usersv2 "github.com/kunal768/go-grpc-tc/proto/users/v2"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRequestPriority(t *testing.T) {
+	tests := []struct {
+		name     string
+		method   string
+		req      any
+		priority loadshed.Priority
+	}{
+		{"Point read", "/users.v2.UserService/GetUserByID", &usersv2.GetUserByIDRequest{Id: 1}, loadshed.PriorityHigh},
+		{"Write", "/users.v2.UserService/AddUser", &usersv2.AddUserRequest{}, loadshed.PriorityNormal},
+		{"Page", "/users.v2.UserService/ListUsers", &usersv2.ListUsersRequest{PageSize: 10}, loadshed.PriorityNormal},
+		{"Unpaged list", "/users.v2.UserService/ListUsers", &usersv2.ListUsersRequest{}, loadshed.PriorityLow},
+		{"v1 search", "/users.v1.UserService/SearchUsers", &usersv1.SearchRequest{}, loadshed.PriorityLow},
+		{"Legacy search", "/UserService/SearchUsers", &usersv1.SearchRequest{}, loadshed.PriorityLow},
+		{"Legacy unpaged list", "/UserService/ListUsers", &usersv1.ListUsersRequest{}, loadshed.PriorityLow},
+		{"Legacy point read", "/UserService/GetUserByID", &usersv1.UserIDRequest{Id: 1}, loadshed.PriorityHigh},
+		{"Other service", "/grpc.health.v1.Health/Check", nil, loadshed.PriorityNormal},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.priority, requestPriority(tt.method, tt.req))
+		})
+	}
+}
@@ -0,0 +1,193 @@
+package metrics
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const namespace = "usersvc"
+
+// Metrics holds the collectors of the server on its own registry, so tests
+// and multiple servers in one process don't collide.
+type Metrics struct {
+	registry *prometheus.Registry
+
+	requests *prometheus.CounterVec
+	latency  *prometheus.HistogramVec
+	inFlight *prometheus.GaugeVec
+	panics   *prometheus.CounterVec
+	shed     *prometheus.CounterVec
+
+	repoOperations *prometheus.CounterVec
+	repoLatency    *prometheus.HistogramVec
+	scanned        *prometheus.HistogramVec
+}
+
+func New() *Metrics {
+	m := &Metrics{
+		registry: prometheus.NewRegistry(),
+		requests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "grpc_requests_total",
+			Help:      "RPCs completed, by full method name and status code.",
+		}, []string{"method", "code"}),
+		latency: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "grpc_request_duration_seconds",
+			Help:      "Time to handle an RPC, by full method name.",
+			Buckets:   []float64{.0005, .001, .0025, .005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5},
+		}, []string{"method"}),
+		inFlight: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "grpc_requests_in_flight",
+			Help:      "RPCs currently being handled, by full method name.",
+		}, []string{"method"}),
+		panics: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "grpc_panics_total",
+			Help:      "Panics recovered in RPC handlers, by full method name.",
+		}, []string{"method"}),
+		shed: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "grpc_shed_total",
+			Help:      "RPCs rejected by the concurrency limiter, by full method name and priority.",
+		}, []string{"method", "priority"}),
+		repoOperations: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "repository_operations_total",
+			Help:      "Repository calls, by operation and result.",
+		}, []string{"operation", "result"}),
+		repoLatency: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "repository_operation_duration_seconds",
+			Help:      "Time spent in the repository, by operation.",
+			Buckets:   []float64{.00001, .00005, .0001, .0005, .001, .005, .01, .05, .1, .5, 1},
+		}, []string{"operation"}),
+		scanned: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "repository_scanned_users",
+			Help:      "Users examined by a search or list, by operation.",
+			Buckets:   prometheus.ExponentialBuckets(1, 4, 10),
+		}, []string{"operation"}),
+	}
+
+	m.registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		m.requests,
+		m.latency,
+		m.inFlight,
+		m.panics,
+		m.shed,
+		m.repoOperations,
+		m.repoLatency,
+		m.scanned,
+	)
+	return m
+}
+
+// Registry is exposed so other packages can add their own collectors.
+func (m *Metrics) Registry() *prometheus.Registry {
+	return m.registry
+}
+
+// Handler serves the registry in the Prometheus text format.
+func (m *Metrics) Handler() http.Handler {
+	return promhttp.HandlerFor(m.registry, promhttp.HandlerOpts{Registry: m.registry})
+}
+
+// NewHTTPServer serves Handler on /metrics at addr.
+func (m *Metrics) NewHTTPServer(addr string) *http.Server {
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", m.Handler())
+	return &http.Server{
+		Addr:              addr,
+		Handler:           mux,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+}
+
+// errPanic is the outcome of an RPC whose handler panicked.
+var errPanic = status.Error(codes.Internal, "panic")
+
+func (m *Metrics) UnaryInterceptor() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		done := m.startRPC(info.FullMethod)
+		// a panic passes through to the recovery interceptor outside, count
+		// it as the Internal error that one turns it into
+		finished := false
+		defer func() {
+			if !finished {
+				done(errPanic)
+			}
+		}()
+		resp, err := handler(ctx, req)
+		finished = true
+		done(err)
+		return resp, err
+	}
+}
+
+func (m *Metrics) StreamInterceptor() grpc.StreamServerInterceptor {
+	return func(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		done := m.startRPC(info.FullMethod)
+		finished := false
+		defer func() {
+			if !finished {
+				done(errPanic)
+			}
+		}()
+		err := handler(srv, ss)
+		finished = true
+		done(err)
+		return err
+	}
+}
+
+// PanicRecovered counts a panic recovered in method, see
+// interceptor.RecoveryOptions.
+func (m *Metrics) PanicRecovered(method string) {
+	m.panics.WithLabelValues(method).Inc()
+}
+
+// RequestShed counts an RPC rejected by the concurrency limiter, see
+// loadshed.Options.
+func (m *Metrics) RequestShed(method, priority string) {
+	m.shed.WithLabelValues(method, priority).Inc()
+}
+
+// ObserveConcurrency exports the current concurrency limit and the RPCs
+// holding a slot.
+func (m *Metrics) ObserveConcurrency(limit func() float64, inFlight func() int) {
+	m.registry.MustRegister(
+		prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "concurrency_limit",
+			Help:      "Current adaptive concurrency limit.",
+		}, limit),
+		prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "concurrency_in_flight",
+			Help:      "RPCs holding a concurrency limiter slot.",
+		}, func() float64 { return float64(inFlight()) }),
+	)
+}
+
+func (m *Metrics) startRPC(method string) func(err error) {
+	start := time.Now()
+	inFlight := m.inFlight.WithLabelValues(method)
+	inFlight.Inc()
+	return func(err error) {
+		inFlight.Dec()
+		m.latency.WithLabelValues(method).Observe(time.Since(start).Seconds())
+		m.requests.WithLabelValues(method, status.Code(err).String()).Inc()
+	}
+}
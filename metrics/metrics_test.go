@@ -0,0 +1,88 @@
+package metrics
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"testing"
+
+	pb "github.com/kunal768/go-grpc-tc/proto/users/v2"
+	"github.com/kunal768/go-grpc-tc/user"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func scrape(t *testing.T, addr string) string {
+	resp, err := http.Get("http://" + addr + "/metrics")
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Contains(t, resp.Header.Get("Content-Type"), "text/plain")
+	body, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	return string(body)
+}
+
+func TestMetricsEndpoint(t *testing.T) {
+	m := New()
+	repo := m.InstrumentRepository(user.NewRepository(user.UserDB{
+		1: {ID: 1, FName: "John", Address: user.Address{City: "New York"}, Phone: 1234567890, Height: 180.5, Married: true},
+		2: {ID: 2, FName: "Jane", Address: user.Address{City: "Los Angeles"}, Phone: 9876543210, Height: 165.2, Married: false},
+	}))
+	service := user.NewService(repo)
+
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	srv := m.NewHTTPServer(lis.Addr().String())
+	go srv.Serve(lis)
+	t.Cleanup(func() { srv.Close() })
+
+	interceptor := m.UnaryInterceptor()
+	call := func(method string, req any, handler grpc.UnaryHandler) {
+		_, _ = interceptor(context.Background(), req, &grpc.UnaryServerInfo{FullMethod: method}, handler)
+	}
+
+	call("/users.v2.UserService/SearchUsers", &pb.SearchUsersRequest{City: "New York"}, func(ctx context.Context, req any) (any, error) {
+		assert.Contains(t, scrape(t, lis.Addr().String()), `usersvc_grpc_requests_in_flight{method="/users.v2.UserService/SearchUsers"} 1`)
+		return service.SearchUsers(ctx, req.(*pb.SearchUsersRequest))
+	})
+	call("/users.v2.UserService/GetUserByID", &pb.GetUserByIDRequest{Id: 0}, func(ctx context.Context, req any) (any, error) {
+		return service.GetUserByID(ctx, req.(*pb.GetUserByIDRequest))
+	})
+	call("/users.v2.UserService/GetUserByID", &pb.GetUserByIDRequest{Id: 1}, func(ctx context.Context, req any) (any, error) {
+		return nil, status.Error(codes.Unavailable, "down")
+	})
+
+	cancelled, cancel := context.WithCancel(context.Background())
+	cancel()
+	call("/users.v2.UserService/ListUsers", &pb.ListUsersRequest{}, func(ctx context.Context, req any) (any, error) {
+		return service.ListUsers(cancelled, req.(*pb.ListUsersRequest))
+	})
+
+	assert.Panics(t, func() {
+		call("/users.v2.UserService/DeleteUser", &pb.DeleteUserRequest{Id: 1}, func(ctx context.Context, req any) (any, error) {
+			panic("boom")
+		})
+	}, "panics pass through to the recovery interceptor")
+	m.PanicRecovered("/users.v2.UserService/SearchUsers")
+
+	body := scrape(t, lis.Addr().String())
+	assert.Contains(t, body, `usersvc_grpc_requests_total{code="OK",method="/users.v2.UserService/SearchUsers"} 1`)
+	assert.Contains(t, body, `usersvc_grpc_requests_total{code="InvalidArgument",method="/users.v2.UserService/GetUserByID"} 1`)
+	assert.Contains(t, body, `usersvc_grpc_requests_total{code="Unavailable",method="/users.v2.UserService/GetUserByID"} 1`)
+	assert.Contains(t, body, `usersvc_grpc_requests_total{code="Internal",method="/users.v2.UserService/DeleteUser"} 1`)
+	assert.Contains(t, body, `usersvc_grpc_request_duration_seconds_count{method="/users.v2.UserService/GetUserByID"} 2`)
+	assert.Contains(t, body, `usersvc_grpc_requests_in_flight{method="/users.v2.UserService/SearchUsers"} 0`)
+	assert.Contains(t, body, `usersvc_grpc_panics_total{method="/users.v2.UserService/SearchUsers"} 1`)
+	assert.Contains(t, body, `usersvc_repository_users 2`)
+	assert.Contains(t, body, `usersvc_repository_operations_total{operation="SearchUsers",result="ok"} 1`)
+	assert.Contains(t, body, `usersvc_repository_operations_total{operation="GetUserById",result="error"} 1`)
+	assert.Contains(t, body, `usersvc_repository_operations_total{operation="ListUsers",result="canceled"} 1`)
+	assert.Contains(t, body, `usersvc_grpc_requests_total{code="Canceled",method="/users.v2.UserService/ListUsers"} 1`)
+	assert.Contains(t, body, `usersvc_repository_scanned_users_sum{operation="SearchUsers"} 2`)
+	assert.Contains(t, body, "go_goroutines")
+}
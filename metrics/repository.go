@@ -0,0 +1,131 @@
+package metrics
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/kunal768/go-grpc-tc/user"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// repository records the latency and result of every call to the wrapped
+// repository and how many users searches and lists had to scan.
+type repository struct {
+	user.Repository
+	metrics *Metrics
+}
+
+// InstrumentRepository wraps repo and exports its user count, across all
+// tenants. Call it once per Metrics, on the repository itself rather than on
+// another wrapper.
+func (m *Metrics) InstrumentRepository(repo user.Repository) user.Repository {
+	m.registry.MustRegister(prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "repository_users",
+		Help:      "Users currently stored.",
+	}, func() float64 {
+		return float64(user.CountAllUsers(repo))
+	}))
+	return &repository{Repository: repo, metrics: m}
+}
+
+func (r *repository) observe(operation string, start time.Time, err error) {
+	result := "ok"
+	switch {
+	case errors.Is(err, context.Canceled):
+		result = "canceled"
+	case errors.Is(err, context.DeadlineExceeded):
+		result = "deadline_exceeded"
+	case err != nil:
+		result = "error"
+	}
+	r.metrics.repoOperations.WithLabelValues(operation, result).Inc()
+	r.metrics.repoLatency.WithLabelValues(operation).Observe(time.Since(start).Seconds())
+}
+
+func (r *repository) AddUser(ctx context.Context, u user.User) (user.User, error) {
+	start := time.Now()
+	u, err := r.Repository.AddUser(ctx, u)
+	r.observe("AddUser", start, err)
+	return u, err
+}
+
+func (r *repository) UpdateUser(ctx context.Context, u user.User) (user.User, error) {
+	start := time.Now()
+	u, err := r.Repository.UpdateUser(ctx, u)
+	r.observe("UpdateUser", start, err)
+	return u, err
+}
+
+func (r *repository) DeleteUser(ctx context.Context, Id user.UserId, revision int64) error {
+	start := time.Now()
+	err := r.Repository.DeleteUser(ctx, Id, revision)
+	r.observe("DeleteUser", start, err)
+	return err
+}
+
+func (r *repository) Transact(ctx context.Context, writes []user.Write) ([]user.User, error) {
+	start := time.Now()
+	users, err := r.Repository.Transact(ctx, writes)
+	r.observe("Transact", start, err)
+	return users, err
+}
+
+func (r *repository) GetUserById(ctx context.Context, Id user.UserId) (user.User, error) {
+	start := time.Now()
+	u, err := r.Repository.GetUserById(ctx, Id)
+	r.observe("GetUserById", start, err)
+	return u, err
+}
+
+func (r *repository) GetUsersById(ctx context.Context, Ids []user.UserId) ([]user.User, error) {
+	start := time.Now()
+	users, err := r.Repository.GetUsersById(ctx, Ids)
+	r.observe("GetUsersById", start, err)
+	return users, err
+}
+
+// SearchUsers and ListUsers both walk every stored user.
+func (r *repository) SearchUsers(ctx context.Context, data user.UsersSearchRequest) ([]user.User, error) {
+	start := time.Now()
+	scanned := r.Repository.CountUsers(ctx)
+	users, err := r.Repository.SearchUsers(ctx, data)
+	r.observe("SearchUsers", start, err)
+	if err == nil {
+		r.metrics.scanned.WithLabelValues("SearchUsers").Observe(float64(scanned))
+	}
+	return users, err
+}
+
+func (r *repository) ListUsers(ctx context.Context, pageSize int, page int) ([]user.User, error) {
+	start := time.Now()
+	scanned := r.Repository.CountUsers(ctx)
+	users, err := r.Repository.ListUsers(ctx, pageSize, page)
+	r.observe("ListUsers", start, err)
+	if err == nil {
+		r.metrics.scanned.WithLabelValues("ListUsers").Observe(float64(scanned))
+	}
+	return users, err
+}
+
+func (r *repository) GetUserHistory(ctx context.Context, Id user.UserId) ([]user.Version, error) {
+	start := time.Now()
+	versions, err := r.Repository.GetUserHistory(ctx, Id)
+	r.observe("GetUserHistory", start, err)
+	return versions, err
+}
+
+func (r *repository) GetUserByIdAsOf(ctx context.Context, Id user.UserId, t time.Time) (user.User, error) {
+	start := time.Now()
+	u, err := r.Repository.GetUserByIdAsOf(ctx, Id, t)
+	r.observe("GetUserByIdAsOf", start, err)
+	return u, err
+}
+
+func (r *repository) ListUsersAsOf(ctx context.Context, pageSize int, page int, t time.Time) ([]user.User, error) {
+	start := time.Now()
+	users, err := r.Repository.ListUsersAsOf(ctx, pageSize, page, t)
+	r.observe("ListUsersAsOf", start, err)
+	return users, err
+}
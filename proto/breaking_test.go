@@ -0,0 +1,280 @@
+package proto_test
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	usersv1 "github.com/kunal768/go-grpc-tc/proto/users/v1"
+	usersv2 "github.com/kunal768/go-grpc-tc/proto/users/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+	"google.golang.org/protobuf/types/descriptorpb"
+)
+
+var update = flag.Bool("update", false, "rewrite the descriptor snapshots in testdata after an intended change")
+
+// breakingChanges lists what in next breaks clients built against prev,
+// along the lines of buf's WIRE_JSON rules: deleted or renamed elements,
+// changed field numbers, types and labels, and changed method signatures.
+// With samePackage false the proto packages may differ, as long as
+// everything inside them lines up.
+func breakingChanges(prev, next protoreflect.FileDescriptor, samePackage bool) []string {
+	var changes []string
+	report := func(format string, args ...any) {
+		changes = append(changes, fmt.Sprintf(format, args...))
+	}
+	if samePackage && prev.Package() != next.Package() {
+		report("package changed from %q to %q", prev.Package(), next.Package())
+	}
+
+	for i := 0; i < prev.Messages().Len(); i++ {
+		compareMessages(prev.Messages().Get(i), next.Messages().ByName(prev.Messages().Get(i).Name()), report)
+	}
+	for i := 0; i < prev.Enums().Len(); i++ {
+		compareEnums(prev.Enums().Get(i), next.Enums().ByName(prev.Enums().Get(i).Name()), report)
+	}
+
+	for i := 0; i < prev.Services().Len(); i++ {
+		prevService := prev.Services().Get(i)
+		nextService := next.Services().ByName(prevService.Name())
+		if nextService == nil {
+			report("service %s deleted", prevService.Name())
+			continue
+		}
+		for j := 0; j < prevService.Methods().Len(); j++ {
+			prevMethod := prevService.Methods().Get(j)
+			nextMethod := nextService.Methods().ByName(prevMethod.Name())
+			name := fmt.Sprintf("%s.%s", prevService.Name(), prevMethod.Name())
+			switch {
+			case nextMethod == nil:
+				report("method %s deleted", name)
+			case prevMethod.Input().Name() != nextMethod.Input().Name():
+				report("method %s request changed from %s to %s", name, prevMethod.Input().Name(), nextMethod.Input().Name())
+			case prevMethod.Output().Name() != nextMethod.Output().Name():
+				report("method %s response changed from %s to %s", name, prevMethod.Output().Name(), nextMethod.Output().Name())
+			case prevMethod.IsStreamingClient() != nextMethod.IsStreamingClient() || prevMethod.IsStreamingServer() != nextMethod.IsStreamingServer():
+				report("method %s streaming changed", name)
+			}
+		}
+	}
+	return changes
+}
+
+func compareMessages(prev, next protoreflect.MessageDescriptor, report func(string, ...any)) {
+	if next == nil {
+		report("message %s deleted", prev.Name())
+		return
+	}
+	for i := 0; i < prev.Fields().Len(); i++ {
+		prevField := prev.Fields().Get(i)
+		name := fmt.Sprintf("%s.%s", prev.Name(), prevField.Name())
+		nextField := next.Fields().ByNumber(prevField.Number())
+		switch {
+		case nextField == nil:
+			if !next.ReservedRanges().Has(prevField.Number()) {
+				report("field %s (%d) deleted without reserving its number", name, prevField.Number())
+			}
+		case nextField.Name() != prevField.Name():
+			report("field %s (%d) renamed to %s", name, prevField.Number(), nextField.Name())
+		case wireType(nextField) != wireType(prevField):
+			report("field %s type changed from %s to %s", name, typeName(prevField), typeName(nextField))
+		case nextField.Cardinality() != prevField.Cardinality() && (nextField.IsList() || prevField.IsList()):
+			report("field %s changed between repeated and singular", name)
+		case nextField.ContainingOneof() != nil && prevField.ContainingOneof() == nil && !nextField.HasOptionalKeyword():
+			report("field %s moved into a oneof", name)
+		}
+	}
+	for i := 0; i < prev.Messages().Len(); i++ {
+		compareMessages(prev.Messages().Get(i), next.Messages().ByName(prev.Messages().Get(i).Name()), report)
+	}
+	for i := 0; i < prev.Enums().Len(); i++ {
+		compareEnums(prev.Enums().Get(i), next.Enums().ByName(prev.Enums().Get(i).Name()), report)
+	}
+}
+
+func compareEnums(prev, next protoreflect.EnumDescriptor, report func(string, ...any)) {
+	if next == nil {
+		report("enum %s deleted", prev.Name())
+		return
+	}
+	for i := 0; i < prev.Values().Len(); i++ {
+		value := prev.Values().Get(i)
+		if next.Values().ByNumber(value.Number()) == nil && !next.ReservedRanges().Has(value.Number()) {
+			report("enum value %s.%s deleted without reserving its number", prev.Name(), value.Name())
+		}
+	}
+}
+
+// wireType groups the field kinds that decode each other's encoding, e.g.
+// int32 widened to int64.
+func wireType(fd protoreflect.FieldDescriptor) string {
+	switch fd.Kind() {
+	case protoreflect.Int32Kind, protoreflect.Int64Kind, protoreflect.Uint32Kind, protoreflect.Uint64Kind, protoreflect.BoolKind:
+		return "varint"
+	case protoreflect.Sint32Kind, protoreflect.Sint64Kind:
+		return "zigzag"
+	case protoreflect.Fixed32Kind, protoreflect.Sfixed32Kind:
+		return "fixed32"
+	case protoreflect.Fixed64Kind, protoreflect.Sfixed64Kind:
+		return "fixed64"
+	}
+	return typeName(fd)
+}
+
+// typeName is the kind of fd, with the message or enum name relative to its
+// package so that moving packages is not a type change.
+func typeName(fd protoreflect.FieldDescriptor) string {
+	switch {
+	case fd.Message() != nil:
+		return "message " + relativeName(fd.Message())
+	case fd.Enum() != nil:
+		return "enum " + relativeName(fd.Enum())
+	}
+	return fd.Kind().String()
+}
+
+func relativeName(d protoreflect.Descriptor) string {
+	name := string(d.FullName())
+	if pkg := string(d.ParentFile().Package()); pkg != "" && !strings.HasPrefix(name, "google.protobuf.") {
+		name = strings.TrimPrefix(name, pkg+".")
+	}
+	return name
+}
+
+// snapshot loads the descriptor committed in testdata/name, or with -update
+// first writes current there.
+func snapshot(t *testing.T, name string, current protoreflect.FileDescriptor) protoreflect.FileDescriptor {
+	path := filepath.Join("testdata", name)
+	if *update && current != nil {
+		set := &descriptorpb.FileDescriptorSet{File: []*descriptorpb.FileDescriptorProto{protodesc.ToFileDescriptorProto(current)}}
+		data, err := proto.MarshalOptions{Deterministic: true}.Marshal(set)
+		require.NoError(t, err)
+		require.NoError(t, os.WriteFile(path, data, 0o644))
+	}
+
+	data, err := os.ReadFile(path)
+	require.NoError(t, err, "run go test ./proto -update to create the snapshot")
+	var set descriptorpb.FileDescriptorSet
+	require.NoError(t, proto.Unmarshal(data, &set))
+	require.Len(t, set.File, 1)
+	// resolve imports such as timestamp.proto from the linked in registry
+	fd, err := protodesc.NewFile(set.File[0], protoregistry.GlobalFiles)
+	require.NoError(t, err)
+	return fd
+}
+
+func TestBreakingChanges(t *testing.T) {
+	for name, current := range map[string]protoreflect.FileDescriptor{
+		"users_v1.binpb": usersv1.File_proto_users_v1_users_proto,
+		"users_v2.binpb": usersv2.File_proto_users_v2_users_proto,
+	} {
+		t.Run(name, func(t *testing.T) {
+			assert.Empty(t, breakingChanges(snapshot(t, name, current), current, true))
+		})
+	}
+
+	// The unpackaged UserService is still served with the users.v1 handlers.
+	t.Run("users.v1 is wire compatible with the unpackaged UserService", func(t *testing.T) {
+		legacy := snapshot(t, "userservice.binpb", nil)
+		assert.Empty(t, breakingChanges(legacy, usersv1.File_proto_users_v1_users_proto, false))
+	})
+}
+
+func TestBreakingChanges_Detects(t *testing.T) {
+	prev := usersv2.File_proto_users_v2_users_proto
+	edit := func(change func(*descriptorpb.FileDescriptorProto)) protoreflect.FileDescriptor {
+		fdp := protodesc.ToFileDescriptorProto(prev)
+		change(fdp)
+		// a distinct path keeps it apart from the registered original
+		fdp.Name = proto.String("edited.proto")
+		next, err := protodesc.NewFile(fdp, protoregistry.GlobalFiles)
+		require.NoError(t, err)
+		return next
+	}
+	message := func(fdp *descriptorpb.FileDescriptorProto, name string) *descriptorpb.DescriptorProto {
+		for _, m := range fdp.MessageType {
+			if m.GetName() == name {
+				return m
+			}
+		}
+		t.Fatalf("no message %s", name)
+		return nil
+	}
+	field := func(m *descriptorpb.DescriptorProto, name string) *descriptorpb.FieldDescriptorProto {
+		for _, f := range m.Field {
+			if f.GetName() == name {
+				return f
+			}
+		}
+		t.Fatalf("no field %s", name)
+		return nil
+	}
+
+	tests := []struct {
+		name   string
+		change func(*descriptorpb.FileDescriptorProto)
+		want   string
+	}{
+		{"package", func(fdp *descriptorpb.FileDescriptorProto) {
+			fdp.Package = proto.String("users.v3")
+			// keep the renamed types resolvable
+			for _, m := range fdp.MessageType {
+				for _, f := range m.Field {
+					if strings.HasPrefix(f.GetTypeName(), ".users.v2.") {
+						f.TypeName = proto.String(strings.Replace(f.GetTypeName(), ".users.v2.", ".users.v3.", 1))
+					}
+				}
+			}
+			for _, s := range fdp.Service {
+				for _, m := range s.Method {
+					m.InputType = proto.String(strings.Replace(m.GetInputType(), ".users.v2.", ".users.v3.", 1))
+					m.OutputType = proto.String(strings.Replace(m.GetOutputType(), ".users.v2.", ".users.v3.", 1))
+				}
+			}
+		}, `package changed from "users.v2" to "users.v3"`},
+		{"deleted field", func(fdp *descriptorpb.FileDescriptorProto) {
+			m := message(fdp, "User")
+			m.Field = m.Field[1:]
+		}, "field User.id (1) deleted without reserving its number"},
+		{"renamed field", func(fdp *descriptorpb.FileDescriptorProto) {
+			field(message(fdp, "User"), "fname").Name = proto.String("first_name")
+		}, "field User.fname (3) renamed to first_name"},
+		{"changed type", func(fdp *descriptorpb.FileDescriptorProto) {
+			field(message(fdp, "User"), "phone").Type = descriptorpb.FieldDescriptorProto_TYPE_STRING.Enum()
+		}, "field User.phone type changed from int64 to string"},
+		{"repeated", func(fdp *descriptorpb.FileDescriptorProto) {
+			field(message(fdp, "User"), "email").Label = descriptorpb.FieldDescriptorProto_LABEL_REPEATED.Enum()
+		}, "field User.email changed between repeated and singular"},
+		{"deleted method", func(fdp *descriptorpb.FileDescriptorProto) {
+			fdp.Service[0].Method = fdp.Service[0].Method[1:]
+		}, "method UserService.GetUserByID deleted"},
+		{"changed request", func(fdp *descriptorpb.FileDescriptorProto) {
+			fdp.Service[0].Method[0].InputType = proto.String(".users.v2.GetUsersByIDsRequest")
+		}, "method UserService.GetUserByID request changed from GetUserByIDRequest to GetUsersByIDsRequest"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Contains(t, breakingChanges(prev, edit(tt.change), true), tt.want)
+		})
+	}
+
+	t.Run("widening and reserved deletions are compatible", func(t *testing.T) {
+		next := edit(func(fdp *descriptorpb.FileDescriptorProto) {
+			m := message(fdp, "GetUserByIDRequest")
+			m.Field[0].Type = descriptorpb.FieldDescriptorProto_TYPE_UINT64.Enum()
+			user := message(fdp, "User")
+			last := user.Field[len(user.Field)-1]
+			user.Field = user.Field[:len(user.Field)-1]
+			user.ReservedRange = append(user.ReservedRange, &descriptorpb.DescriptorProto_ReservedRange{Start: last.Number, End: proto.Int32(last.GetNumber() + 1)})
+		})
+		assert.Empty(t, breakingChanges(prev, next, true))
+	})
+}
@@ -2,9 +2,12 @@
 // versions:
 // - protoc-gen-go-grpc v1.4.0
 // - protoc             v5.27.1
-// source: proto/userservice.proto
+// source: proto/users/v1/users.proto
 
-package user
+// users.v1 is the original user API, wire compatible with the unpackaged
+// UserService it replaces. New fields go to users.v2.
+
+package usersv1
 
 import (
 	context "context"
@@ -19,11 +22,12 @@ import (
 const _ = grpc.SupportPackageIsVersion8
 
 const (
-	UserService_GetUserByID_FullMethodName   = "/UserService/GetUserByID"
-	UserService_GetUsersByIDs_FullMethodName = "/UserService/GetUsersByIDs"
-	UserService_SearchUsers_FullMethodName   = "/UserService/SearchUsers"
-	UserService_AddUser_FullMethodName       = "/UserService/AddUser"
-	UserService_ListUsers_FullMethodName     = "/UserService/ListUsers"
+	UserService_GetUserByID_FullMethodName   = "/users.v1.UserService/GetUserByID"
+	UserService_GetUsersByIDs_FullMethodName = "/users.v1.UserService/GetUsersByIDs"
+	UserService_SearchUsers_FullMethodName   = "/users.v1.UserService/SearchUsers"
+	UserService_AddUser_FullMethodName       = "/users.v1.UserService/AddUser"
+	UserService_ListUsers_FullMethodName     = "/users.v1.UserService/ListUsers"
+	UserService_CreateUser_FullMethodName    = "/users.v1.UserService/CreateUser"
 )
 
 // UserServiceClient is the client API for UserService service.
@@ -35,6 +39,7 @@ type UserServiceClient interface {
 	SearchUsers(ctx context.Context, in *SearchRequest, opts ...grpc.CallOption) (*UsersResponse, error)
 	AddUser(ctx context.Context, in *User, opts ...grpc.CallOption) (*UserResponse, error)
 	ListUsers(ctx context.Context, in *ListUsersRequest, opts ...grpc.CallOption) (*UsersResponse, error)
+	CreateUser(ctx context.Context, in *CreateUserRequest, opts ...grpc.CallOption) (*UserResponse, error)
 }
 
 type userServiceClient struct {
@@ -95,6 +100,16 @@ func (c *userServiceClient) ListUsers(ctx context.Context, in *ListUsersRequest,
 	return out, nil
 }
 
+func (c *userServiceClient) CreateUser(ctx context.Context, in *CreateUserRequest, opts ...grpc.CallOption) (*UserResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(UserResponse)
+	err := c.cc.Invoke(ctx, UserService_CreateUser_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
 // UserServiceServer is the server API for UserService service.
 // All implementations must embed UnimplementedUserServiceServer
 // for forward compatibility
@@ -104,6 +119,7 @@ type UserServiceServer interface {
 	SearchUsers(context.Context, *SearchRequest) (*UsersResponse, error)
 	AddUser(context.Context, *User) (*UserResponse, error)
 	ListUsers(context.Context, *ListUsersRequest) (*UsersResponse, error)
+	CreateUser(context.Context, *CreateUserRequest) (*UserResponse, error)
 	mustEmbedUnimplementedUserServiceServer()
 }
 
@@ -126,6 +142,9 @@ func (UnimplementedUserServiceServer) AddUser(context.Context, *User) (*UserResp
 func (UnimplementedUserServiceServer) ListUsers(context.Context, *ListUsersRequest) (*UsersResponse, error) {
 	return nil, status.Errorf(codes.Unimplemented, "method ListUsers not implemented")
 }
+func (UnimplementedUserServiceServer) CreateUser(context.Context, *CreateUserRequest) (*UserResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method CreateUser not implemented")
+}
 func (UnimplementedUserServiceServer) mustEmbedUnimplementedUserServiceServer() {}
 
 // UnsafeUserServiceServer may be embedded to opt out of forward compatibility for this service.
@@ -229,11 +248,29 @@ func _UserService_ListUsers_Handler(srv interface{}, ctx context.Context, dec fu
 	return interceptor(ctx, in, info, handler)
 }
 
+func _UserService_CreateUser_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(CreateUserRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(UserServiceServer).CreateUser(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: UserService_CreateUser_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(UserServiceServer).CreateUser(ctx, req.(*CreateUserRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
 // UserService_ServiceDesc is the grpc.ServiceDesc for UserService service.
 // It's only intended for direct use with grpc.RegisterService,
 // and not to be introspected or modified (even as a copy)
 var UserService_ServiceDesc = grpc.ServiceDesc{
-	ServiceName: "UserService",
+	ServiceName: "users.v1.UserService",
 	HandlerType: (*UserServiceServer)(nil),
 	Methods: []grpc.MethodDesc{
 		{
@@ -256,7 +293,11 @@ var UserService_ServiceDesc = grpc.ServiceDesc{
 			MethodName: "ListUsers",
 			Handler:    _UserService_ListUsers_Handler,
 		},
+		{
+			MethodName: "CreateUser",
+			Handler:    _UserService_CreateUser_Handler,
+		},
 	},
 	Streams:  []grpc.StreamDesc{},
-	Metadata: "proto/userservice.proto",
+	Metadata: "proto/users/v1/users.proto",
 }
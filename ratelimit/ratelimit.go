@@ -0,0 +1,306 @@
+package ratelimit
+
+import (
+	"context"
+	"math"
+	"net"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/kunal768/go-grpc-tc/auth"
+	"github.com/kunal768/go-grpc-tc/tenant"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/durationpb"
+)
+
+// Limit is a token bucket refilled at Rate tokens per second up to Burst,
+// plus an optional number of requests per UTC day. A zero Rate or
+// DailyQuota does not limit.
+type Limit struct {
+	Rate       float64
+	Burst      int
+	DailyQuota int64
+}
+
+type Options struct {
+	// Default applies to every method without an entry in Methods. Methods
+	// with an entry get a bucket and quota of their own per client.
+	Default Limit
+	Methods map[string]Limit
+	// Tenants limits all calls of a tenant together, on top of the limits
+	// of each client.
+	Tenants map[string]Limit
+	// ExemptMethods are full method names, or prefixes ending in "*", that
+	// are never limited.
+	ExemptMethods []string
+	// Now is the clock, time.Now if nil.
+	Now func() time.Time
+}
+
+// Limiter tracks the buckets and quotas of every client. A client is the
+// authenticated principal, or the peer address for anonymous callers.
+type Limiter struct {
+	opts Options
+
+	mu        sync.Mutex
+	clients   map[string]map[string]*bucket
+	lastSweep time.Time
+}
+
+type bucket struct {
+	limit     Limit
+	tokens    float64
+	updated   time.Time
+	day       time.Time
+	quotaUsed int64
+}
+
+// sharedMethod keys the bucket of methods using the default limit.
+const sharedMethod = "*"
+
+func New(opts Options) *Limiter {
+	if opts.Now == nil {
+		opts.Now = time.Now
+	}
+	return &Limiter{opts: opts, clients: map[string]map[string]*bucket{}}
+}
+
+// Client returns the key requests on ctx are limited under.
+func Client(ctx context.Context) string {
+	if p, ok := auth.FromContext(ctx); ok {
+		return "principal:" + p.Subject
+	}
+	if p, ok := peer.FromContext(ctx); ok && p.Addr != nil {
+		host, _, err := net.SplitHostPort(p.Addr.String())
+		if err != nil {
+			host = p.Addr.String()
+		}
+		return "peer:" + host
+	}
+	return "unknown"
+}
+
+func (l *Limiter) exempt(method string) bool {
+	for _, pattern := range l.opts.ExemptMethods {
+		if prefix, ok := strings.CutSuffix(pattern, "*"); ok {
+			if strings.HasPrefix(method, prefix) {
+				return true
+			}
+		} else if method == pattern {
+			return true
+		}
+	}
+	return false
+}
+
+// Allow takes a token for one call of method by client. When the call is
+// limited it returns false and how long the client should wait.
+func (l *Limiter) Allow(client, method string) (bool, time.Duration) {
+	if l.exempt(method) {
+		return true, 0
+	}
+	limit, ok := l.opts.Methods[method]
+	if !ok {
+		method, limit = sharedMethod, l.opts.Default
+	}
+	return l.take(client, method, limit)
+}
+
+// refund gives back the token and quota Allow took from client for a call
+// of method that is not made after all.
+func (l *Limiter) refund(client, method string) {
+	if l.exempt(method) {
+		return
+	}
+	if _, ok := l.opts.Methods[method]; !ok {
+		method = sharedMethod
+	}
+	now := l.opts.Now()
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	b, ok := l.clients[client][method]
+	if !ok {
+		return
+	}
+	b.refill(now)
+	if b.limit.Rate > 0 {
+		b.tokens = math.Min(float64(b.limit.Burst), b.tokens+1)
+	}
+	if b.quotaUsed > 0 {
+		b.quotaUsed--
+	}
+}
+
+// AllowTenant takes a token for one call of method by any client of a
+// tenant. Tenants without a limit are not limited.
+func (l *Limiter) AllowTenant(name, method string) (bool, time.Duration) {
+	limit, ok := l.opts.Tenants[name]
+	if !ok || l.exempt(method) {
+		return true, 0
+	}
+	return l.take(tenantClient(name), sharedMethod, limit)
+}
+
+// tenantClient is the client key the limit of a tenant is tracked under.
+func tenantClient(name string) string {
+	return "tenant:" + name
+}
+
+func (l *Limiter) take(client, method string, limit Limit) (bool, time.Duration) {
+	now := l.opts.Now()
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.sweep(now)
+
+	buckets, ok := l.clients[client]
+	if !ok {
+		buckets = map[string]*bucket{}
+		l.clients[client] = buckets
+	}
+	b, ok := buckets[method]
+	if !ok {
+		b = &bucket{limit: limit, tokens: float64(limit.Burst), updated: now, day: day(now)}
+		buckets[method] = b
+	}
+	b.refill(now)
+
+	if b.limit.DailyQuota > 0 && b.quotaUsed >= b.limit.DailyQuota {
+		return false, b.day.AddDate(0, 0, 1).Sub(now)
+	}
+	if b.limit.Rate > 0 {
+		if b.tokens < 1 {
+			wait := time.Duration((1 - b.tokens) / b.limit.Rate * float64(time.Second))
+			return false, wait
+		}
+		b.tokens--
+	}
+	b.quotaUsed++
+	return true, 0
+}
+
+func (b *bucket) refill(now time.Time) {
+	if elapsed := now.Sub(b.updated).Seconds(); elapsed > 0 {
+		b.tokens = math.Min(float64(b.limit.Burst), b.tokens+elapsed*b.limit.Rate)
+		b.updated = now
+	}
+	if today := day(now); today.After(b.day) {
+		b.day, b.quotaUsed = today, 0
+	}
+}
+
+// idle reports whether forgetting the bucket changes nothing: it is full and
+// has no quota used today.
+func (b *bucket) idle(now time.Time) bool {
+	b.refill(now)
+	return b.tokens >= float64(b.limit.Burst) && b.quotaUsed == 0
+}
+
+// sweep forgets idle clients, at most once a minute.
+func (l *Limiter) sweep(now time.Time) {
+	if now.Sub(l.lastSweep) < time.Minute {
+		return
+	}
+	l.lastSweep = now
+	for client, buckets := range l.clients {
+		for method, b := range buckets {
+			if b.idle(now) {
+				delete(buckets, method)
+			}
+		}
+		if len(buckets) == 0 {
+			delete(l.clients, client)
+		}
+	}
+}
+
+func day(t time.Time) time.Time {
+	return t.UTC().Truncate(24 * time.Hour)
+}
+
+type MethodUsage struct {
+	// Method is the full method name, or "*" for the shared default limit.
+	Method    string
+	Tokens    float64
+	Limit     Limit
+	QuotaUsed int64
+}
+
+type ClientUsage struct {
+	Client  string
+	Methods []MethodUsage
+}
+
+// Usage returns the current state of client, or of every tracked client if
+// client is empty, sorted by client and method.
+func (l *Limiter) Usage(client string) []ClientUsage {
+	now := l.opts.Now()
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	var usage []ClientUsage
+	for name, buckets := range l.clients {
+		if client != "" && name != client {
+			continue
+		}
+		c := ClientUsage{Client: name}
+		for method, b := range buckets {
+			b.refill(now)
+			c.Methods = append(c.Methods, MethodUsage{Method: method, Tokens: b.tokens, Limit: b.limit, QuotaUsed: b.quotaUsed})
+		}
+		sort.Slice(c.Methods, func(i, j int) bool { return c.Methods[i].Method < c.Methods[j].Method })
+		usage = append(usage, c)
+	}
+	sort.Slice(usage, func(i, j int) bool { return usage[i].Client < usage[j].Client })
+	return usage
+}
+
+// QuotaReset is when daily quotas are next reset.
+func (l *Limiter) QuotaReset() time.Time {
+	return day(l.opts.Now()).AddDate(0, 0, 1)
+}
+
+func (l *Limiter) check(ctx context.Context, method string) error {
+	client := Client(ctx)
+	ok, wait := l.Allow(client, method)
+	if name, hasTenant := tenant.FromContext(ctx); ok && hasTenant {
+		// a call the tenant limit rejects does not use up the client's budget
+		if ok, wait = l.AllowTenant(name, method); !ok {
+			l.refund(client, method)
+		}
+	}
+	if ok {
+		return nil
+	}
+	st, err := status.New(codes.ResourceExhausted, "rate limit exceeded").WithDetails(&errdetails.RetryInfo{
+		RetryDelay: durationpb.New(wait),
+	})
+	if err != nil {
+		return status.Error(codes.ResourceExhausted, "rate limit exceeded")
+	}
+	return st.Err()
+}
+
+func (l *Limiter) UnaryInterceptor() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		if err := l.check(ctx, info.FullMethod); err != nil {
+			return nil, err
+		}
+		return handler(ctx, req)
+	}
+}
+
+func (l *Limiter) StreamInterceptor() grpc.StreamServerInterceptor {
+	return func(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		if err := l.check(ss.Context(), info.FullMethod); err != nil {
+			return err
+		}
+		return handler(srv, ss)
+	}
+}
@@ -0,0 +1,171 @@
+package ratelimit
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/kunal768/go-grpc-tc/auth"
+	"github.com/kunal768/go-grpc-tc/tenant"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+type clock struct{ now time.Time }
+
+func (c *clock) Now() time.Time { return c.now }
+
+func TestLimiter(t *testing.T) {
+	newLimiter := func() (*Limiter, *clock) {
+		c := &clock{now: time.Date(2024, 6, 1, 23, 0, 0, 0, time.UTC)}
+		return New(Options{
+			Default: Limit{Rate: 1, Burst: 2},
+			Methods: map[string]Limit{
+				"/UserService/ListUsers": {Rate: 10, Burst: 10, DailyQuota: 3},
+			},
+			ExemptMethods: []string{"/grpc.health.v1.Health/*"},
+			Now:           c.Now,
+		}), c
+	}
+
+	t.Run("Token bucket", func(t *testing.T) {
+		l, c := newLimiter()
+		for i := 0; i < 2; i++ {
+			ok, _ := l.Allow("a", "/UserService/GetUserByID")
+			require.True(t, ok)
+		}
+		ok, wait := l.Allow("a", "/UserService/SearchUsers")
+		assert.False(t, ok, "methods without a limit share the default bucket")
+		assert.Equal(t, time.Second, wait)
+
+		ok, _ = l.Allow("b", "/UserService/GetUserByID")
+		assert.True(t, ok, "clients are limited separately")
+
+		c.now = c.now.Add(500 * time.Millisecond)
+		ok, wait = l.Allow("a", "/UserService/GetUserByID")
+		assert.False(t, ok)
+		assert.Equal(t, 500*time.Millisecond, wait)
+
+		c.now = c.now.Add(500 * time.Millisecond)
+		ok, _ = l.Allow("a", "/UserService/GetUserByID")
+		assert.True(t, ok)
+	})
+
+	t.Run("Daily quota", func(t *testing.T) {
+		l, c := newLimiter()
+		for i := 0; i < 3; i++ {
+			ok, _ := l.Allow("a", "/UserService/ListUsers")
+			require.True(t, ok)
+		}
+		ok, wait := l.Allow("a", "/UserService/ListUsers")
+		assert.False(t, ok)
+		assert.Equal(t, time.Hour, wait, "until the next UTC midnight")
+
+		ok, _ = l.Allow("a", "/UserService/GetUserByID")
+		assert.True(t, ok, "the quota is per method")
+
+		usage := l.Usage("a")
+		require.Len(t, usage, 1)
+		require.Len(t, usage[0].Methods, 2)
+		assert.Equal(t, "*", usage[0].Methods[0].Method)
+		assert.Equal(t, "/UserService/ListUsers", usage[0].Methods[1].Method)
+		assert.EqualValues(t, 3, usage[0].Methods[1].QuotaUsed)
+		assert.EqualValues(t, 3, usage[0].Methods[1].Limit.DailyQuota)
+
+		c.now = c.now.Add(time.Hour)
+		ok, _ = l.Allow("a", "/UserService/ListUsers")
+		assert.True(t, ok)
+		assert.Equal(t, c.now.AddDate(0, 0, 1), l.QuotaReset())
+	})
+
+	t.Run("Exempt methods", func(t *testing.T) {
+		l, _ := newLimiter()
+		for i := 0; i < 10; i++ {
+			ok, _ := l.Allow("a", "/grpc.health.v1.Health/Check")
+			require.True(t, ok)
+		}
+		assert.Empty(t, l.Usage(""))
+	})
+
+	t.Run("Forgets idle clients", func(t *testing.T) {
+		l, c := newLimiter()
+		l.Allow("a", "/UserService/GetUserByID")
+		c.now = c.now.Add(2 * time.Hour)
+		l.Allow("b", "/UserService/GetUserByID")
+		usage := l.Usage("")
+		require.Len(t, usage, 1)
+		assert.Equal(t, "b", usage[0].Client)
+	})
+}
+
+func TestTenantLimit(t *testing.T) {
+	l := New(Options{
+		Default: Limit{Rate: 10, Burst: 10},
+		Tenants: map[string]Limit{"acme": {Rate: 1, Burst: 2}},
+	})
+	interceptor := l.UnaryInterceptor()
+	info := &grpc.UnaryServerInfo{FullMethod: "/UserService/ListUsers"}
+	handler := func(ctx context.Context, req any) (any, error) { return nil, nil }
+	call := func(subject, name string) error {
+		ctx := tenant.NewContext(auth.NewContext(context.Background(), auth.Principal{Subject: subject}), name)
+		_, err := interceptor(ctx, nil, info, handler)
+		return err
+	}
+
+	require.NoError(t, call("a", "acme"))
+	require.NoError(t, call("b", "acme"))
+	assert.Equal(t, codes.ResourceExhausted, status.Code(call("c", "acme")), "the clients of a tenant share its limit")
+	assert.NoError(t, call("c", "globex"), "tenants without a limit are not limited")
+}
+
+func TestTenantLimit_Refund(t *testing.T) {
+	l := New(Options{
+		Default: Limit{Rate: 1, Burst: 2, DailyQuota: 5},
+		Tenants: map[string]Limit{"acme": {Rate: 1, Burst: 1}},
+		Now:     (&clock{now: time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)}).Now,
+	})
+	interceptor := l.UnaryInterceptor()
+	info := &grpc.UnaryServerInfo{FullMethod: "/UserService/ListUsers"}
+	handler := func(ctx context.Context, req any) (any, error) { return nil, nil }
+	ctx := tenant.NewContext(auth.NewContext(context.Background(), auth.Principal{Subject: "a"}), "acme")
+
+	_, err := interceptor(ctx, nil, info, handler)
+	require.NoError(t, err)
+	_, err = interceptor(ctx, nil, info, handler)
+	assert.Equal(t, codes.ResourceExhausted, status.Code(err))
+
+	usage := l.Usage("principal:a")
+	require.Len(t, usage, 1)
+	assert.Equal(t, []MethodUsage{{Method: "*", Tokens: 1, Limit: Limit{Rate: 1, Burst: 2, DailyQuota: 5}, QuotaUsed: 1}}, usage[0].Methods, "the rejected call is refunded")
+}
+
+func TestUnaryInterceptor(t *testing.T) {
+	l := New(Options{Default: Limit{Rate: 1, Burst: 1}})
+	interceptor := l.UnaryInterceptor()
+	info := &grpc.UnaryServerInfo{FullMethod: "/UserService/ListUsers"}
+	handler := func(ctx context.Context, req any) (any, error) { return nil, nil }
+
+	ctx := peer.NewContext(context.Background(), &peer.Peer{Addr: &net.TCPAddr{IP: net.IPv4(10, 0, 0, 1), Port: 5000}})
+	assert.Equal(t, "peer:10.0.0.1", Client(ctx))
+	_, err := interceptor(ctx, nil, info, handler)
+	require.NoError(t, err)
+
+	_, err = interceptor(ctx, nil, info, handler)
+	st := status.Convert(err)
+	assert.Equal(t, codes.ResourceExhausted, st.Code())
+	require.Len(t, st.Details(), 1)
+	retry, ok := st.Details()[0].(*errdetails.RetryInfo)
+	require.True(t, ok)
+	assert.Positive(t, retry.RetryDelay.AsDuration())
+
+	authenticated := auth.NewContext(ctx, auth.Principal{Subject: "ci"})
+	assert.Equal(t, "principal:ci", Client(authenticated))
+	_, err = interceptor(authenticated, nil, info, handler)
+	assert.NoError(t, err, "principals are limited apart from their peer address")
+}
@@ -0,0 +1,129 @@
+package server
+
+import (
+	"context"
+	"net"
+	"time"
+
+	pb "github.com/kunal768/go-grpc-tc/proto/admin/v1"
+	usersv1 "github.com/kunal768/go-grpc-tc/proto/users/v1"
+	usersv2 "github.com/kunal768/go-grpc-tc/proto/users/v2"
+	"github.com/kunal768/go-grpc-tc/user"
+	"github.com/kunal768/go-grpc-tc/utility"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/reflection"
+)
+
+type Options struct {
+	Reflection    bool
+	ServerOptions []grpc.ServerOption
+	// Admin, if set, is served as AdminService.
+	Admin pb.AdminServiceServer
+}
+
+// LegacyUserServiceName is the unpackaged UserService that predates users.v1.
+// It is served with the users.v1 handlers, its messages are the same on the
+// wire.
+const LegacyUserServiceName = "UserService"
+
+// Server is the gRPC server for UserService together with the standard
+// grpc.health.v1 service. Health reports NOT_SERVING until SetServing(true)
+// is called, so the repository can be loaded while the listener is up.
+type Server struct {
+	grpcServer *grpc.Server
+	health     *health.Server
+}
+
+func New(service user.Service, opts Options) *Server {
+	s := &Server{
+		grpcServer: grpc.NewServer(opts.ServerOptions...),
+		health:     health.NewServer(),
+	}
+
+	usersv2.RegisterUserServiceServer(s.grpcServer, user.NewUserServiceServer(service))
+	v1 := user.NewUserServiceServerV1(service)
+	usersv1.RegisterUserServiceServer(s.grpcServer, v1)
+	legacy := usersv1.UserService_ServiceDesc
+	legacy.ServiceName = LegacyUserServiceName
+	s.grpcServer.RegisterService(&legacy, v1)
+	healthpb.RegisterHealthServer(s.grpcServer, s.health)
+	if opts.Admin != nil {
+		pb.RegisterAdminServiceServer(s.grpcServer, opts.Admin)
+	}
+	if opts.Reflection {
+		reflection.Register(s.grpcServer)
+	}
+
+	s.SetServing(false)
+	return s
+}
+
+// SetServing updates the health status of the server as a whole ("") and of
+// every registered service.
+func (s *Server) SetServing(serving bool) {
+	status := healthpb.HealthCheckResponse_NOT_SERVING
+	if serving {
+		status = healthpb.HealthCheckResponse_SERVING
+	}
+
+	s.health.SetServingStatus("", status)
+	for name := range s.grpcServer.GetServiceInfo() {
+		if name == healthpb.Health_ServiceDesc.ServiceName {
+			continue
+		}
+		s.health.SetServingStatus(name, status)
+	}
+}
+
+func (s *Server) Serve(lis net.Listener) error {
+	return s.grpcServer.Serve(lis)
+}
+
+// Run serves on lis until ctx is done and then shuts the server down,
+// giving in-flight RPCs up to drainTimeout to finish.
+func (s *Server) Run(ctx context.Context, lis net.Listener, drainTimeout time.Duration) error {
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- s.grpcServer.Serve(lis)
+	}()
+
+	select {
+	case err := <-errCh:
+		s.health.Shutdown()
+		return err
+	case <-ctx.Done():
+	}
+
+	shutdownErr := s.Shutdown(drainTimeout)
+	if err := <-errCh; err != nil {
+		return err
+	}
+	return shutdownErr
+}
+
+// Shutdown flips every service to NOT_SERVING, stops accepting new
+// connections and waits for in-flight RPCs. RPCs still running after
+// drainTimeout are cancelled and utility.ErrDrainTimeout is returned.
+func (s *Server) Shutdown(drainTimeout time.Duration) error {
+	s.health.Shutdown()
+
+	done := make(chan struct{})
+	go func() {
+		s.grpcServer.GracefulStop()
+		close(done)
+	}()
+
+	timer := time.NewTimer(drainTimeout)
+	defer timer.Stop()
+
+	select {
+	case <-done:
+		return nil
+	case <-timer.C:
+		s.grpcServer.Stop()
+		<-done
+		return utility.ErrDrainTimeout
+	}
+}
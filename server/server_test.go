@@ -0,0 +1,337 @@
+package server
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/kunal768/go-grpc-tc/auth"
+	usersv1 "github.com/kunal768/go-grpc-tc/proto/users/v1"
+	pb "github.com/kunal768/go-grpc-tc/proto/users/v2"
+	"github.com/kunal768/go-grpc-tc/user"
+	"github.com/kunal768/go-grpc-tc/utility"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+func dial(t *testing.T, lis *bufconn.Listener) *grpc.ClientConn {
+	conn, err := grpc.NewClient("passthrough:///bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+			return lis.DialContext(ctx)
+		}),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	)
+	require.NoError(t, err)
+	t.Cleanup(func() { conn.Close() })
+	return conn
+}
+
+func TestServer_Health(t *testing.T) {
+	srv := New(user.NewService(user.NewRepository(user.UserDB{})), Options{})
+	lis := bufconn.Listen(1024 * 1024)
+	go srv.Serve(lis)
+	t.Cleanup(srv.grpcServer.Stop)
+
+	client := healthpb.NewHealthClient(dial(t, lis))
+
+	for _, service := range []string{"", pb.UserService_ServiceDesc.ServiceName, usersv1.UserService_ServiceDesc.ServiceName, LegacyUserServiceName} {
+		resp, err := client.Check(context.Background(), &healthpb.HealthCheckRequest{Service: service})
+		require.NoError(t, err)
+		assert.Equal(t, healthpb.HealthCheckResponse_NOT_SERVING, resp.Status)
+	}
+
+	srv.SetServing(true)
+
+	for _, service := range []string{"", pb.UserService_ServiceDesc.ServiceName, usersv1.UserService_ServiceDesc.ServiceName, LegacyUserServiceName} {
+		resp, err := client.Check(context.Background(), &healthpb.HealthCheckRequest{Service: service})
+		require.NoError(t, err)
+		assert.Equal(t, healthpb.HealthCheckResponse_SERVING, resp.Status)
+	}
+}
+
+func TestServer_APIVersions(t *testing.T) {
+	srv := New(user.NewService(user.NewRepository(user.UserDB{
+		1: {ID: 1, FName: "John", Address: user.Address{City: "New York", Country: "US"}, Phone: 1234567890, Height: 180.5, Married: true},
+	})), Options{})
+	lis := bufconn.Listen(1024 * 1024)
+	go srv.Serve(lis)
+	t.Cleanup(srv.grpcServer.Stop)
+	conn := dial(t, lis)
+
+	v2, err := pb.NewUserServiceClient(conn).GetUserByID(context.Background(), &pb.GetUserByIDRequest{Id: 1})
+	require.NoError(t, err)
+	assert.Equal(t, "US", v2.User.Address.Country)
+
+	v1, err := usersv1.NewUserServiceClient(conn).GetUserByID(context.Background(), &usersv1.UserIDRequest{Id: 1})
+	require.NoError(t, err)
+	assert.Equal(t, "New York", v1.User.City)
+	assert.Equal(t, "US", v1.User.Address.Country)
+
+	legacy := &usersv1.UserResponse{}
+	require.NoError(t, conn.Invoke(context.Background(), "/"+LegacyUserServiceName+"/GetUserByID", &usersv1.UserIDRequest{Id: 1}, legacy))
+	assert.Equal(t, "John", legacy.User.Fname)
+	assert.Equal(t, "New York", legacy.User.City)
+}
+
+// blockingService holds GetUserByID until release is closed so tests can
+// shut the server down while an RPC is in flight.
+type blockingService struct {
+	user.Service
+	started chan struct{}
+	release chan struct{}
+}
+
+func (s blockingService) GetUserByID(ctx context.Context, req *pb.GetUserByIDRequest) (*pb.UserResponse, error) {
+	close(s.started)
+	select {
+	case <-s.release:
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+	return s.Service.GetUserByID(ctx, req)
+}
+
+func newBlockingService() blockingService {
+	return blockingService{
+		Service: user.NewService(user.NewRepository(user.UserDB{
+			1: {ID: 1, FName: "John", Address: user.Address{City: "New York"}, Phone: 1234567890, Height: 180.5, Married: true},
+		})),
+		started: make(chan struct{}),
+		release: make(chan struct{}),
+	}
+}
+
+func TestServer_GracefulShutdownOnSignal(t *testing.T) {
+	service := newBlockingService()
+	srv := New(service, Options{})
+	srv.SetServing(true)
+	lis := bufconn.Listen(1024 * 1024)
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGTERM)
+	defer stop()
+
+	runErr := make(chan error, 1)
+	go func() {
+		runErr <- srv.Run(ctx, lis, 5*time.Second)
+	}()
+
+	conn := dial(t, lis)
+	health := healthpb.NewHealthClient(conn)
+
+	rpcErr := make(chan error, 1)
+	var resp *pb.UserResponse
+	go func() {
+		var err error
+		resp, err = pb.NewUserServiceClient(conn).GetUserByID(context.Background(), &pb.GetUserByIDRequest{Id: 1})
+		rpcErr <- err
+	}()
+
+	<-service.started
+	require.NoError(t, syscall.Kill(os.Getpid(), syscall.SIGTERM))
+
+	assert.Eventually(t, func() bool {
+		resp, err := health.Check(context.Background(), &healthpb.HealthCheckRequest{Service: pb.UserService_ServiceDesc.ServiceName})
+		return err != nil || resp.Status == healthpb.HealthCheckResponse_NOT_SERVING
+	}, time.Second, 10*time.Millisecond)
+
+	select {
+	case <-runErr:
+		t.Fatal("server stopped before the in-flight RPC finished")
+	default:
+	}
+
+	close(service.release)
+	require.NoError(t, <-rpcErr)
+	assert.Equal(t, "John", resp.User.Fname)
+	assert.NoError(t, <-runErr)
+
+	_, err := lis.DialContext(context.Background())
+	assert.Error(t, err)
+}
+
+func TestServer_ShutdownDrainTimeout(t *testing.T) {
+	service := newBlockingService()
+	srv := New(service, Options{})
+	srv.SetServing(true)
+	lis := bufconn.Listen(1024 * 1024)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	runErr := make(chan error, 1)
+	go func() {
+		runErr <- srv.Run(ctx, lis, 50*time.Millisecond)
+	}()
+
+	rpcErr := make(chan error, 1)
+	go func() {
+		_, err := pb.NewUserServiceClient(dial(t, lis)).GetUserByID(context.Background(), &pb.GetUserByIDRequest{Id: 1})
+		rpcErr <- err
+	}()
+
+	<-service.started
+	cancel()
+
+	assert.ErrorIs(t, <-runErr, utility.ErrDrainTimeout)
+	assert.Equal(t, codes.Unavailable, status.Code(<-rpcErr))
+}
+
+type testCA struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+	pem  []byte
+}
+
+func newTestCA(t *testing.T) testCA {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "test CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	require.NoError(t, err)
+	cert, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+	return testCA{cert: cert, key: key, pem: pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})}
+}
+
+// issue returns a PEM certificate and key signed by the CA.
+func (ca testCA) issue(t *testing.T, serial int64, subject pkix.Name, usage x509.ExtKeyUsage, dnsNames ...string) ([]byte, []byte) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(serial),
+		Subject:      subject,
+		DNSNames:     dnsNames,
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{usage},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, ca.cert, &key.PublicKey, ca.key)
+	require.NoError(t, err)
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	require.NoError(t, err)
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})
+}
+
+func TestCertReloader(t *testing.T) {
+	ca := newTestCA(t)
+	dir := t.TempDir()
+	certFile, keyFile, caFile := filepath.Join(dir, "server.pem"), filepath.Join(dir, "server.key"), filepath.Join(dir, "ca.pem")
+	writeServerCert := func(serial int64, modTime time.Time) {
+		certPEM, keyPEM := ca.issue(t, serial, pkix.Name{CommonName: "localhost"}, x509.ExtKeyUsageServerAuth, "localhost")
+		require.NoError(t, os.WriteFile(certFile, certPEM, 0o600))
+		require.NoError(t, os.WriteFile(keyFile, keyPEM, 0o600))
+		require.NoError(t, os.Chtimes(certFile, modTime, modTime))
+		require.NoError(t, os.Chtimes(keyFile, modTime, modTime))
+	}
+	writeServerCert(10, time.Now().Add(-time.Minute))
+	require.NoError(t, os.WriteFile(caFile, ca.pem, 0o600))
+
+	reloader, err := NewCertReloader(TLSOptions{CertFile: certFile, KeyFile: keyFile, ClientCAFile: caFile, RequireClientCert: true})
+	require.NoError(t, err)
+
+	principals := make(chan auth.Principal, 1)
+	authenticator := auth.NewAuthenticator(auth.Options{})
+	srv := New(user.NewService(user.NewRepository(user.UserDB{1: {ID: 1, FName: "John", Address: user.Address{City: "New York"}, Phone: 1234567890, Height: 180}})), Options{
+		ServerOptions: []grpc.ServerOption{
+			grpc.Creds(credentials.NewTLS(reloader.TLSConfig())),
+			grpc.ChainUnaryInterceptor(authenticator.UnaryInterceptor(), func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+				p, _ := auth.FromContext(ctx)
+				principals <- p
+				return handler(ctx, req)
+			}),
+		},
+	})
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	go srv.Serve(lis)
+	t.Cleanup(srv.grpcServer.Stop)
+
+	roots := x509.NewCertPool()
+	roots.AddCert(ca.cert)
+	clientPEM, clientKeyPEM := ca.issue(t, 20, pkix.Name{CommonName: "ci", OrganizationalUnit: []string{"reader"}}, x509.ExtKeyUsageClientAuth)
+	clientCert, err := tls.X509KeyPair(clientPEM, clientKeyPEM)
+	require.NoError(t, err)
+
+	call := func(certs ...tls.Certificate) (*x509.Certificate, error) {
+		creds := credentials.NewTLS(&tls.Config{RootCAs: roots, ServerName: "localhost", Certificates: certs})
+		conn, err := grpc.NewClient(lis.Addr().String(), grpc.WithTransportCredentials(creds))
+		require.NoError(t, err)
+		defer conn.Close()
+
+		var p peer.Peer
+		_, err = pb.NewUserServiceClient(conn).GetUserByID(context.Background(), &pb.GetUserByIDRequest{Id: 1}, grpc.Peer(&p))
+		if err != nil {
+			return nil, err
+		}
+		return p.AuthInfo.(credentials.TLSInfo).State.PeerCertificates[0], nil
+	}
+
+	t.Run("Maps the client certificate to a principal", func(t *testing.T) {
+		serverCert, err := call(clientCert)
+		require.NoError(t, err)
+		assert.EqualValues(t, 10, serverCert.SerialNumber.Int64())
+		assert.Equal(t, auth.Principal{Subject: "ci", Method: "mtls", Roles: []string{"reader"}}, <-principals)
+	})
+
+	t.Run("Rejects clients without a certificate", func(t *testing.T) {
+		_, err := call()
+		assert.Error(t, err)
+	})
+
+	t.Run("Serves a replaced certificate", func(t *testing.T) {
+		reloaded, err := reloader.Reload()
+		require.NoError(t, err)
+		assert.False(t, reloaded, "nothing changed")
+
+		writeServerCert(11, time.Now())
+		reloaded, err = reloader.Reload()
+		require.NoError(t, err)
+		assert.True(t, reloaded)
+
+		serverCert, err := call(clientCert)
+		require.NoError(t, err)
+		assert.EqualValues(t, 11, serverCert.SerialNumber.Int64())
+		<-principals
+	})
+
+	t.Run("Keeps the previous certificate when the new one is broken", func(t *testing.T) {
+		require.NoError(t, os.WriteFile(keyFile, []byte("garbage"), 0o600))
+		_, err := reloader.Reload()
+		assert.Error(t, err)
+
+		serverCert, err := call(clientCert)
+		require.NoError(t, err)
+		assert.EqualValues(t, 11, serverCert.SerialNumber.Int64())
+		<-principals
+	})
+}
@@ -0,0 +1,147 @@
+package server
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"sync"
+	"time"
+)
+
+type TLSOptions struct {
+	CertFile string
+	KeyFile  string
+	// ClientCAFile is a PEM bundle of the CAs client certificates are verified
+	// against. Without it clients are not asked for a certificate.
+	ClientCAFile string
+	// RequireClientCert rejects clients without a valid certificate, otherwise
+	// a certificate is only verified when the client presents one.
+	RequireClientCert bool
+	Logger            *slog.Logger
+}
+
+// CertReloader serves the certificate and client CAs of TLSOptions, reloading
+// them when their files change. A change that fails to load is logged and
+// the previous files stay in use.
+type CertReloader struct {
+	opts TLSOptions
+
+	mu        sync.RWMutex
+	cert      *tls.Certificate
+	clientCAs *x509.CertPool
+	modTimes  map[string]time.Time
+}
+
+func NewCertReloader(opts TLSOptions) (*CertReloader, error) {
+	if opts.Logger == nil {
+		opts.Logger = slog.Default()
+	}
+	r := &CertReloader{opts: opts}
+	if _, err := r.Reload(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+func (r *CertReloader) files() []string {
+	files := []string{r.opts.CertFile, r.opts.KeyFile}
+	if r.opts.ClientCAFile != "" {
+		files = append(files, r.opts.ClientCAFile)
+	}
+	return files
+}
+
+// Reload loads the files again if any of them changed since the last load,
+// and reports whether it did.
+func (r *CertReloader) Reload() (bool, error) {
+	modTimes := map[string]time.Time{}
+	changed := false
+	r.mu.RLock()
+	for _, file := range r.files() {
+		info, err := os.Stat(file)
+		if err != nil {
+			r.mu.RUnlock()
+			return false, err
+		}
+		modTimes[file] = info.ModTime()
+		if !info.ModTime().Equal(r.modTimes[file]) {
+			changed = true
+		}
+	}
+	r.mu.RUnlock()
+	if !changed {
+		return false, nil
+	}
+
+	cert, err := tls.LoadX509KeyPair(r.opts.CertFile, r.opts.KeyFile)
+	if err != nil {
+		return false, err
+	}
+	var clientCAs *x509.CertPool
+	if r.opts.ClientCAFile != "" {
+		pem, err := os.ReadFile(r.opts.ClientCAFile)
+		if err != nil {
+			return false, err
+		}
+		clientCAs = x509.NewCertPool()
+		if !clientCAs.AppendCertsFromPEM(pem) {
+			return false, fmt.Errorf("%s: no PEM certificates", r.opts.ClientCAFile)
+		}
+	}
+
+	r.mu.Lock()
+	r.cert, r.clientCAs, r.modTimes = &cert, clientCAs, modTimes
+	r.mu.Unlock()
+	return true, nil
+}
+
+// Watch checks the files for changes every interval until ctx is done.
+func (r *CertReloader) Watch(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			reloaded, err := r.Reload()
+			if err != nil {
+				r.opts.Logger.Error("failed to reload TLS certificates, keeping the previous ones", "error", err)
+			} else if reloaded {
+				r.opts.Logger.Info("reloaded TLS certificates", "cert_file", r.opts.CertFile)
+			}
+		}
+	}
+}
+
+// TLSConfig returns a config picking up the current files on every handshake.
+func (r *CertReloader) TLSConfig() *tls.Config {
+	return &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		GetConfigForClient: func(*tls.ClientHelloInfo) (*tls.Config, error) {
+			r.mu.RLock()
+			defer r.mu.RUnlock()
+			if r.cert == nil {
+				return nil, errors.New("no TLS certificate loaded")
+			}
+
+			config := &tls.Config{
+				MinVersion:   tls.VersionTLS12,
+				Certificates: []tls.Certificate{*r.cert},
+				NextProtos:   []string{"h2"},
+			}
+			if r.clientCAs != nil {
+				config.ClientCAs = r.clientCAs
+				config.ClientAuth = tls.VerifyClientCertIfGiven
+				if r.opts.RequireClientCert {
+					config.ClientAuth = tls.RequireAndVerifyClientCert
+				}
+			}
+			return config, nil
+		},
+	}
+}
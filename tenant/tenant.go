@@ -0,0 +1,138 @@
+package tenant
+
+import (
+	"context"
+	"regexp"
+	"strings"
+
+	"github.com/kunal768/go-grpc-tc/auth"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// Header is the request metadata naming the tenant of a call.
+const Header = "x-tenant-id"
+
+var validName = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]{0,62}$`)
+
+// ValidName reports whether name may name a tenant. Names end up in file
+// names, so they are limited to lower case letters, digits, "-" and "_".
+func ValidName(name string) bool {
+	return validName.MatchString(name)
+}
+
+type tenantKey struct{}
+
+func NewContext(ctx context.Context, name string) context.Context {
+	return context.WithValue(ctx, tenantKey{}, name)
+}
+
+func FromContext(ctx context.Context) (string, bool) {
+	name, ok := ctx.Value(tenantKey{}).(string)
+	return name, ok
+}
+
+type Options struct {
+	// Tenants are the names of every tenant, calls for others are denied.
+	Tenants []string
+	// Default is the tenant of calls naming none, which are rejected if it
+	// is empty.
+	Default string
+	// ExemptMethods are full method names, or prefixes ending in "*", that
+	// belong to no tenant, such as health checks.
+	ExemptMethods []string
+}
+
+// Resolver puts the tenant of every call into its context. The tenant bound
+// to the principal wins, a principal bound to none may pick one with the
+// x-tenant-id metadata.
+type Resolver struct {
+	opts    Options
+	tenants map[string]bool
+}
+
+func NewResolver(opts Options) *Resolver {
+	tenants := map[string]bool{}
+	for _, name := range opts.Tenants {
+		tenants[name] = true
+	}
+	return &Resolver{opts: opts, tenants: tenants}
+}
+
+func (r *Resolver) exempt(method string) bool {
+	for _, pattern := range r.opts.ExemptMethods {
+		if prefix, ok := strings.CutSuffix(pattern, "*"); ok {
+			if strings.HasPrefix(method, prefix) {
+				return true
+			}
+		} else if method == pattern {
+			return true
+		}
+	}
+	return false
+}
+
+// Resolve returns the tenant of a call.
+func (r *Resolver) Resolve(ctx context.Context) (string, error) {
+	var requested string
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		if values := md.Get(Header); len(values) > 0 {
+			requested = values[0]
+		}
+	}
+
+	name := requested
+	if p, ok := auth.FromContext(ctx); ok && p.Tenant != "" {
+		if requested != "" && requested != p.Tenant {
+			return "", status.Errorf(codes.PermissionDenied, "%s may only access tenant %q", p.Subject, p.Tenant)
+		}
+		name = p.Tenant
+	}
+	if name == "" {
+		name = r.opts.Default
+	}
+	if name == "" {
+		return "", status.Errorf(codes.InvalidArgument, "%s metadata is required", Header)
+	}
+	if !r.tenants[name] {
+		return "", status.Errorf(codes.PermissionDenied, "unknown tenant %q", name)
+	}
+	return name, nil
+}
+
+func (r *Resolver) UnaryInterceptor() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		if r.exempt(info.FullMethod) {
+			return handler(ctx, req)
+		}
+		name, err := r.Resolve(ctx)
+		if err != nil {
+			return nil, err
+		}
+		return handler(NewContext(ctx, name), req)
+	}
+}
+
+func (r *Resolver) StreamInterceptor() grpc.StreamServerInterceptor {
+	return func(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		if r.exempt(info.FullMethod) {
+			return handler(srv, ss)
+		}
+		name, err := r.Resolve(ss.Context())
+		if err != nil {
+			return err
+		}
+		return handler(srv, &tenantStream{ServerStream: ss, ctx: NewContext(ss.Context(), name)})
+	}
+}
+
+type tenantStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *tenantStream) Context() context.Context {
+	return s.ctx
+}
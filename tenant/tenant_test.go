@@ -0,0 +1,76 @@
+package tenant
+
+import (
+	"context"
+	"testing"
+
+	"github.com/kunal768/go-grpc-tc/auth"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+func TestResolver(t *testing.T) {
+	r := NewResolver(Options{Tenants: []string{"acme", "globex"}, ExemptMethods: []string{"/grpc.health.v1.Health/*"}})
+	withHeader := func(ctx context.Context, name string) context.Context {
+		return metadata.NewIncomingContext(ctx, metadata.Pairs(Header, name))
+	}
+	bound := auth.NewContext(context.Background(), auth.Principal{Subject: "ci", Tenant: "acme"})
+
+	tests := []struct {
+		name   string
+		ctx    context.Context
+		tenant string
+		code   codes.Code
+	}{
+		{"Header", withHeader(context.Background(), "globex"), "globex", codes.OK},
+		{"Principal", bound, "acme", codes.OK},
+		{"Principal and matching header", withHeader(bound, "acme"), "acme", codes.OK},
+		{"Principal and other header", withHeader(bound, "globex"), "", codes.PermissionDenied},
+		{"Unknown tenant", withHeader(context.Background(), "initech"), "", codes.PermissionDenied},
+		{"No tenant", context.Background(), "", codes.InvalidArgument},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			name, err := r.Resolve(tt.ctx)
+			assert.Equal(t, tt.code, status.Code(err))
+			assert.Equal(t, tt.tenant, name)
+		})
+	}
+
+	t.Run("Default tenant", func(t *testing.T) {
+		r := NewResolver(Options{Tenants: []string{"acme"}, Default: "acme"})
+		name, err := r.Resolve(context.Background())
+		require.NoError(t, err)
+		assert.Equal(t, "acme", name)
+	})
+
+	t.Run("Interceptor", func(t *testing.T) {
+		interceptor := r.UnaryInterceptor()
+		var got string
+		var ok bool
+		handler := func(ctx context.Context, req any) (any, error) {
+			got, ok = FromContext(ctx)
+			return nil, nil
+		}
+		_, err := interceptor(withHeader(context.Background(), "acme"), nil, &grpc.UnaryServerInfo{FullMethod: "/users.v2.UserService/ListUsers"}, handler)
+		require.NoError(t, err)
+		assert.True(t, ok)
+		assert.Equal(t, "acme", got)
+
+		_, err = interceptor(context.Background(), nil, &grpc.UnaryServerInfo{FullMethod: "/grpc.health.v1.Health/Check"}, handler)
+		require.NoError(t, err)
+		assert.False(t, ok, "exempt methods belong to no tenant")
+	})
+}
+
+func TestValidName(t *testing.T) {
+	assert.True(t, ValidName("acme"))
+	assert.True(t, ValidName("acme-eu_1"))
+	assert.False(t, ValidName(""))
+	assert.False(t, ValidName("Acme"))
+	assert.False(t, ValidName("../acme"))
+}
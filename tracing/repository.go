@@ -0,0 +1,121 @@
+package tracing
+
+import (
+	"context"
+	"time"
+
+	"github.com/kunal768/go-grpc-tc/user"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	otelcodes "go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// repository starts a span around every call to the wrapped
+// user.Repository.
+type repository struct {
+	user.Repository
+	tracer trace.Tracer
+}
+
+// Repository wraps repo using the global tracer provider, call it after
+// Setup.
+func Repository(repo user.Repository) user.Repository {
+	return repository{Repository: repo, tracer: otel.Tracer(instrumentationName)}
+}
+
+func endRepositorySpan(span trace.Span, results int, err error) {
+	span.SetAttributes(attribute.Int("user.result_count", results))
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(otelcodes.Error, err.Error())
+	}
+	span.End()
+}
+
+func (r repository) AddUser(ctx context.Context, u user.User) (user.User, error) {
+	ctx, span := r.tracer.Start(ctx, "user.Repository/AddUser", trace.WithAttributes(attribute.Int64("user.id", int64(u.ID))))
+	u, err := r.Repository.AddUser(ctx, u)
+	endRepositorySpan(span, countUser(err), err)
+	return u, err
+}
+
+func (r repository) UpdateUser(ctx context.Context, u user.User) (user.User, error) {
+	ctx, span := r.tracer.Start(ctx, "user.Repository/UpdateUser", trace.WithAttributes(attribute.Int64("user.id", int64(u.ID))))
+	u, err := r.Repository.UpdateUser(ctx, u)
+	endRepositorySpan(span, countUser(err), err)
+	return u, err
+}
+
+func (r repository) DeleteUser(ctx context.Context, Id user.UserId, revision int64) error {
+	ctx, span := r.tracer.Start(ctx, "user.Repository/DeleteUser", trace.WithAttributes(attribute.Int64("user.id", int64(Id))))
+	err := r.Repository.DeleteUser(ctx, Id, revision)
+	endRepositorySpan(span, countUser(err), err)
+	return err
+}
+
+func (r repository) Transact(ctx context.Context, writes []user.Write) ([]user.User, error) {
+	ctx, span := r.tracer.Start(ctx, "user.Repository/Transact", trace.WithAttributes(attribute.Int("user.write_count", len(writes))))
+	users, err := r.Repository.Transact(ctx, writes)
+	endRepositorySpan(span, len(users), err)
+	return users, err
+}
+
+func (r repository) GetUserById(ctx context.Context, Id user.UserId) (user.User, error) {
+	ctx, span := r.tracer.Start(ctx, "user.Repository/GetUserById", trace.WithAttributes(attribute.Int64("user.id", int64(Id))))
+	u, err := r.Repository.GetUserById(ctx, Id)
+	endRepositorySpan(span, countUser(err), err)
+	return u, err
+}
+
+func (r repository) GetUsersById(ctx context.Context, Ids []user.UserId) ([]user.User, error) {
+	ctx, span := r.tracer.Start(ctx, "user.Repository/GetUsersById", trace.WithAttributes(attribute.Int("user.requested_count", len(Ids))))
+	users, err := r.Repository.GetUsersById(ctx, Ids)
+	endRepositorySpan(span, len(users), err)
+	return users, err
+}
+
+func (r repository) SearchUsers(ctx context.Context, data user.UsersSearchRequest) ([]user.User, error) {
+	ctx, span := r.tracer.Start(ctx, "user.Repository/SearchUsers")
+	users, err := r.Repository.SearchUsers(ctx, data)
+	endRepositorySpan(span, len(users), err)
+	return users, err
+}
+
+func (r repository) ListUsers(ctx context.Context, pageSize int, page int) ([]user.User, error) {
+	ctx, span := r.tracer.Start(ctx, "user.Repository/ListUsers", trace.WithAttributes(
+		attribute.Int("user.page", page),
+		attribute.Int("user.page_size", pageSize),
+	))
+	users, err := r.Repository.ListUsers(ctx, pageSize, page)
+	endRepositorySpan(span, len(users), err)
+	return users, err
+}
+
+func (r repository) GetUserHistory(ctx context.Context, Id user.UserId) ([]user.Version, error) {
+	ctx, span := r.tracer.Start(ctx, "user.Repository/GetUserHistory", trace.WithAttributes(attribute.Int64("user.id", int64(Id))))
+	versions, err := r.Repository.GetUserHistory(ctx, Id)
+	endRepositorySpan(span, len(versions), err)
+	return versions, err
+}
+
+func (r repository) GetUserByIdAsOf(ctx context.Context, Id user.UserId, t time.Time) (user.User, error) {
+	ctx, span := r.tracer.Start(ctx, "user.Repository/GetUserByIdAsOf", trace.WithAttributes(
+		attribute.Int64("user.id", int64(Id)),
+		attribute.String("user.as_of", t.Format(time.RFC3339Nano)),
+	))
+	u, err := r.Repository.GetUserByIdAsOf(ctx, Id, t)
+	endRepositorySpan(span, countUser(err), err)
+	return u, err
+}
+
+func (r repository) ListUsersAsOf(ctx context.Context, pageSize int, page int, t time.Time) ([]user.User, error) {
+	ctx, span := r.tracer.Start(ctx, "user.Repository/ListUsersAsOf", trace.WithAttributes(
+		attribute.Int("user.page", page),
+		attribute.Int("user.page_size", pageSize),
+		attribute.String("user.as_of", t.Format(time.RFC3339Nano)),
+	))
+	users, err := r.Repository.ListUsersAsOf(ctx, pageSize, page, t)
+	endRepositorySpan(span, len(users), err)
+	return users, err
+}
@@ -0,0 +1,122 @@
+package tracing
+
+import (
+	"context"
+
+	pb "github.com/kunal768/go-grpc-tc/proto/users/v2"
+	"github.com/kunal768/go-grpc-tc/user"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	otelcodes "go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/emptypb"
+)
+
+// service starts a span around every call to the wrapped user.Service.
+type service struct {
+	user.Service
+	tracer trace.Tracer
+}
+
+// Service wraps s using the global tracer provider, call it after Setup.
+func Service(s user.Service) user.Service {
+	return service{Service: s, tracer: otel.Tracer(instrumentationName)}
+}
+
+// endServiceSpan records the result count and gRPC status code of a call.
+func endServiceSpan(span trace.Span, results int, err error) {
+	code := status.Code(err)
+	span.SetAttributes(
+		attribute.Int("user.result_count", results),
+		attribute.Int("rpc.grpc.status_code", int(code)),
+	)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(otelcodes.Error, code.String())
+	}
+	span.End()
+}
+
+func (s service) AddUser(ctx context.Context, req *pb.AddUserRequest) (*pb.UserResponse, error) {
+	ctx, span := s.tracer.Start(ctx, "user.Service/AddUser", trace.WithAttributes(attribute.Int64("user.id", req.GetUser().GetId())))
+	resp, err := s.Service.AddUser(ctx, req)
+	endServiceSpan(span, countUser(err), err)
+	return resp, err
+}
+
+func (s service) GetUserByID(ctx context.Context, req *pb.GetUserByIDRequest) (*pb.UserResponse, error) {
+	ctx, span := s.tracer.Start(ctx, "user.Service/GetUserByID", trace.WithAttributes(attribute.Int64("user.id", req.Id)))
+	resp, err := s.Service.GetUserByID(ctx, req)
+	endServiceSpan(span, countUser(err), err)
+	return resp, err
+}
+
+func (s service) GetUsersByIDs(ctx context.Context, req *pb.GetUsersByIDsRequest) (*pb.UsersResponse, error) {
+	ctx, span := s.tracer.Start(ctx, "user.Service/GetUsersByIDs", trace.WithAttributes(attribute.Int("user.requested_count", len(req.Ids))))
+	resp, err := s.Service.GetUsersByIDs(ctx, req)
+	endServiceSpan(span, len(resp.GetUsers()), err)
+	return resp, err
+}
+
+func (s service) SearchUsers(ctx context.Context, req *pb.SearchUsersRequest) (*pb.UsersResponse, error) {
+	ctx, span := s.tracer.Start(ctx, "user.Service/SearchUsers")
+	resp, err := s.Service.SearchUsers(ctx, req)
+	endServiceSpan(span, len(resp.GetUsers()), err)
+	return resp, err
+}
+
+func (s service) ListUsers(ctx context.Context, req *pb.ListUsersRequest) (*pb.UsersResponse, error) {
+	ctx, span := s.tracer.Start(ctx, "user.Service/ListUsers", trace.WithAttributes(
+		attribute.Int("user.page", int(req.Page)),
+		attribute.Int("user.page_size", int(req.PageSize)),
+	))
+	resp, err := s.Service.ListUsers(ctx, req)
+	endServiceSpan(span, len(resp.GetUsers()), err)
+	return resp, err
+}
+
+func (s service) CreateUser(ctx context.Context, req *pb.CreateUserRequest) (*pb.UserResponse, error) {
+	ctx, span := s.tracer.Start(ctx, "user.Service/CreateUser")
+	resp, err := s.Service.CreateUser(ctx, req)
+	if err == nil {
+		span.SetAttributes(attribute.Int64("user.id", resp.User.Id))
+	}
+	endServiceSpan(span, countUser(err), err)
+	return resp, err
+}
+
+func (s service) UpdateUser(ctx context.Context, req *pb.UpdateUserRequest) (*pb.UserResponse, error) {
+	ctx, span := s.tracer.Start(ctx, "user.Service/UpdateUser", trace.WithAttributes(attribute.Int64("user.id", req.GetUser().GetId())))
+	resp, err := s.Service.UpdateUser(ctx, req)
+	endServiceSpan(span, countUser(err), err)
+	return resp, err
+}
+
+func (s service) DeleteUser(ctx context.Context, req *pb.DeleteUserRequest) (*emptypb.Empty, error) {
+	ctx, span := s.tracer.Start(ctx, "user.Service/DeleteUser", trace.WithAttributes(attribute.Int64("user.id", req.Id)))
+	resp, err := s.Service.DeleteUser(ctx, req)
+	endServiceSpan(span, countUser(err), err)
+	return resp, err
+}
+
+func (s service) GetUserHistory(ctx context.Context, req *pb.GetUserHistoryRequest) (*pb.GetUserHistoryResponse, error) {
+	ctx, span := s.tracer.Start(ctx, "user.Service/GetUserHistory", trace.WithAttributes(attribute.Int64("user.id", req.Id)))
+	resp, err := s.Service.GetUserHistory(ctx, req)
+	endServiceSpan(span, len(resp.GetVersions()), err)
+	return resp, err
+}
+
+func (s service) BatchWrite(ctx context.Context, req *pb.BatchWriteRequest) (*pb.BatchWriteResponse, error) {
+	ctx, span := s.tracer.Start(ctx, "user.Service/BatchWrite", trace.WithAttributes(attribute.Int("user.write_count", len(req.Operations))))
+	resp, err := s.Service.BatchWrite(ctx, req)
+	endServiceSpan(span, len(resp.GetResults()), err)
+	return resp, err
+}
+
+func countUser(err error) int {
+	if err != nil {
+		return 0
+	}
+	return 1
+}
@@ -0,0 +1,102 @@
+package tracing
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	pb "github.com/kunal768/go-grpc-tc/proto/users/v2"
+	"github.com/kunal768/go-grpc-tc/user"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/contrib/instrumentation/google.golang.org/grpc/otelgrpc"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+func attributes(span sdktrace.ReadOnlySpan) map[attribute.Key]attribute.Value {
+	attrs := map[attribute.Key]attribute.Value{}
+	for _, kv := range span.Attributes() {
+		attrs[kv.Key] = kv.Value
+	}
+	return attrs
+}
+
+func TestTracing(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+	otel.SetTracerProvider(provider)
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+	t.Cleanup(func() { provider.Shutdown(context.Background()) })
+
+	repo := Repository(user.NewRepository(user.UserDB{
+		1: {ID: 1, FName: "John", Address: user.Address{City: "New York"}, Phone: 1234567890, Height: 180.5, Married: true},
+		2: {ID: 2, FName: "Jane", Address: user.Address{City: "Los Angeles"}, Phone: 9876543210, Height: 165.2, Married: false},
+	}))
+
+	server := grpc.NewServer(grpc.StatsHandler(otelgrpc.NewServerHandler()))
+	pb.RegisterUserServiceServer(server, user.NewUserServiceServer(Service(user.NewService(repo))))
+	lis := bufconn.Listen(1024 * 1024)
+	go server.Serve(lis)
+	t.Cleanup(server.Stop)
+
+	conn, err := grpc.NewClient("passthrough:///bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+			return lis.DialContext(ctx)
+		}),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	)
+	require.NoError(t, err)
+	t.Cleanup(func() { conn.Close() })
+	client := pb.NewUserServiceClient(conn)
+
+	t.Run("Spans join the incoming trace", func(t *testing.T) {
+		traceID := "4bf92f3577b34da6a3ce929d0e0e4736"
+		ctx := metadata.AppendToOutgoingContext(context.Background(), "traceparent", "00-"+traceID+"-00f067aa0ba902b7-01")
+		resp, err := client.ListUsers(ctx, &pb.ListUsersRequest{PageSize: 10})
+		require.NoError(t, err)
+		assert.Len(t, resp.Users, 2)
+
+		// the server span ends after the response has been sent
+		require.Eventually(t, func() bool { return len(recorder.Ended()) == 3 }, time.Second, time.Millisecond)
+		spans := recorder.Ended()
+		repoSpan, svcSpan, rpcSpan := spans[0], spans[1], spans[2]
+
+		assert.Equal(t, "user.Repository/ListUsers", repoSpan.Name())
+		assert.Equal(t, "user.Service/ListUsers", svcSpan.Name())
+		assert.Equal(t, "users.v2.UserService/ListUsers", rpcSpan.Name())
+		for _, span := range spans {
+			assert.Equal(t, traceID, span.SpanContext().TraceID().String())
+		}
+		assert.Equal(t, "00f067aa0ba902b7", rpcSpan.Parent().SpanID().String())
+		assert.Equal(t, rpcSpan.SpanContext().SpanID(), svcSpan.Parent().SpanID())
+		assert.Equal(t, svcSpan.SpanContext().SpanID(), repoSpan.Parent().SpanID())
+
+		assert.Equal(t, int64(2), attributes(svcSpan)["user.result_count"].AsInt64())
+		assert.Equal(t, int64(0), attributes(svcSpan)["rpc.grpc.status_code"].AsInt64())
+		assert.Equal(t, int64(2), attributes(repoSpan)["user.result_count"].AsInt64())
+	})
+
+	t.Run("Errors carry the status code", func(t *testing.T) {
+		_, err := client.GetUserByID(context.Background(), &pb.GetUserByIDRequest{Id: 7})
+		require.Error(t, err)
+
+		require.Eventually(t, func() bool { return len(recorder.Ended()) == 6 }, time.Second, time.Millisecond)
+		spans := recorder.Ended()
+		repoSpan, svcSpan := spans[3], spans[4]
+		assert.Equal(t, "user.Repository/GetUserById", repoSpan.Name())
+		assert.Equal(t, "user not found in db", repoSpan.Status().Description)
+		assert.Equal(t, "user.Service/GetUserByID", svcSpan.Name())
+		assert.Equal(t, int64(3), attributes(svcSpan)["rpc.grpc.status_code"].AsInt64())
+		assert.Equal(t, int64(0), attributes(svcSpan)["user.result_count"].AsInt64())
+		assert.Equal(t, "InvalidArgument", svcSpan.Status().Description)
+	})
+}
@@ -0,0 +1,143 @@
+package user
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/kunal768/go-grpc-tc/utility"
+)
+
+type WriteKind int
+
+const (
+	WriteCreate WriteKind = iota + 1
+	WriteUpdate
+	WriteDelete
+	// WriteCheck writes nothing, it only checks that the user exists at
+	// the revision.
+	WriteCheck
+)
+
+func (k WriteKind) String() string {
+	switch k {
+	case WriteCreate:
+		return "create"
+	case WriteUpdate:
+		return "update"
+	case WriteDelete:
+		return "delete"
+	case WriteCheck:
+		return "check"
+	}
+	return fmt.Sprintf("WriteKind(%d)", int(k))
+}
+
+// Write is one operation of a transaction. Creates and updates write User,
+// with the same rules as AddUser and UpdateUser. Deletes and checks apply to
+// the user with ID, which must be at Revision unless it is 0.
+type Write struct {
+	Kind     WriteKind
+	User     User
+	ID       UserId
+	Revision int64
+}
+
+// WriteError is the error of a transaction, caused by the write at Index.
+type WriteError struct {
+	Index int
+	Err   error
+}
+
+func (e *WriteError) Error() string {
+	return fmt.Sprintf("operation %d: %v", e.Index, e.Err)
+}
+
+func (e *WriteError) Unwrap() error {
+	return e.Err
+}
+
+// undo holds what a write changed about a user, to roll it back.
+type undo struct {
+	id       UserId
+	user     User
+	existed  bool
+	versions int
+}
+
+// Transact applies writes in order, all of them or none. No other call sees
+// the repository between two writes. It returns the user of every write:
+// the created or updated user, the deleted user as it was or the checked
+// user.
+func (r repo) Transact(ctx context.Context, writes []Write) ([]User, error) {
+	for i, w := range writes {
+		switch w.Kind {
+		case WriteCreate, WriteUpdate:
+			if err := ValidateUser(w.User); err != nil {
+				return nil, &WriteError{Index: i, Err: err}
+			}
+		case WriteDelete, WriteCheck:
+		default:
+			return nil, &WriteError{Index: i, Err: utility.ErrInvalidWrite}
+		}
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	users := make([]User, len(writes))
+	undos := make([]undo, 0, len(writes))
+	mark := r.outbox.mark()
+	for i, w := range writes {
+		id := w.ID
+		if w.Kind == WriteCreate || w.Kind == WriteUpdate {
+			id = w.User.ID
+		}
+		old, existed := r.db[id]
+		undos = append(undos, undo{id: id, user: old, existed: existed, versions: len(r.history[id])})
+
+		var err error
+		switch w.Kind {
+		case WriteCreate:
+			users[i], err = r.addUser(ctx, w.User)
+		case WriteUpdate:
+			users[i], err = r.updateUser(ctx, w.User)
+		case WriteDelete:
+			users[i], err = r.deleteUser(ctx, w.ID, w.Revision)
+		case WriteCheck:
+			users[i], err = r.checkUser(w.ID, w.Revision)
+		}
+		if err != nil {
+			r.rollback(undos)
+			r.outbox.reset(mark)
+			return nil, &WriteError{Index: i, Err: err}
+		}
+	}
+	return users, nil
+}
+
+// rollback undoes the writes of a failed transaction, last first. Must be
+// called with the write lock held.
+func (r repo) rollback(undos []undo) {
+	for i := len(undos) - 1; i >= 0; i-- {
+		u := undos[i]
+		if current, ok := r.db[u.id]; ok && current.Email != "" {
+			delete(r.emails, NormalizeEmail(current.Email))
+		}
+		if u.existed {
+			r.db[u.id] = u.user
+			if u.user.Email != "" {
+				r.emails[NormalizeEmail(u.user.Email)] = u.id
+			}
+		} else {
+			delete(r.db, u.id)
+		}
+		if u.versions == 0 {
+			delete(r.history, u.id)
+		} else {
+			r.history[u.id] = r.history[u.id][:u.versions]
+		}
+	}
+}
@@ -0,0 +1,146 @@
+package user
+
+import (
+	"context"
+	"time"
+
+	"github.com/kunal768/go-grpc-tc/tenant"
+	"github.com/kunal768/go-grpc-tc/utility"
+)
+
+type ChangeType string
+
+const (
+	ChangeCreated ChangeType = "created"
+	ChangeUpdated ChangeType = "updated"
+	ChangeDeleted ChangeType = "deleted"
+)
+
+// Change is a committed write of a user, kept in the outbox of the
+// repository until a publisher acknowledges it.
+type Change struct {
+	Seq    int64      `json:"seq"`
+	Tenant string     `json:"tenant,omitempty"`
+	Type   ChangeType `json:"type"`
+	// User is the user after the write, or as it was before a delete.
+	User  User      `json:"user"`
+	Actor string    `json:"actor,omitempty"`
+	Time  time.Time `json:"time"`
+}
+
+// ChangeFeed is implemented by repositories with an outbox. Every write is
+// recorded together with the change it makes, and stays in the outbox until
+// it is acknowledged.
+type ChangeFeed interface {
+	// PendingChanges returns up to limit changes not acknowledged yet,
+	// oldest first.
+	PendingChanges(ctx context.Context, limit int) ([]Change, error)
+	// AckChanges drops the changes up to and including seq.
+	AckChanges(ctx context.Context, seq int64) error
+}
+
+type RepositoryOptions struct {
+	// Outbox records every write as a Change for a publisher. Without a
+	// publisher acknowledging them the outbox grows forever.
+	Outbox bool
+	// Now stamps the versions of the history, time.Now if nil.
+	Now func() time.Time
+}
+
+func NewRepositoryWithOptions(db UserDB, opts RepositoryOptions) Repository {
+	r := newRepo(db)
+	if opts.Now != nil {
+		r.now = opts.Now
+	}
+	if opts.Outbox {
+		r.outbox = &outbox{}
+	}
+	return r
+}
+
+// outbox holds the changes not acknowledged yet. Guarded by the lock of the
+// repository.
+type outbox struct {
+	changes []Change
+	// seq is the sequence number of the last change recorded.
+	seq int64
+}
+
+// add records the change of a version. A write is a create if the user had
+// no version before it or was deleted.
+func (o *outbox) add(ctx context.Context, version Version, previous []Version) {
+	change := Change{User: version.User, Actor: version.Actor, Time: version.Time}
+	change.Tenant, _ = tenant.FromContext(ctx)
+	switch {
+	case version.Deleted:
+		change.Type = ChangeDeleted
+	case len(previous) == 0 || previous[len(previous)-1].Deleted:
+		change.Type = ChangeCreated
+	default:
+		change.Type = ChangeUpdated
+	}
+	o.seq++
+	change.Seq = o.seq
+	o.changes = append(o.changes, change)
+}
+
+// outboxMark is the state of an outbox to roll back to.
+type outboxMark struct {
+	changes int
+	seq     int64
+}
+
+func (o *outbox) mark() outboxMark {
+	if o == nil {
+		return outboxMark{}
+	}
+	return outboxMark{changes: len(o.changes), seq: o.seq}
+}
+
+func (o *outbox) reset(m outboxMark) {
+	if o == nil {
+		return
+	}
+	o.changes = o.changes[:m.changes]
+	o.seq = m.seq
+}
+
+func (r repo) PendingChanges(ctx context.Context, limit int) ([]Change, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	if r.outbox == nil {
+		return nil, utility.ErrNoOutbox
+	}
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.pendingChanges(limit, r.outbox.seq), nil
+}
+
+// pendingChanges returns up to limit changes up to seq. Must be called with
+// the lock held.
+func (r repo) pendingChanges(limit int, seq int64) []Change {
+	changes := []Change{}
+	for _, change := range r.outbox.changes {
+		if change.Seq > seq || (limit > 0 && len(changes) == limit) {
+			break
+		}
+		changes = append(changes, change)
+	}
+	return changes
+}
+
+func (r repo) AckChanges(ctx context.Context, seq int64) error {
+	if r.outbox == nil {
+		return utility.ErrNoOutbox
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	acked := 0
+	for acked < len(r.outbox.changes) && r.outbox.changes[acked].Seq <= seq {
+		acked++
+	}
+	r.outbox.changes = append([]Change(nil), r.outbox.changes[acked:]...)
+	return nil
+}
@@ -0,0 +1,237 @@
+package user
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/kunal768/go-grpc-tc/utility"
+)
+
+// fileRepo is the in-memory repository persisted as a JSON snapshot. Writes
+// are applied in memory and flushed to disk every flushInterval and on Close.
+type fileRepo struct {
+	repo
+	path  string
+	dirty atomic.Bool
+	// flushed is the sequence number of the last change on disk, only
+	// changes that survive a crash are published.
+	flushed atomic.Int64
+
+	stop      chan struct{}
+	done      chan struct{}
+	closeOnce sync.Once
+	closeErr  error
+}
+
+// snapshot is the file the repository is persisted to.
+type snapshot struct {
+	Users []User `json:"users"`
+	// History is the versions of every user, grouped by user, oldest first.
+	History []Version `json:"history"`
+	// Outbox is the changes not published yet and ChangeSeq the sequence
+	// number of the last change.
+	Outbox    []Change `json:"outbox,omitempty"`
+	ChangeSeq int64    `json:"change_seq,omitempty"`
+}
+
+func NewFileRepository(path string, flushInterval time.Duration) (Repository, error) {
+	return NewFileRepositoryWithOptions(path, flushInterval, RepositoryOptions{})
+}
+
+// NewFileRepositoryWithOptions opens the file repository at path. Opening it
+// without an outbox drops the changes it held.
+func NewFileRepositoryWithOptions(path string, flushInterval time.Duration, opts RepositoryOptions) (Repository, error) {
+	db := UserDB{}
+	history := map[UserId][]Version{}
+
+	data, err := os.ReadFile(path)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+	data = bytes.TrimSpace(data)
+	var snap snapshot
+	switch {
+	case len(data) == 0:
+	case data[0] == '[':
+		// snapshots written before history are a plain array of users
+		if err := json.Unmarshal(data, &snap.Users); err != nil {
+			return nil, err
+		}
+	default:
+		if err := json.Unmarshal(data, &snap); err != nil {
+			return nil, err
+		}
+	}
+	for _, user := range snap.Users {
+		db[user.ID] = user
+	}
+	for _, version := range snap.History {
+		history[version.User.ID] = append(history[version.User.ID], version)
+	}
+
+	r := &fileRepo{
+		repo: *newRepoWithHistory(db, history),
+		path: path,
+		stop: make(chan struct{}),
+		done: make(chan struct{}),
+	}
+	if opts.Now != nil {
+		r.now = opts.Now
+	}
+	if opts.Outbox {
+		r.outbox = &outbox{changes: snap.Outbox, seq: snap.ChangeSeq}
+		r.flushed.Store(snap.ChangeSeq)
+	}
+	go r.flushLoop(flushInterval)
+	return r, nil
+}
+
+func (r *fileRepo) AddUser(ctx context.Context, user User) (User, error) {
+	user, err := r.repo.AddUser(ctx, user)
+	if err == nil {
+		r.dirty.Store(true)
+	}
+	return user, err
+}
+
+func (r *fileRepo) UpdateUser(ctx context.Context, user User) (User, error) {
+	user, err := r.repo.UpdateUser(ctx, user)
+	if err == nil {
+		r.dirty.Store(true)
+	}
+	return user, err
+}
+
+func (r *fileRepo) DeleteUser(ctx context.Context, Id UserId, revision int64) error {
+	err := r.repo.DeleteUser(ctx, Id, revision)
+	if err == nil {
+		r.dirty.Store(true)
+	}
+	return err
+}
+
+// Transact marks the repository dirty once for the whole transaction, a
+// flush never sees part of it.
+func (r *fileRepo) Transact(ctx context.Context, writes []Write) ([]User, error) {
+	users, err := r.repo.Transact(ctx, writes)
+	if err == nil {
+		r.dirty.Store(true)
+	}
+	return users, err
+}
+
+// PendingChanges only returns changes already flushed to disk.
+func (r *fileRepo) PendingChanges(ctx context.Context, limit int) ([]Change, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	if r.outbox == nil {
+		return nil, utility.ErrNoOutbox
+	}
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.pendingChanges(limit, r.flushed.Load()), nil
+}
+
+func (r *fileRepo) AckChanges(ctx context.Context, seq int64) error {
+	err := r.repo.AckChanges(ctx, seq)
+	if err == nil {
+		r.dirty.Store(true)
+	}
+	return err
+}
+
+func (r *fileRepo) flushLoop(interval time.Duration) {
+	defer close(r.done)
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			// a failed flush stays dirty and is retried on the next tick
+			_ = r.Flush()
+		case <-r.stop:
+			return
+		}
+	}
+}
+
+// Flush writes the current snapshot if there are unsaved changes. The file is
+// replaced atomically so a crash mid-write leaves the previous snapshot.
+func (r *fileRepo) Flush() error {
+	if !r.dirty.Swap(false) {
+		return nil
+	}
+
+	r.mu.RLock()
+	snap := snapshot{Users: make([]User, 0, len(r.db))}
+	for _, user := range r.db {
+		snap.Users = append(snap.Users, user)
+	}
+	ids := make([]UserId, 0, len(r.history))
+	for id := range r.history {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	for _, id := range ids {
+		snap.History = append(snap.History, r.history[id]...)
+	}
+	if r.outbox != nil {
+		snap.Outbox = append([]Change(nil), r.outbox.changes...)
+		snap.ChangeSeq = r.outbox.seq
+	}
+	r.mu.RUnlock()
+
+	sort.Slice(snap.Users, func(i, j int) bool {
+		return snap.Users[i].ID < snap.Users[j].ID
+	})
+
+	if err := writeFileAtomic(r.path, snap); err != nil {
+		r.dirty.Store(true)
+		return err
+	}
+	r.flushed.Store(snap.ChangeSeq)
+	return nil
+}
+
+func (r *fileRepo) Close() error {
+	r.closeOnce.Do(func() {
+		close(r.stop)
+		<-r.done
+		r.closeErr = r.Flush()
+	})
+	return r.closeErr
+}
+
+func writeFileAtomic(path string, v any) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".tmp-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	enc := json.NewEncoder(tmp)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(v); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
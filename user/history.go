@@ -0,0 +1,131 @@
+package user
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	"github.com/kunal768/go-grpc-tc/utility"
+)
+
+// Version is a user as it was after one write. The version recording a
+// delete holds the user as it was before.
+type Version struct {
+	User    User      `json:"user"`
+	Actor   string    `json:"actor,omitempty"`
+	Time    time.Time `json:"time"`
+	Deleted bool      `json:"deleted,omitempty"`
+}
+
+type actorKey struct{}
+
+// WithActor attributes writes made with ctx to actor. The service attributes
+// RPCs to the authenticated principal, writes outside of RPCs such as seeding
+// and imports name their own.
+func WithActor(ctx context.Context, actor string) context.Context {
+	return context.WithValue(ctx, actorKey{}, actor)
+}
+
+func actorFrom(ctx context.Context) string {
+	actor, _ := ctx.Value(actorKey{}).(string)
+	return actor
+}
+
+// initialHistory starts the history of users loaded without one at their
+// last update. Users without an update time existed since forever.
+func initialHistory(db UserDB, history map[UserId][]Version) map[UserId][]Version {
+	if history == nil {
+		history = map[UserId][]Version{}
+	}
+	for id, user := range db {
+		if len(history[id]) == 0 {
+			history[id] = []Version{{User: user, Time: user.UpdateTime}}
+		}
+	}
+	return history
+}
+
+// record appends a version of user, stamped with the time of the write. The
+// update time of the user can be older, e.g. for imported users, while the
+// versions of a user have to be in time order. Must be called with the write
+// lock held.
+func (r repo) record(ctx context.Context, user User, deleted bool) {
+	version := Version{User: user, Actor: actorFrom(ctx), Time: r.now().UTC(), Deleted: deleted}
+	if r.outbox != nil {
+		r.outbox.add(ctx, version, r.history[user.ID])
+	}
+	r.history[user.ID] = append(r.history[user.ID], version)
+}
+
+// versionAt is the user as it was at t, false if it did not exist then.
+func (r repo) versionAt(Id UserId, t time.Time) (User, bool) {
+	versions := r.history[Id]
+	for i := len(versions) - 1; i >= 0; i-- {
+		if !versions[i].Time.After(t) {
+			return versions[i].User, !versions[i].Deleted
+		}
+	}
+	return User{}, false
+}
+
+// GetUserHistory returns the versions of a user, oldest first, including the
+// delete of a deleted user.
+func (r repo) GetUserHistory(ctx context.Context, Id UserId) ([]Version, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	if Id == 0 {
+		return nil, utility.ErrInvalidIdInput
+	}
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	versions, ok := r.history[Id]
+	if !ok {
+		return nil, utility.ErrUserNotFound
+	}
+	return append([]Version(nil), versions...), nil
+}
+
+// GetUserByIdAsOf returns a user as it was at t.
+func (r repo) GetUserByIdAsOf(ctx context.Context, Id UserId, t time.Time) (User, error) {
+	if err := ctx.Err(); err != nil {
+		return User{}, err
+	}
+	if Id == 0 {
+		return User{}, utility.ErrInvalidIdInput
+	}
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	user, ok := r.versionAt(Id, t)
+	if !ok {
+		return User{}, utility.ErrUserNotFound
+	}
+	return user, nil
+}
+
+// ListUsersAsOf pages through the users as they were at t, like ListUsers.
+func (r repo) ListUsersAsOf(ctx context.Context, pageSize int, page int, t time.Time) ([]User, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	users := []User{}
+	scanned := 0
+	for id := range r.history {
+		if scanned%checkInterval == 0 {
+			if err := ctx.Err(); err != nil {
+				return nil, err
+			}
+		}
+		scanned++
+		if user, ok := r.versionAt(id, t); ok {
+			users = append(users, user)
+		}
+	}
+
+	sort.Slice(users, func(i, j int) bool {
+		return users[i].ID < users[j].ID
+	})
+	return paginate(users, pageSize, page), nil
+}
@@ -0,0 +1,161 @@
+package user
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// IDGenerator allocates the IDs of users added with CreateUser.
+type IDGenerator interface {
+	NextID(ctx context.Context) (UserId, error)
+}
+
+// UUIDGenerator is implemented by generators that also give every created
+// user a UUID.
+type UUIDGenerator interface {
+	NextUUID() (string, error)
+}
+
+// resyncer is implemented by generators that need to look at the repository
+// again after handing out an ID that was already taken.
+type resyncer interface {
+	resync()
+}
+
+// sequentialGenerator hands out the IDs following the highest stored one.
+type sequentialGenerator struct {
+	repo Repository
+
+	mu     sync.Mutex
+	next   UserId
+	synced bool
+}
+
+func NewSequentialGenerator(repo Repository) IDGenerator {
+	return &sequentialGenerator{repo: repo}
+}
+
+func (g *sequentialGenerator) NextID(ctx context.Context) (UserId, error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if !g.synced {
+		users, err := g.repo.ListUsers(ctx, 0, 0)
+		if err != nil {
+			return 0, err
+		}
+		// ListUsers is sorted by ID
+		if len(users) > 0 && users[len(users)-1].ID >= g.next {
+			g.next = users[len(users)-1].ID + 1
+		}
+		if g.next < 1 {
+			g.next = 1
+		}
+		g.synced = true
+	}
+	id := g.next
+	g.next++
+	return id, nil
+}
+
+func (g *sequentialGenerator) resync() {
+	g.mu.Lock()
+	g.synced = false
+	g.mu.Unlock()
+}
+
+// snowflakeEpoch is the zero time of Snowflake IDs, 2024-01-01 UTC.
+var snowflakeEpoch = time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+const (
+	snowflakeNodeBits     = 10
+	snowflakeSequenceBits = 12
+	MaxSnowflakeNode      = 1<<snowflakeNodeBits - 1
+)
+
+// snowflakeGenerator builds IDs from 41 bits of milliseconds since
+// snowflakeEpoch, 10 bits of node and a 12 bit sequence within the
+// millisecond, so servers with distinct nodes never collide.
+type snowflakeGenerator struct {
+	node int64
+	now  func() time.Time
+
+	mu       sync.Mutex
+	lastMs   int64
+	sequence int64
+}
+
+func NewSnowflakeGenerator(node int64) (IDGenerator, error) {
+	return newSnowflakeGenerator(node, time.Now)
+}
+
+func newSnowflakeGenerator(node int64, now func() time.Time) (*snowflakeGenerator, error) {
+	if node < 0 || node > MaxSnowflakeNode {
+		return nil, fmt.Errorf("snowflake node must be between 0 and %d, got %d", MaxSnowflakeNode, node)
+	}
+	return &snowflakeGenerator{node: node, now: now}, nil
+}
+
+func (g *snowflakeGenerator) NextID(ctx context.Context) (UserId, error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	ms := g.now().Sub(snowflakeEpoch).Milliseconds()
+	// never go back in time, a clock step back reuses the last millisecond
+	if ms < g.lastMs {
+		ms = g.lastMs
+	}
+	if ms == g.lastMs {
+		g.sequence = (g.sequence + 1) & (1<<snowflakeSequenceBits - 1)
+		if g.sequence == 0 {
+			// sequence exhausted, borrow the next millisecond
+			ms++
+		}
+	} else {
+		g.sequence = 0
+	}
+	g.lastMs = ms
+
+	if ms >= 1<<41 {
+		return 0, errors.New("snowflake timestamp overflow")
+	}
+	return UserId(ms<<(snowflakeNodeBits+snowflakeSequenceBits) | g.node<<snowflakeSequenceBits | g.sequence), nil
+}
+
+// uuidv7Generator gives users a Snowflake ID, so every RPC can still address
+// them by number, and a UUIDv7.
+type uuidv7Generator struct {
+	*snowflakeGenerator
+}
+
+func NewUUIDv7Generator(node int64) (IDGenerator, error) {
+	snowflake, err := newSnowflakeGenerator(node, time.Now)
+	if err != nil {
+		return nil, err
+	}
+	return uuidv7Generator{snowflake}, nil
+}
+
+// NextUUID returns a RFC 9562 version 7 UUID: 48 bits of Unix milliseconds
+// followed by random bits.
+func (g uuidv7Generator) NextUUID() (string, error) {
+	var b [16]byte
+	if _, err := rand.Read(b[6:]); err != nil {
+		return "", err
+	}
+	ms := uint64(g.now().UnixMilli())
+	var ts [8]byte
+	binary.BigEndian.PutUint64(ts[:], ms)
+	copy(b[:6], ts[2:])
+	b[6] = b[6]&0x0f | 0x70 // version 7
+	b[8] = b[8]&0x3f | 0x80 // RFC 9562 variant
+
+	h := hex.EncodeToString(b[:])
+	return h[:8] + "-" + h[8:12] + "-" + h[12:16] + "-" + h[16:20] + "-" + h[20:], nil
+}
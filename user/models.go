@@ -1,14 +1,68 @@
 package user
 
-type UserId int
+import (
+	"encoding/json"
+	"time"
+)
+
+// UserId is 64 bits wide so server generated IDs, such as Snowflake IDs, fit.
+type UserId int64
+
+// DateLayout is the format of User.DateOfBirth.
+const DateLayout = "2006-01-02"
+
+type Address struct {
+	Street     string `json:"street,omitempty"`
+	City       string `json:"city"`
+	State      string `json:"state,omitempty"`
+	PostalCode string `json:"postal_code,omitempty"`
+	Country    string `json:"country,omitempty"`
+}
 
 type User struct {
-	ID      UserId
-	FName   string
-	City    string
-	Phone   int64
-	Height  float64
-	Married bool
+	ID          UserId  `json:"id"`
+	FName       string  `json:"fname"`
+	LName       string  `json:"lname,omitempty"`
+	Email       string  `json:"email,omitempty"`
+	DateOfBirth string  `json:"date_of_birth,omitempty"`
+	Address     Address `json:"address"`
+	Phone       int64   `json:"phone"`
+	Height      float64 `json:"height"`
+	Married     bool    `json:"married"`
+	UUID        string  `json:"uuid,omitempty"`
+	// Revision counts the writes of the user, starting at 1. It is the etag
+	// of the API.
+	Revision   int64     `json:"revision,omitempty"`
+	CreateTime time.Time `json:"create_time"`
+	UpdateTime time.Time `json:"update_time"`
+}
+
+// CurrentRevision is the revision of u. Users that were never updated, or
+// stored before revisions, have revision 0, which counts as the first one.
+func (u User) CurrentRevision() int64 {
+	if u.Revision == 0 {
+		return 1
+	}
+	return u.Revision
+}
+
+// UnmarshalJSON still reads the top level "city" of snapshots and seed files
+// written before Address replaced it. Unknown fields are ignored, so files
+// written by other tools or later versions load.
+func (u *User) UnmarshalJSON(data []byte) error {
+	type plain User
+	var v struct {
+		plain
+		City string `json:"city"`
+	}
+	if err := json.Unmarshal(data, &v); err != nil {
+		return err
+	}
+	*u = User(v.plain)
+	if u.Address.City == "" {
+		u.Address.City = v.City
+	}
+	return nil
 }
 
 type UserDB map[UserId]User
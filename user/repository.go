@@ -2,89 +2,326 @@ package user
 
 import (
 	"context"
+	"net/mail"
 	"sort"
+	"strings"
+	"sync"
+	"time"
 
 	"github.com/kunal768/go-grpc-tc/utility"
 )
 
 type Repository interface {
 	AddUser(ctx context.Context, user User) (User, error)
-	GetUserById(ctx context.Context, Id int) (User, error)
-	GetUsersById(ctx context.Context, Ids []int) []User
+	UpdateUser(ctx context.Context, user User) (User, error)
+	DeleteUser(ctx context.Context, Id UserId, revision int64) error
+	GetUserById(ctx context.Context, Id UserId) (User, error)
+	GetUsersById(ctx context.Context, Ids []UserId) ([]User, error)
 	SearchUsers(ctx context.Context, data UsersSearchRequest) ([]User, error)
-	ListUsers(ctx context.Context, pageSize int, page int) []User
+	ListUsers(ctx context.Context, pageSize int, page int) ([]User, error)
+	GetUserHistory(ctx context.Context, Id UserId) ([]Version, error)
+	GetUserByIdAsOf(ctx context.Context, Id UserId, t time.Time) (User, error)
+	ListUsersAsOf(ctx context.Context, pageSize int, page int, t time.Time) ([]User, error)
+	Transact(ctx context.Context, writes []Write) ([]User, error)
+	CountUsers(ctx context.Context) int
+	Close() error
 }
 
+// checkInterval is how many users a scan visits between checks of its
+// context, so an abandoned RPC stops walking the map early.
+const checkInterval = 64
+
 type repo struct {
+	mu *sync.RWMutex
 	db UserDB
+	// emails indexes the users with an email by NormalizeEmail.
+	emails map[string]UserId
+	// history holds every version of every user ever stored, oldest first.
+	history map[UserId][]Version
+	// outbox holds the changes for a publisher, nil without one.
+	outbox *outbox
+	// now stamps the versions of the history.
+	now func() time.Time
 }
 
 func NewRepository(db UserDB) Repository {
+	return newRepo(db)
+}
+
+func newRepo(db UserDB) *repo {
+	return newRepoWithHistory(db, nil)
+}
+
+func newRepoWithHistory(db UserDB, history map[UserId][]Version) *repo {
+	emails := map[string]UserId{}
+	for id, user := range db {
+		if user.Email != "" {
+			emails[NormalizeEmail(user.Email)] = id
+		}
+	}
 	return &repo{
-		db: db,
+		mu:      &sync.RWMutex{},
+		db:      db,
+		emails:  emails,
+		history: initialHistory(db, history),
+		now:     time.Now,
 	}
 }
 
-func (r repo) AddUser(ctx context.Context, user User) (User, error) {
+// NormalizeEmail is the form emails are compared in.
+func NormalizeEmail(email string) string {
+	return strings.ToLower(strings.TrimSpace(email))
+}
+
+// ValidateUser checks the fields AddUser requires.
+func ValidateUser(user User) error {
 	if user.ID == 0 {
-		return User{}, utility.ErrInvalidIdInput
+		return utility.ErrInvalidIdInput
 	}
 
-	if user.City == "" {
-		return User{}, utility.ErrInvalidCityInput
+	if user.Address.City == "" {
+		return utility.ErrInvalidCityInput
 	}
 
 	if user.FName == "" {
-		return User{}, utility.ErrInvalidFNameInput
+		return utility.ErrInvalidFNameInput
 	}
 
 	if int(user.Height) == 0 {
-		return User{}, utility.ErrInvalidHeightInput
+		return utility.ErrInvalidHeightInput
 	}
 
 	if user.Phone == 0 {
-		return User{}, utility.ErrInvalidPhoneInput
+		return utility.ErrInvalidPhoneInput
+	}
+
+	if user.Email != "" {
+		addr, err := mail.ParseAddress(user.Email)
+		// only a bare address, no display name or comments
+		if err != nil || addr.Address != user.Email {
+			return utility.ErrInvalidEmailInput
+		}
+	}
+
+	if user.DateOfBirth != "" {
+		dob, err := time.Parse(DateLayout, user.DateOfBirth)
+		if err != nil || dob.After(time.Now()) {
+			return utility.ErrInvalidDateOfBirthInput
+		}
+	}
+
+	if country := user.Address.Country; country != "" && !validCountry(country) {
+		return utility.ErrInvalidCountryInput
+	}
+
+	return nil
+}
+
+// validCountry reports whether country has the shape of an ISO 3166-1 alpha-2
+// code, two upper case letters.
+func validCountry(country string) bool {
+	if len(country) != 2 {
+		return false
+	}
+	for _, c := range country {
+		if c < 'A' || c > 'Z' {
+			return false
+		}
+	}
+	return true
+}
+
+// emailTaken reports whether another user than id has email.
+func (r repo) emailTaken(email string, id UserId) bool {
+	if email == "" {
+		return false
+	}
+	owner, ok := r.emails[NormalizeEmail(email)]
+	return ok && owner != id
+}
+
+func (r repo) AddUser(ctx context.Context, user User) (User, error) {
+	if err := ValidateUser(user); err != nil {
+		return User{}, err
+	}
+	if err := ctx.Err(); err != nil {
+		return User{}, err
 	}
 
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.addUser(ctx, user)
+}
+
+// addUser adds a validated user. Must be called with the write lock held.
+func (r repo) addUser(ctx context.Context, user User) (User, error) {
 	if _, exists := r.db[user.ID]; exists {
 		return User{}, utility.ErrUserIdAlreadyExists
 	}
+	if r.emailTaken(user.Email, user.ID) {
+		return User{}, utility.ErrEmailAlreadyExists
+	}
+	// a deleted ID added again goes on from the revision of its delete, so
+	// an etag of the deleted user never matches the new one
+	if versions := r.history[user.ID]; len(versions) > 0 {
+		user.Revision = versions[len(versions)-1].User.CurrentRevision() + 1
+	}
+	r.db[user.ID] = user
+	if user.Email != "" {
+		r.emails[NormalizeEmail(user.Email)] = user.ID
+	}
+	r.record(ctx, user, false)
+	return user, nil
+}
+
+// UpdateUser replaces an existing user, the ID selects the user to replace.
+// A non-zero Revision must match the stored user, the update then gets the
+// next revision. A zero CreateTime or UUID keeps the one of the stored user.
+func (r repo) UpdateUser(ctx context.Context, user User) (User, error) {
+	if err := ValidateUser(user); err != nil {
+		return User{}, err
+	}
+	if err := ctx.Err(); err != nil {
+		return User{}, err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.updateUser(ctx, user)
+}
+
+// updateUser replaces a user with a validated one. Must be called with the
+// write lock held.
+func (r repo) updateUser(ctx context.Context, user User) (User, error) {
+	old, exists := r.db[user.ID]
+	if !exists {
+		return User{}, utility.ErrUserNotFound
+	}
+	if user.Revision != 0 && user.Revision != old.CurrentRevision() {
+		return User{}, utility.ErrRevisionMismatch
+	}
+	if r.emailTaken(user.Email, user.ID) {
+		return User{}, utility.ErrEmailAlreadyExists
+	}
+	if user.CreateTime.IsZero() {
+		user.CreateTime = old.CreateTime
+	}
+	if user.UUID == "" {
+		user.UUID = old.UUID
+	}
+	user.Revision = old.CurrentRevision() + 1
 
+	if old.Email != "" {
+		delete(r.emails, NormalizeEmail(old.Email))
+	}
 	r.db[user.ID] = user
+	if user.Email != "" {
+		r.emails[NormalizeEmail(user.Email)] = user.ID
+	}
+	r.record(ctx, user, false)
+	return user, nil
+}
+
+// DeleteUser removes a user. A non-zero revision must match the stored
+// user.
+func (r repo) DeleteUser(ctx context.Context, Id UserId, revision int64) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	_, err := r.deleteUser(ctx, Id, revision)
+	return err
+}
+
+// deleteUser removes a user and returns it. Must be called with the write
+// lock held.
+func (r repo) deleteUser(ctx context.Context, Id UserId, revision int64) (User, error) {
+	user, err := r.checkUser(Id, revision)
+	if err != nil {
+		return User{}, err
+	}
+
+	delete(r.db, Id)
+	if user.Email != "" {
+		delete(r.emails, NormalizeEmail(user.Email))
+	}
+	r.record(ctx, user, true)
 	return user, nil
 }
 
-func (r repo) GetUserById(ctx context.Context, Id int) (User, error) {
+// checkUser returns a user, which must be at revision unless it is 0.
+func (r repo) checkUser(Id UserId, revision int64) (User, error) {
+	user, err := r.getUserById(Id)
+	if err != nil {
+		return User{}, err
+	}
+	if revision != 0 && revision != user.CurrentRevision() {
+		return User{}, utility.ErrRevisionMismatch
+	}
+	return user, nil
+}
+
+func (r repo) GetUserById(ctx context.Context, Id UserId) (User, error) {
+	if err := ctx.Err(); err != nil {
+		return User{}, err
+	}
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.getUserById(Id)
+}
+
+func (r repo) getUserById(Id UserId) (User, error) {
 	if Id == 0 {
 		return User{}, utility.ErrInvalidIdInput
 	}
-	user, found := r.db[UserId(Id)]
+	user, found := r.db[Id]
 	if !found {
 		return User{}, utility.ErrUserNotFound
 	}
 	return user, nil
 }
 
-func (r repo) GetUsersById(ctx context.Context, Ids []int) []User {
+func (r repo) GetUsersById(ctx context.Context, Ids []UserId) ([]User, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
 	ans := []User{}
-	for _, id := range Ids {
-		user, err := r.GetUserById(ctx, id)
+	for i, id := range Ids {
+		if i%checkInterval == 0 {
+			if err := ctx.Err(); err != nil {
+				return nil, err
+			}
+		}
+		user, err := r.getUserById(id)
 		if err == nil {
 			ans = append(ans, user)
 		}
 	}
-	return ans
+	return ans, nil
 }
 
 func (r repo) SearchUsers(ctx context.Context, data UsersSearchRequest) ([]User, error) {
-	if data.FName == "" && data.City == "" && data.Phone == 0 && data.Height == 0 && !data.Married && data.ID == 0 && !data.FindMarried {
+	if data.FName == "" && data.LName == "" && data.Email == "" && data.City == "" && data.Country == "" && data.Phone == 0 && data.Height == 0 && !data.Married && data.ID == 0 && !data.FindMarried && data.UUID == "" {
 		return nil, utility.ErrInvalidSearchRequest
 	}
 
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
 	ans := []User{}
+	scanned := 0
 	for _, user := range r.db {
+		if scanned%checkInterval == 0 {
+			if err := ctx.Err(); err != nil {
+				return nil, err
+			}
+		}
+		scanned++
+
 		match := true
-		if data.ID != 0 && user.ID != UserId(data.ID) {
+		if data.ID != 0 && user.ID != data.ID {
 			match = false
 		}
 
@@ -92,7 +329,19 @@ func (r repo) SearchUsers(ctx context.Context, data UsersSearchRequest) ([]User,
 			match = false
 		}
 
-		if data.City != "" && user.City != data.City {
+		if data.LName != "" && user.LName != data.LName {
+			match = false
+		}
+
+		if data.Email != "" && NormalizeEmail(user.Email) != NormalizeEmail(data.Email) {
+			match = false
+		}
+
+		if data.City != "" && user.Address.City != data.City {
+			match = false
+		}
+
+		if data.Country != "" && !strings.EqualFold(user.Address.Country, data.Country) {
 			match = false
 		}
 
@@ -100,10 +349,18 @@ func (r repo) SearchUsers(ctx context.Context, data UsersSearchRequest) ([]User,
 			match = false
 		}
 
+		if data.Height != 0 && user.Height != data.Height {
+			match = false
+		}
+
 		if data.FindMarried && data.Married != user.Married {
 			match = false
 		}
 
+		if data.UUID != "" && user.UUID != data.UUID {
+			match = false
+		}
+
 		if match {
 			ans = append(ans, user)
 		}
@@ -113,13 +370,17 @@ func (r repo) SearchUsers(ctx context.Context, data UsersSearchRequest) ([]User,
 	return ans, nil
 }
 
-func (r repo) ListUsers(ctx context.Context, pageSize int, page int) []User {
-	if pageSize <= 0 {
-		pageSize = len(r.db)
-	}
+func (r repo) ListUsers(ctx context.Context, pageSize int, page int) ([]User, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
 
 	users := make([]User, 0, len(r.db))
 	for _, user := range r.db {
+		if len(users)%checkInterval == 0 {
+			if err := ctx.Err(); err != nil {
+				return nil, err
+			}
+		}
 		users = append(users, user)
 	}
 
@@ -127,7 +388,14 @@ func (r repo) ListUsers(ctx context.Context, pageSize int, page int) []User {
 	sort.Slice(users, func(i, j int) bool {
 		return users[i].ID < users[j].ID
 	})
+	return paginate(users, pageSize, page), nil
+}
 
+// paginate returns a page of users, all of them if pageSize is not positive.
+func paginate(users []User, pageSize int, page int) []User {
+	if pageSize <= 0 {
+		pageSize = len(users)
+	}
 	start := page * pageSize
 	end := start + pageSize
 
@@ -141,3 +409,15 @@ func (r repo) ListUsers(ctx context.Context, pageSize int, page int) []User {
 
 	return users[start:end]
 }
+
+func (r repo) CountUsers(ctx context.Context) int {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return len(r.db)
+}
+
+// Close is a no-op for the in-memory repository, the data lives only as long
+// as the process does.
+func (r repo) Close() error {
+	return nil
+}
@@ -1,13 +1,17 @@
 package user
 
 type UsersSearchRequest struct {
-	ID          int
+	ID          UserId
 	FName       string
+	LName       string
+	Email       string
 	City        string
+	Country     string
 	Phone       int64
 	Height      float64
 	Married     bool
 	FindMarried bool
+	UUID        string
 }
 
 type UserResponse struct {
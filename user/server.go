@@ -3,7 +3,8 @@ package user
 import (
 	"context"
 
-	pb "github.com/kunal768/go-grpc-tc/proto"
+	pb "github.com/kunal768/go-grpc-tc/proto/users/v2"
+	"google.golang.org/protobuf/types/known/emptypb"
 )
 
 type userServiceServer struct {
@@ -17,22 +18,42 @@ func NewUserServiceServer(service Service) pb.UserServiceServer {
 	}
 }
 
-func (s *userServiceServer) GetUserByID(ctx context.Context, req *pb.UserIDRequest) (*pb.UserResponse, error) {
+func (s *userServiceServer) GetUserByID(ctx context.Context, req *pb.GetUserByIDRequest) (*pb.UserResponse, error) {
 	return s.service.GetUserByID(ctx, req)
 }
 
-func (s *userServiceServer) GetUsersByIDs(ctx context.Context, req *pb.UserIDsRequest) (*pb.UsersResponse, error) {
+func (s *userServiceServer) GetUsersByIDs(ctx context.Context, req *pb.GetUsersByIDsRequest) (*pb.UsersResponse, error) {
 	return s.service.GetUsersByIDs(ctx, req)
 }
 
-func (s *userServiceServer) SearchUsers(ctx context.Context, req *pb.SearchRequest) (*pb.UsersResponse, error) {
+func (s *userServiceServer) SearchUsers(ctx context.Context, req *pb.SearchUsersRequest) (*pb.UsersResponse, error) {
 	return s.service.SearchUsers(ctx, req)
 }
 
-func (s *userServiceServer) AddUser(ctx context.Context, req *pb.User) (*pb.UserResponse, error) {
+func (s *userServiceServer) AddUser(ctx context.Context, req *pb.AddUserRequest) (*pb.UserResponse, error) {
 	return s.service.AddUser(ctx, req)
 }
 
 func (s *userServiceServer) ListUsers(ctx context.Context, req *pb.ListUsersRequest) (*pb.UsersResponse, error) {
 	return s.service.ListUsers(ctx, req)
 }
+
+func (s *userServiceServer) CreateUser(ctx context.Context, req *pb.CreateUserRequest) (*pb.UserResponse, error) {
+	return s.service.CreateUser(ctx, req)
+}
+
+func (s *userServiceServer) UpdateUser(ctx context.Context, req *pb.UpdateUserRequest) (*pb.UserResponse, error) {
+	return s.service.UpdateUser(ctx, req)
+}
+
+func (s *userServiceServer) DeleteUser(ctx context.Context, req *pb.DeleteUserRequest) (*emptypb.Empty, error) {
+	return s.service.DeleteUser(ctx, req)
+}
+
+func (s *userServiceServer) BatchWrite(ctx context.Context, req *pb.BatchWriteRequest) (*pb.BatchWriteResponse, error) {
+	return s.service.BatchWrite(ctx, req)
+}
+
+func (s *userServiceServer) GetUserHistory(ctx context.Context, req *pb.GetUserHistoryRequest) (*pb.GetUserHistoryResponse, error) {
+	return s.service.GetUserHistory(ctx, req)
+}
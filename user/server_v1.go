@@ -0,0 +1,141 @@
+package user
+
+import (
+	"context"
+
+	pbv1 "github.com/kunal768/go-grpc-tc/proto/users/v1"
+	pb "github.com/kunal768/go-grpc-tc/proto/users/v2"
+)
+
+// userServiceServerV1 serves users.v1 by converting to and from the users.v2
+// messages of Service.
+type userServiceServerV1 struct {
+	pbv1.UnimplementedUserServiceServer
+	service Service
+}
+
+func NewUserServiceServerV1(service Service) pbv1.UserServiceServer {
+	return &userServiceServerV1{
+		service: service,
+	}
+}
+
+func (s *userServiceServerV1) GetUserByID(ctx context.Context, req *pbv1.UserIDRequest) (*pbv1.UserResponse, error) {
+	return userResponseV1(s.service.GetUserByID(ctx, &pb.GetUserByIDRequest{Id: req.Id}))
+}
+
+func (s *userServiceServerV1) GetUsersByIDs(ctx context.Context, req *pbv1.UserIDsRequest) (*pbv1.UsersResponse, error) {
+	return usersResponseV1(s.service.GetUsersByIDs(ctx, &pb.GetUsersByIDsRequest{Ids: req.Ids}))
+}
+
+func (s *userServiceServerV1) SearchUsers(ctx context.Context, req *pbv1.SearchRequest) (*pbv1.UsersResponse, error) {
+	search := &pb.SearchUsersRequest{
+		Id:      req.Id,
+		Uuid:    req.Uuid,
+		Fname:   req.Fname,
+		Lname:   req.Lname,
+		Email:   req.Email,
+		City:    req.City,
+		Country: req.Country,
+		Phone:   req.Phone,
+	}
+	if req.Searchmarried {
+		search.Married = &req.Married
+	}
+	return usersResponseV1(s.service.SearchUsers(ctx, search))
+}
+
+func (s *userServiceServerV1) AddUser(ctx context.Context, req *pbv1.User) (*pbv1.UserResponse, error) {
+	return userResponseV1(s.service.AddUser(ctx, &pb.AddUserRequest{User: FromV1(req)}))
+}
+
+func (s *userServiceServerV1) ListUsers(ctx context.Context, req *pbv1.ListUsersRequest) (*pbv1.UsersResponse, error) {
+	return usersResponseV1(s.service.ListUsers(ctx, &pb.ListUsersRequest{Page: req.Page, PageSize: req.PageSize}))
+}
+
+func (s *userServiceServerV1) CreateUser(ctx context.Context, req *pbv1.CreateUserRequest) (*pbv1.UserResponse, error) {
+	var user *pb.User
+	if req.User != nil {
+		user = FromV1(req.User)
+	}
+	return userResponseV1(s.service.CreateUser(ctx, &pb.CreateUserRequest{User: user}))
+}
+
+func userResponseV1(resp *pb.UserResponse, err error) (*pbv1.UserResponse, error) {
+	if err != nil {
+		return nil, err
+	}
+	return &pbv1.UserResponse{User: ToV1(resp.User)}, nil
+}
+
+func usersResponseV1(resp *pb.UsersResponse, err error) (*pbv1.UsersResponse, error) {
+	if err != nil {
+		return nil, err
+	}
+	users := make([]*pbv1.User, 0, len(resp.Users))
+	for _, user := range resp.Users {
+		users = append(users, ToV1(user))
+	}
+	return &pbv1.UsersResponse{Users: users}, nil
+}
+
+// ToV1 converts a users.v2 user to users.v1, which also carries the city
+// outside of the address.
+func ToV1(user *pb.User) *pbv1.User {
+	v1 := &pbv1.User{
+		Id:          user.Id,
+		Fname:       user.Fname,
+		Phone:       user.Phone,
+		Height:      user.Height,
+		Married:     user.Married,
+		Uuid:        user.Uuid,
+		Lname:       user.Lname,
+		Email:       user.Email,
+		DateOfBirth: user.DateOfBirth,
+		CreateTime:  user.CreateTime,
+		UpdateTime:  user.UpdateTime,
+	}
+	if a := user.Address; a != nil {
+		v1.City = a.City
+		v1.Address = &pbv1.Address{
+			Street:     a.Street,
+			City:       a.City,
+			State:      a.State,
+			PostalCode: a.PostalCode,
+			Country:    a.Country,
+		}
+	}
+	return v1
+}
+
+// FromV1 converts a users.v1 user to users.v2. The city is used when the
+// user has no address.
+func FromV1(user *pbv1.User) *pb.User {
+	v2 := &pb.User{
+		Id:          user.Id,
+		Fname:       user.Fname,
+		Phone:       user.Phone,
+		Height:      user.Height,
+		Married:     user.Married,
+		Uuid:        user.Uuid,
+		Lname:       user.Lname,
+		Email:       user.Email,
+		DateOfBirth: user.DateOfBirth,
+		Address:     &pb.Address{City: user.City},
+		CreateTime:  user.CreateTime,
+		UpdateTime:  user.UpdateTime,
+	}
+	if a := user.Address; a != nil {
+		v2.Address = &pb.Address{
+			Street:     a.Street,
+			City:       a.City,
+			State:      a.State,
+			PostalCode: a.PostalCode,
+			Country:    a.Country,
+		}
+		if v2.Address.City == "" {
+			v2.Address.City = user.City
+		}
+	}
+	return v2
+}
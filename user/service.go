@@ -2,140 +2,485 @@ package user
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
 
-	pb "github.com/kunal768/go-grpc-tc/proto"
+	"github.com/kunal768/go-grpc-tc/auth"
+	pb "github.com/kunal768/go-grpc-tc/proto/users/v2"
 	"github.com/kunal768/go-grpc-tc/utility"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/emptypb"
+	"google.golang.org/protobuf/types/known/timestamppb"
 )
 
+// Service implements the users.v2 API. The users.v1 server converts to and
+// from it.
 type Service interface {
-	AddUser(ctx context.Context, req *pb.User) (*pb.UserResponse, error)
-	GetUserByID(ctx context.Context, req *pb.UserIDRequest) (*pb.UserResponse, error)
-	GetUsersByIDs(ctx context.Context, req *pb.UserIDsRequest) (*pb.UsersResponse, error)
-	SearchUsers(ctx context.Context, req *pb.SearchRequest) (*pb.UsersResponse, error)
+	AddUser(ctx context.Context, req *pb.AddUserRequest) (*pb.UserResponse, error)
+	GetUserByID(ctx context.Context, req *pb.GetUserByIDRequest) (*pb.UserResponse, error)
+	GetUsersByIDs(ctx context.Context, req *pb.GetUsersByIDsRequest) (*pb.UsersResponse, error)
+	SearchUsers(ctx context.Context, req *pb.SearchUsersRequest) (*pb.UsersResponse, error)
 	ListUsers(ctx context.Context, req *pb.ListUsersRequest) (*pb.UsersResponse, error)
+	CreateUser(ctx context.Context, req *pb.CreateUserRequest) (*pb.UserResponse, error)
+	UpdateUser(ctx context.Context, req *pb.UpdateUserRequest) (*pb.UserResponse, error)
+	DeleteUser(ctx context.Context, req *pb.DeleteUserRequest) (*emptypb.Empty, error)
+	GetUserHistory(ctx context.Context, req *pb.GetUserHistoryRequest) (*pb.GetUserHistoryResponse, error)
+	BatchWrite(ctx context.Context, req *pb.BatchWriteRequest) (*pb.BatchWriteResponse, error)
+}
+
+type ServiceOptions struct {
+	// IDs allocates the IDs of CreateUser, sequential IDs if nil.
+	IDs IDGenerator
+	// Now stamps the create and update times, time.Now if nil.
+	Now func() time.Time
 }
 
 type svc struct {
 	repo Repository
+	ids  IDGenerator
+	now  func() time.Time
 }
 
 func NewService(repo Repository) Service {
+	return NewServiceWithOptions(repo, ServiceOptions{})
+}
+
+func NewServiceWithOptions(repo Repository, opts ServiceOptions) Service {
+	if opts.IDs == nil {
+		opts.IDs = NewSequentialGenerator(repo)
+	}
+	if opts.Now == nil {
+		opts.Now = time.Now
+	}
 	return &svc{
 		repo: repo,
+		ids:  opts.IDs,
+		now:  opts.Now,
 	}
 }
 
-func (s svc) AddUser(ctx context.Context, req *pb.User) (*pb.UserResponse, error) {
-	user, err := s.repo.AddUser(ctx, User{
-		ID:      UserId(req.Id),
-		FName:   req.Fname,
-		City:    req.City,
-		Phone:   req.Phone,
-		Height:  req.Height,
-		Married: req.Married,
-	})
+// withPrincipal attributes the writes made with ctx to the authenticated
+// principal, if any.
+func withPrincipal(ctx context.Context) context.Context {
+	if p, ok := auth.FromContext(ctx); ok {
+		return WithActor(ctx, p.Subject)
+	}
+	return ctx
+}
+
+// newUser converts a user sent by a client, replacing the timestamps the
+// server maintains.
+func (s svc) newUser(req *pb.User) User {
+	user := FromProto(req)
+	user.CreateTime = s.now().UTC()
+	user.UpdateTime = user.CreateTime
+	return user
+}
+
+func (s svc) AddUser(ctx context.Context, req *pb.AddUserRequest) (*pb.UserResponse, error) {
+	if req.User == nil {
+		return nil, status.Error(codes.InvalidArgument, "user is required")
+	}
+	user, err := s.repo.AddUser(withPrincipal(ctx), s.newUser(req.User))
 
 	if err != nil {
-		if err == utility.ErrUserIdAlreadyExists {
+		if err == utility.ErrUserIdAlreadyExists || err == utility.ErrEmailAlreadyExists {
 			return nil, status.Errorf(codes.AlreadyExists, err.Error())
 		}
-		return nil, status.Errorf(codes.InvalidArgument, err.Error())
+		return nil, repoError(err, codes.InvalidArgument)
+	}
+
+	return &pb.UserResponse{User: ToProto(user)}, nil
+}
+
+// createAttempts bounds the retries of CreateUser when a generated ID is
+// already taken, e.g. by a user added with an explicit ID.
+const createAttempts = 3
+
+func (s svc) CreateUser(ctx context.Context, req *pb.CreateUserRequest) (*pb.UserResponse, error) {
+	if req.User == nil {
+		return nil, status.Error(codes.InvalidArgument, "user is required")
+	}
+	if req.User.Id != 0 || req.User.Uuid != "" {
+		return nil, status.Error(codes.InvalidArgument, "id and uuid are assigned by the server")
 	}
 
-	return &pb.UserResponse{User: &pb.User{
-		Id:      int32(user.ID),
-		Fname:   user.FName,
-		City:    user.City,
-		Phone:   user.Phone,
-		Height:  user.Height,
-		Married: user.Married,
-	}}, nil
+	user := s.newUser(req.User)
+	if err := s.assignUUID(&user); err != nil {
+		return nil, err
+	}
+
+	for attempt := 1; ; attempt++ {
+		id, err := s.ids.NextID(ctx)
+		if err != nil {
+			return nil, repoError(err, codes.Internal)
+		}
+		user.ID = id
+
+		created, err := s.repo.AddUser(withPrincipal(ctx), user)
+		if err == nil {
+			return &pb.UserResponse{User: ToProto(created)}, nil
+		}
+		if err == utility.ErrEmailAlreadyExists {
+			return nil, status.Error(codes.AlreadyExists, err.Error())
+		}
+		if err != utility.ErrUserIdAlreadyExists {
+			return nil, repoError(err, codes.InvalidArgument)
+		}
+		if attempt == createAttempts {
+			return nil, status.Error(codes.Aborted, "could not allocate a free ID, retry")
+		}
+		if r, ok := s.ids.(resyncer); ok {
+			r.resync()
+		}
+	}
 }
 
-func (s svc) GetUserByID(ctx context.Context, req *pb.UserIDRequest) (*pb.UserResponse, error) {
-	user, err := s.repo.GetUserById(ctx, int(req.Id))
+// assignUUID gives a created user a UUID when the ID generator makes them.
+func (s svc) assignUUID(user *User) error {
+	uuids, ok := s.ids.(UUIDGenerator)
+	if !ok {
+		return nil
+	}
+	uuid, err := uuids.NextUUID()
 	if err != nil {
-		return nil, status.Errorf(codes.InvalidArgument, err.Error())
+		return status.Errorf(codes.Internal, "generating UUID: %v", err)
 	}
-	return &pb.UserResponse{User: &pb.User{
-		Id:      int32(user.ID),
-		Fname:   user.FName,
-		City:    user.City,
-		Phone:   user.Phone,
-		Height:  user.Height,
-		Married: user.Married,
-	}}, nil
+	user.UUID = uuid
+	return nil
 }
 
-func (s svc) GetUsersByIDs(ctx context.Context, req *pb.UserIDsRequest) (*pb.UsersResponse, error) {
-	users := s.repo.GetUsersById(ctx, convertToIntSlice(req.Ids))
+// updatedUser converts the user of an update, keeping the stored create
+// time and uuid. The etag becomes the revision to match.
+func (s svc) updatedUser(req *pb.User) (User, error) {
+	if req == nil {
+		return User{}, errors.New("user is required")
+	}
+	revision, err := ParseETag(req.Etag)
+	if err != nil {
+		return User{}, err
+	}
+
+	user := FromProto(req)
+	user.CreateTime = time.Time{}
+	user.UUID = ""
+	user.UpdateTime = s.now().UTC()
+	user.Revision = revision
+	return user, nil
+}
+
+func (s svc) UpdateUser(ctx context.Context, req *pb.UpdateUserRequest) (*pb.UserResponse, error) {
+	user, err := s.updatedUser(req.User)
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+
+	updated, err := s.repo.UpdateUser(withPrincipal(ctx), user)
+	if err != nil {
+		return nil, writeError(err)
+	}
+	return &pb.UserResponse{User: ToProto(updated)}, nil
+}
+
+func (s svc) DeleteUser(ctx context.Context, req *pb.DeleteUserRequest) (*emptypb.Empty, error) {
+	revision, err := ParseETag(req.Etag)
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	if err := s.repo.DeleteUser(withPrincipal(ctx), UserId(req.Id), revision); err != nil {
+		return nil, writeError(err)
+	}
+	return &emptypb.Empty{}, nil
+}
+
+// MaxBatchOperations caps the operations of one BatchWrite.
+const MaxBatchOperations = 100
+
+func (s svc) BatchWrite(ctx context.Context, req *pb.BatchWriteRequest) (*pb.BatchWriteResponse, error) {
+	if len(req.Operations) == 0 {
+		return nil, status.Error(codes.InvalidArgument, "operations are required")
+	}
+	if len(req.Operations) > MaxBatchOperations {
+		return nil, status.Errorf(codes.InvalidArgument, "at most %d operations are allowed, got %d", MaxBatchOperations, len(req.Operations))
+	}
+
+	writes := make([]Write, len(req.Operations))
+	for i, op := range req.Operations {
+		w, err := s.write(op)
+		if err != nil {
+			return nil, status.Errorf(codes.InvalidArgument, "operation %d: %v", i, err)
+		}
+		if w.Kind == WriteCreate {
+			if err := s.assignUUID(&w.User); err != nil {
+				return nil, err
+			}
+		}
+		writes[i] = w
+	}
+
+	for attempt := 1; ; attempt++ {
+		for i := range writes {
+			if writes[i].Kind != WriteCreate {
+				continue
+			}
+			id, err := s.ids.NextID(ctx)
+			if err != nil {
+				return nil, repoError(err, codes.Internal)
+			}
+			writes[i].User.ID = id
+		}
+
+		users, err := s.repo.Transact(withPrincipal(ctx), writes)
+		if err == nil {
+			resp := &pb.BatchWriteResponse{Results: make([]*pb.WriteResult, len(users))}
+			for i, user := range users {
+				resp.Results[i] = &pb.WriteResult{User: ToProto(user)}
+			}
+			return resp, nil
+		}
+		// only a generated ID that was taken is worth retrying
+		var writeErr *WriteError
+		if !errors.As(err, &writeErr) || writes[writeErr.Index].Kind != WriteCreate || !errors.Is(err, utility.ErrUserIdAlreadyExists) {
+			return nil, writeError(err)
+		}
+		if attempt == createAttempts {
+			return nil, status.Error(codes.Aborted, "could not allocate a free ID, retry")
+		}
+		if r, ok := s.ids.(resyncer); ok {
+			r.resync()
+		}
+	}
+}
+
+// write converts an operation of a BatchWrite, the IDs of creates are
+// allocated later.
+func (s svc) write(op *pb.WriteOperation) (Write, error) {
+	switch op := op.GetOperation().(type) {
+	case *pb.WriteOperation_Create:
+		if op.Create.GetUser() == nil {
+			return Write{}, errors.New("user is required")
+		}
+		if op.Create.User.Id != 0 || op.Create.User.Uuid != "" {
+			return Write{}, errors.New("id and uuid are assigned by the server")
+		}
+		return Write{Kind: WriteCreate, User: s.newUser(op.Create.User)}, nil
+	case *pb.WriteOperation_Update:
+		user, err := s.updatedUser(op.Update.GetUser())
+		return Write{Kind: WriteUpdate, User: user}, err
+	case *pb.WriteOperation_Delete:
+		revision, err := ParseETag(op.Delete.Etag)
+		return Write{Kind: WriteDelete, ID: UserId(op.Delete.Id), Revision: revision}, err
+	case *pb.WriteOperation_Check:
+		revision, err := ParseETag(op.Check.Etag)
+		return Write{Kind: WriteCheck, ID: UserId(op.Check.Id), Revision: revision}, err
+	}
+	return Write{}, utility.ErrInvalidWrite
+}
+
+// writeError converts the errors of updates and deletes of existing users.
+func writeError(err error) error {
+	switch {
+	case errors.Is(err, utility.ErrUserNotFound):
+		return status.Error(codes.NotFound, err.Error())
+	case errors.Is(err, utility.ErrRevisionMismatch):
+		return status.Error(codes.Aborted, err.Error())
+	case errors.Is(err, utility.ErrEmailAlreadyExists):
+		return status.Error(codes.AlreadyExists, err.Error())
+	}
+	return repoError(err, codes.InvalidArgument)
+}
+
+// ETag is the etag of a user at revision.
+func ETag(revision int64) string {
+	return strconv.FormatInt(revision, 10)
+}
+
+// ParseETag returns the revision of etag, 0 for an empty etag.
+func ParseETag(etag string) (int64, error) {
+	if etag == "" {
+		return 0, nil
+	}
+	revision, err := strconv.ParseInt(etag, 10, 64)
+	if err != nil || revision <= 0 {
+		return 0, fmt.Errorf("invalid etag %q", etag)
+	}
+	return revision, nil
+}
+
+func (s svc) GetUserByID(ctx context.Context, req *pb.GetUserByIDRequest) (*pb.UserResponse, error) {
+	var user User
+	var err error
+	if req.AsOf != nil {
+		user, err = s.repo.GetUserByIdAsOf(ctx, UserId(req.Id), req.AsOf.AsTime())
+	} else {
+		user, err = s.repo.GetUserById(ctx, UserId(req.Id))
+	}
+	if err != nil {
+		return nil, repoError(err, codes.InvalidArgument)
+	}
+	return &pb.UserResponse{User: ToProto(user)}, nil
+}
+
+func (s svc) GetUsersByIDs(ctx context.Context, req *pb.GetUsersByIDsRequest) (*pb.UsersResponse, error) {
+	users, err := s.repo.GetUsersById(ctx, toUserIds(req.Ids))
+	if err != nil {
+		return nil, repoError(err, codes.Internal)
+	}
 	var pbUsers []*pb.User
 	for _, user := range users {
-		pbUsers = append(pbUsers, &pb.User{
-			Id:      int32(user.ID),
-			Fname:   user.FName,
-			City:    user.City,
-			Phone:   user.Phone,
-			Height:  user.Height,
-			Married: user.Married,
-		})
+		pbUsers = append(pbUsers, ToProto(user))
 	}
 	return &pb.UsersResponse{Users: pbUsers}, nil
 }
 
-func (s svc) SearchUsers(ctx context.Context, req *pb.SearchRequest) (*pb.UsersResponse, error) {
+func (s svc) SearchUsers(ctx context.Context, req *pb.SearchUsersRequest) (*pb.UsersResponse, error) {
 	users, err := s.repo.SearchUsers(ctx, UsersSearchRequest{
-		ID:          int(req.Id),
+		ID:          UserId(req.Id),
 		FName:       req.Fname,
+		LName:       req.Lname,
+		Email:       req.Email,
 		City:        req.City,
+		Country:     req.Country,
 		Phone:       req.Phone,
 		Height:      req.Height,
-		Married:     req.Married,
-		FindMarried: req.Searchmarried,
+		Married:     req.GetMarried(),
+		FindMarried: req.Married != nil,
+		UUID:        req.Uuid,
 	})
 
 	if err != nil {
-		return nil, status.Errorf(codes.InvalidArgument, err.Error())
+		return nil, repoError(err, codes.InvalidArgument)
 	}
 
 	var pbUsers []*pb.User
 	for _, user := range users {
-		pbUsers = append(pbUsers, &pb.User{
-			Id:      int32(user.ID),
-			Fname:   user.FName,
-			City:    user.City,
-			Phone:   user.Phone,
-			Height:  user.Height,
-			Married: user.Married,
-		})
+		pbUsers = append(pbUsers, ToProto(user))
 	}
 	return &pb.UsersResponse{Users: pbUsers}, nil
 }
 
 func (s svc) ListUsers(ctx context.Context, req *pb.ListUsersRequest) (*pb.UsersResponse, error) {
-	users := s.repo.ListUsers(ctx, int(req.PageSize), int(req.Page))
+	var users []User
+	var err error
+	if req.AsOf != nil {
+		users, err = s.repo.ListUsersAsOf(ctx, int(req.PageSize), int(req.Page), req.AsOf.AsTime())
+	} else {
+		users, err = s.repo.ListUsers(ctx, int(req.PageSize), int(req.Page))
+	}
+	if err != nil {
+		return nil, repoError(err, codes.Internal)
+	}
 
 	var pbUsers []*pb.User
 	for _, user := range users {
-		pbUsers = append(pbUsers, &pb.User{
-			Id:      int32(user.ID),
-			Fname:   user.FName,
-			City:    user.City,
-			Phone:   user.Phone,
-			Height:  user.Height,
-			Married: user.Married,
-		})
+		pbUsers = append(pbUsers, ToProto(user))
 	}
 
 	return &pb.UsersResponse{Users: pbUsers}, nil
 }
 
-func convertToIntSlice(ids []int32) []int {
-	var intIds []int
+func (s svc) GetUserHistory(ctx context.Context, req *pb.GetUserHistoryRequest) (*pb.GetUserHistoryResponse, error) {
+	versions, err := s.repo.GetUserHistory(ctx, UserId(req.Id))
+	if errors.Is(err, utility.ErrUserNotFound) {
+		return nil, status.Error(codes.NotFound, err.Error())
+	}
+	if err != nil {
+		return nil, repoError(err, codes.InvalidArgument)
+	}
+
+	resp := &pb.GetUserHistoryResponse{}
+	for _, version := range versions {
+		resp.Versions = append(resp.Versions, &pb.UserVersion{
+			User:    ToProto(version.User),
+			Actor:   version.Actor,
+			Time:    toTimestamp(version.Time),
+			Deleted: version.Deleted,
+		})
+	}
+	return resp, nil
+}
+
+// repoError converts a repository error to a status with code, except when
+// the RPC was cancelled or ran out of time, which keep their own codes, and
+// calls outside of a tenant, which are denied.
+func repoError(err error, code codes.Code) error {
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return status.FromContextError(err).Err()
+	}
+	if errors.Is(err, utility.ErrTenantRequired) || errors.Is(err, utility.ErrUnknownTenant) {
+		return status.Error(codes.PermissionDenied, err.Error())
+	}
+	return status.Error(code, err.Error())
+}
+
+func ToProto(user User) *pb.User {
+	return &pb.User{
+		Id:          int64(user.ID),
+		Fname:       user.FName,
+		Lname:       user.LName,
+		Email:       user.Email,
+		DateOfBirth: user.DateOfBirth,
+		Address: &pb.Address{
+			Street:     user.Address.Street,
+			City:       user.Address.City,
+			State:      user.Address.State,
+			PostalCode: user.Address.PostalCode,
+			Country:    user.Address.Country,
+		},
+		Phone:      user.Phone,
+		Height:     user.Height,
+		Married:    user.Married,
+		Uuid:       user.UUID,
+		CreateTime: toTimestamp(user.CreateTime),
+		UpdateTime: toTimestamp(user.UpdateTime),
+		Etag:       ETag(user.CurrentRevision()),
+	}
+}
+
+func FromProto(user *pb.User) User {
+	u := User{
+		ID:          UserId(user.Id),
+		FName:       user.Fname,
+		LName:       user.Lname,
+		Email:       user.Email,
+		DateOfBirth: user.DateOfBirth,
+		Phone:       user.Phone,
+		Height:      user.Height,
+		Married:     user.Married,
+		UUID:        user.Uuid,
+	}
+	if a := user.Address; a != nil {
+		u.Address = Address{
+			Street:     a.Street,
+			City:       a.City,
+			State:      a.State,
+			PostalCode: a.PostalCode,
+			Country:    a.Country,
+		}
+	}
+	if user.CreateTime != nil {
+		u.CreateTime = user.CreateTime.AsTime()
+	}
+	if user.UpdateTime != nil {
+		u.UpdateTime = user.UpdateTime.AsTime()
+	}
+	return u
+}
+
+func toTimestamp(t time.Time) *timestamppb.Timestamp {
+	if t.IsZero() {
+		return nil
+	}
+	return timestamppb.New(t)
+}
+
+func toUserIds(ids []int64) []UserId {
+	var userIds []UserId
 	for _, id := range ids {
-		intIds = append(intIds, int(id))
+		userIds = append(userIds, UserId(id))
 	}
-	return intIds
+	return userIds
 }
@@ -0,0 +1,238 @@
+package user
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/kunal768/go-grpc-tc/tenant"
+	"github.com/kunal768/go-grpc-tc/utility"
+)
+
+// tenantRepo keeps the users of every tenant in a repository of its own and
+// routes each call to the one of the tenant in its context. Calls without a
+// tenant fail, so no call can reach the users of another tenant.
+type tenantRepo struct {
+	repos map[string]Repository
+}
+
+// NewTenantRepository routes calls to repos by the tenant in their context.
+func NewTenantRepository(repos map[string]Repository) Repository {
+	return &tenantRepo{repos: repos}
+}
+
+func (t *tenantRepo) repo(ctx context.Context) (Repository, error) {
+	name, ok := tenant.FromContext(ctx)
+	if !ok {
+		return nil, utility.ErrTenantRequired
+	}
+	repo, ok := t.repos[name]
+	if !ok {
+		return nil, utility.ErrUnknownTenant
+	}
+	return repo, nil
+}
+
+func (t *tenantRepo) AddUser(ctx context.Context, user User) (User, error) {
+	repo, err := t.repo(ctx)
+	if err != nil {
+		return User{}, err
+	}
+	return repo.AddUser(ctx, user)
+}
+
+func (t *tenantRepo) UpdateUser(ctx context.Context, user User) (User, error) {
+	repo, err := t.repo(ctx)
+	if err != nil {
+		return User{}, err
+	}
+	return repo.UpdateUser(ctx, user)
+}
+
+func (t *tenantRepo) DeleteUser(ctx context.Context, Id UserId, revision int64) error {
+	repo, err := t.repo(ctx)
+	if err != nil {
+		return err
+	}
+	return repo.DeleteUser(ctx, Id, revision)
+}
+
+func (t *tenantRepo) GetUserById(ctx context.Context, Id UserId) (User, error) {
+	repo, err := t.repo(ctx)
+	if err != nil {
+		return User{}, err
+	}
+	return repo.GetUserById(ctx, Id)
+}
+
+func (t *tenantRepo) GetUsersById(ctx context.Context, Ids []UserId) ([]User, error) {
+	repo, err := t.repo(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return repo.GetUsersById(ctx, Ids)
+}
+
+func (t *tenantRepo) SearchUsers(ctx context.Context, data UsersSearchRequest) ([]User, error) {
+	repo, err := t.repo(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return repo.SearchUsers(ctx, data)
+}
+
+func (t *tenantRepo) ListUsers(ctx context.Context, pageSize int, page int) ([]User, error) {
+	repo, err := t.repo(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return repo.ListUsers(ctx, pageSize, page)
+}
+
+func (t *tenantRepo) GetUserHistory(ctx context.Context, Id UserId) ([]Version, error) {
+	repo, err := t.repo(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return repo.GetUserHistory(ctx, Id)
+}
+
+func (t *tenantRepo) GetUserByIdAsOf(ctx context.Context, Id UserId, at time.Time) (User, error) {
+	repo, err := t.repo(ctx)
+	if err != nil {
+		return User{}, err
+	}
+	return repo.GetUserByIdAsOf(ctx, Id, at)
+}
+
+func (t *tenantRepo) ListUsersAsOf(ctx context.Context, pageSize int, page int, at time.Time) ([]User, error) {
+	repo, err := t.repo(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return repo.ListUsersAsOf(ctx, pageSize, page, at)
+}
+
+func (t *tenantRepo) Transact(ctx context.Context, writes []Write) ([]User, error) {
+	repo, err := t.repo(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return repo.Transact(ctx, writes)
+}
+
+func (t *tenantRepo) PendingChanges(ctx context.Context, limit int) ([]Change, error) {
+	feed, err := t.feed(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return feed.PendingChanges(ctx, limit)
+}
+
+func (t *tenantRepo) AckChanges(ctx context.Context, seq int64) error {
+	feed, err := t.feed(ctx)
+	if err != nil {
+		return err
+	}
+	return feed.AckChanges(ctx, seq)
+}
+
+// feed is the outbox of the tenant in ctx.
+func (t *tenantRepo) feed(ctx context.Context) (ChangeFeed, error) {
+	repo, err := t.repo(ctx)
+	if err != nil {
+		return nil, err
+	}
+	feed, ok := repo.(ChangeFeed)
+	if !ok {
+		return nil, utility.ErrNoOutbox
+	}
+	return feed, nil
+}
+
+// CountUsers counts the users of the tenant in ctx, 0 for a context without
+// one. CountAllUsers counts the users of every tenant.
+func (t *tenantRepo) CountUsers(ctx context.Context) int {
+	repo, err := t.repo(ctx)
+	if err != nil {
+		return 0
+	}
+	return repo.CountUsers(ctx)
+}
+
+// CountAllUsers counts the users of every tenant together.
+func (t *tenantRepo) CountAllUsers() int {
+	total := 0
+	for name, repo := range t.repos {
+		total += repo.CountUsers(tenant.NewContext(context.Background(), name))
+	}
+	return total
+}
+
+// CountAllUsers counts the users of every tenant of repo, for operators such
+// as the user count metric. Repositories without tenants count their users.
+func CountAllUsers(repo Repository) int {
+	if t, ok := repo.(interface{ CountAllUsers() int }); ok {
+		return t.CountAllUsers()
+	}
+	return repo.CountUsers(context.Background())
+}
+
+func (t *tenantRepo) Close() error {
+	var errs []error
+	for _, repo := range t.repos {
+		errs = append(errs, repo.Close())
+	}
+	return errors.Join(errs...)
+}
+
+// tenantGenerator gives every tenant an ID generator of its own, so each
+// tenant has its own ID space.
+type tenantGenerator struct {
+	newGenerator func() IDGenerator
+
+	mu         sync.Mutex
+	generators map[string]IDGenerator
+}
+
+// NewTenantGenerator allocates IDs with a generator per tenant, created by
+// newGenerator on first use.
+func NewTenantGenerator(newGenerator func() IDGenerator) IDGenerator {
+	return &tenantGenerator{newGenerator: newGenerator, generators: map[string]IDGenerator{}}
+}
+
+func (g *tenantGenerator) generator(ctx context.Context) (IDGenerator, error) {
+	name, ok := tenant.FromContext(ctx)
+	if !ok {
+		return nil, utility.ErrTenantRequired
+	}
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	gen, ok := g.generators[name]
+	if !ok {
+		gen = g.newGenerator()
+		g.generators[name] = gen
+	}
+	return gen, nil
+}
+
+func (g *tenantGenerator) NextID(ctx context.Context) (UserId, error) {
+	gen, err := g.generator(ctx)
+	if err != nil {
+		return 0, err
+	}
+	return gen.NextID(ctx)
+}
+
+// resync resyncs every tenant, it is not told which one handed out a taken
+// ID.
+func (g *tenantGenerator) resync() {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	for _, gen := range g.generators {
+		if r, ok := gen.(resyncer); ok {
+			r.resync()
+		}
+	}
+}
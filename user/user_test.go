@@ -2,23 +2,32 @@ package user
 
 import (
 	"context"
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
+	"time"
 
-	pb "github.com/kunal768/go-grpc-tc/proto"
+	"github.com/kunal768/go-grpc-tc/auth"
+	pb "github.com/kunal768/go-grpc-tc/proto/users/v1"
+	pbv2 "github.com/kunal768/go-grpc-tc/proto/users/v2"
+	"github.com/kunal768/go-grpc-tc/tenant"
 	"github.com/kunal768/go-grpc-tc/utility"
 	"github.com/stretchr/testify/assert"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/timestamppb"
 )
 
 func TestUserRepository_GetUserById(t *testing.T) {
 	t.Run("User found", func(t *testing.T) {
 		repo := NewRepository(UserDB{
-			1: {ID: 1, FName: "John", City: "New York", Phone: 1234567890, Height: 180.5, Married: true},
+			1: {ID: 1, FName: "John", Address: Address{City: "New York"}, Phone: 1234567890, Height: 180.5, Married: true},
 		})
 		user, err := repo.GetUserById(context.Background(), 1)
 		assert.NoError(t, err)
-		assert.Equal(t, User{ID: 1, FName: "John", City: "New York", Phone: 1234567890, Height: 180.5, Married: true}, user)
+		assert.Equal(t, User{ID: 1, FName: "John", Address: Address{City: "New York"}, Phone: 1234567890, Height: 180.5, Married: true}, user)
 	})
 
 	t.Run("User not found", func(t *testing.T) {
@@ -31,67 +40,76 @@ func TestUserRepository_GetUserById(t *testing.T) {
 func TestUserRepository_GetUsersById(t *testing.T) {
 	t.Run("All users found", func(t *testing.T) {
 		repo := NewRepository(UserDB{
-			1: {ID: 1, FName: "John", City: "New York", Phone: 1234567890, Height: 180.5, Married: true},
-			2: {ID: 2, FName: "Jane", City: "Los Angeles", Phone: 9876543210, Height: 165.2, Married: false},
+			1: {ID: 1, FName: "John", Address: Address{City: "New York"}, Phone: 1234567890, Height: 180.5, Married: true},
+			2: {ID: 2, FName: "Jane", Address: Address{City: "Los Angeles"}, Phone: 9876543210, Height: 165.2, Married: false},
 		})
-		users := repo.GetUsersById(context.Background(), []int{1, 2})
+		users, err := repo.GetUsersById(context.Background(), []UserId{1, 2})
+		assert.NoError(t, err)
 		assert.Len(t, users, 2)
-		assert.Equal(t, User{ID: 1, FName: "John", City: "New York", Phone: 1234567890, Height: 180.5, Married: true}, users[0])
-		assert.Equal(t, User{ID: 2, FName: "Jane", City: "Los Angeles", Phone: 9876543210, Height: 165.2, Married: false}, users[1])
+		assert.Equal(t, User{ID: 1, FName: "John", Address: Address{City: "New York"}, Phone: 1234567890, Height: 180.5, Married: true}, users[0])
+		assert.Equal(t, User{ID: 2, FName: "Jane", Address: Address{City: "Los Angeles"}, Phone: 9876543210, Height: 165.2, Married: false}, users[1])
 	})
 
 	t.Run("Some users not found", func(t *testing.T) {
 		repo := NewRepository(UserDB{
-			1: {ID: 1, FName: "John", City: "New York", Phone: 1234567890, Height: 180.5, Married: true},
+			1: {ID: 1, FName: "John", Address: Address{City: "New York"}, Phone: 1234567890, Height: 180.5, Married: true},
 		})
-		users := repo.GetUsersById(context.Background(), []int{1, 2})
+		users, err := repo.GetUsersById(context.Background(), []UserId{1, 2})
+		assert.NoError(t, err)
 		assert.Len(t, users, 1)
-		assert.Equal(t, User{ID: 1, FName: "John", City: "New York", Phone: 1234567890, Height: 180.5, Married: true}, users[0])
+		assert.Equal(t, User{ID: 1, FName: "John", Address: Address{City: "New York"}, Phone: 1234567890, Height: 180.5, Married: true}, users[0])
 	})
 }
 
 func TestUserRepository_SearchUsers(t *testing.T) {
 	repo := NewRepository(UserDB{
-		1: {ID: 1, FName: "John", City: "New York", Phone: 1234567890, Height: 180.5, Married: true},
-		2: {ID: 2, FName: "Jane", City: "Los Angeles", Phone: 9876543210, Height: 165.2, Married: false},
-		3: {ID: 3, FName: "Bob", City: "Chicago", Phone: 5555555555, Height: 175.0, Married: true},
+		1: {ID: 1, FName: "John", Address: Address{City: "New York"}, Phone: 1234567890, Height: 180.5, Married: true},
+		2: {ID: 2, FName: "Jane", Address: Address{City: "Los Angeles"}, Phone: 9876543210, Height: 165.2, Married: false},
+		3: {ID: 3, FName: "Bob", Address: Address{City: "Chicago"}, Phone: 5555555555, Height: 175.0, Married: true},
 	})
 
 	t.Run("Search by ID", func(t *testing.T) {
 		users, _ := repo.SearchUsers(context.Background(), UsersSearchRequest{ID: 2})
 		assert.Len(t, users, 1)
-		assert.Equal(t, User{ID: 2, FName: "Jane", City: "Los Angeles", Phone: 9876543210, Height: 165.2, Married: false}, users[0])
+		assert.Equal(t, User{ID: 2, FName: "Jane", Address: Address{City: "Los Angeles"}, Phone: 9876543210, Height: 165.2, Married: false}, users[0])
 	})
 
 	t.Run("Search by first name", func(t *testing.T) {
 		users, _ := repo.SearchUsers(context.Background(), UsersSearchRequest{FName: "John"})
 		assert.Len(t, users, 1)
-		assert.Equal(t, User{ID: 1, FName: "John", City: "New York", Phone: 1234567890, Height: 180.5, Married: true}, users[0])
+		assert.Equal(t, User{ID: 1, FName: "John", Address: Address{City: "New York"}, Phone: 1234567890, Height: 180.5, Married: true}, users[0])
 	})
 
 	t.Run("Search by city", func(t *testing.T) {
 		users, _ := repo.SearchUsers(context.Background(), UsersSearchRequest{City: "Chicago"})
 		assert.Len(t, users, 1)
-		assert.Equal(t, User{ID: 3, FName: "Bob", City: "Chicago", Phone: 5555555555, Height: 175.0, Married: true}, users[0])
+		assert.Equal(t, User{ID: 3, FName: "Bob", Address: Address{City: "Chicago"}, Phone: 5555555555, Height: 175.0, Married: true}, users[0])
 	})
 
 	t.Run("Search by phone", func(t *testing.T) {
 		users, _ := repo.SearchUsers(context.Background(), UsersSearchRequest{Phone: 9876543210})
 		assert.Len(t, users, 1)
-		assert.Equal(t, User{ID: 2, FName: "Jane", City: "Los Angeles", Phone: 9876543210, Height: 165.2, Married: false}, users[0])
+		assert.Equal(t, User{ID: 2, FName: "Jane", Address: Address{City: "Los Angeles"}, Phone: 9876543210, Height: 165.2, Married: false}, users[0])
+	})
+
+	t.Run("Search by height", func(t *testing.T) {
+		users, _ := repo.SearchUsers(context.Background(), UsersSearchRequest{Height: 175.0})
+		assert.Len(t, users, 1)
+		assert.Equal(t, User{ID: 3, FName: "Bob", Address: Address{City: "Chicago"}, Phone: 5555555555, Height: 175.0, Married: true}, users[0])
 	})
 
 	t.Run("Search by married status", func(t *testing.T) {
 		users, _ := repo.SearchUsers(context.Background(), UsersSearchRequest{Married: true, FindMarried: true})
-		assert.Len(t, users, 2)
-		assert.Equal(t, User{ID: 1, FName: "John", City: "New York", Phone: 1234567890, Height: 180.5, Married: true}, users[0])
-		assert.Equal(t, User{ID: 3, FName: "Bob", City: "Chicago", Phone: 5555555555, Height: 175.0, Married: true}, users[1])
+		assert.ElementsMatch(t, []User{
+			{ID: 1, FName: "John", Address: Address{City: "New York"}, Phone: 1234567890, Height: 180.5, Married: true},
+			{ID: 3, FName: "Bob", Address: Address{City: "Chicago"}, Phone: 5555555555, Height: 175.0, Married: true},
+		}, users)
 	})
 
 	t.Run("Search by married status if married is false", func(t *testing.T) {
 		users, _ := repo.SearchUsers(context.Background(), UsersSearchRequest{Married: false, FindMarried: true})
 		assert.Len(t, users, 1)
-		assert.Equal(t, User{ID: 2, FName: "Jane", City: "Los Angeles", Phone: 9876543210, Height: 165.2, Married: false}, users[0])
+		assert.Equal(t, User{ID: 2, FName: "Jane", Address: Address{City: "Los Angeles"}, Phone: 9876543210, Height: 165.2, Married: false}, users[0])
 	})
 
 	t.Run("Search by invalid request", func(t *testing.T) {
@@ -102,10 +120,10 @@ func TestUserRepository_SearchUsers(t *testing.T) {
 
 func TestUserService(t *testing.T) {
 	repo := NewRepository(UserDB{
-		1: {ID: 1, FName: "John", City: "New York", Phone: 1234567890, Height: 180.5, Married: true},
-		2: {ID: 2, FName: "Jane", City: "Los Angeles", Phone: 9876543210, Height: 165.2, Married: false},
+		1: {ID: 1, FName: "John", Address: Address{City: "New York"}, Phone: 1234567890, Height: 180.5, Married: true},
+		2: {ID: 2, FName: "Jane", Address: Address{City: "Los Angeles"}, Phone: 9876543210, Height: 165.2, Married: false},
 	})
-	service := NewService(repo)
+	service := NewUserServiceServerV1(NewService(repo))
 
 	t.Run("GetUserByID", func(t *testing.T) {
 		resp, err := service.GetUserByID(context.Background(), &pb.UserIDRequest{Id: 1})
@@ -114,6 +132,7 @@ func TestUserService(t *testing.T) {
 			Id:      1,
 			Fname:   "John",
 			City:    "New York",
+			Address: &pb.Address{City: "New York"},
 			Phone:   1234567890,
 			Height:  180.5,
 			Married: true,
@@ -121,13 +140,14 @@ func TestUserService(t *testing.T) {
 	})
 
 	t.Run("GetUsersByIDs", func(t *testing.T) {
-		resp, err := service.GetUsersByIDs(context.Background(), &pb.UserIDsRequest{Ids: []int32{1, 2}})
+		resp, err := service.GetUsersByIDs(context.Background(), &pb.UserIDsRequest{Ids: []int64{1, 2}})
 		assert.NoError(t, err)
 		assert.Len(t, resp.Users, 2)
 		assert.Equal(t, &pb.User{
 			Id:      1,
 			Fname:   "John",
 			City:    "New York",
+			Address: &pb.Address{City: "New York"},
 			Phone:   1234567890,
 			Height:  180.5,
 			Married: true,
@@ -136,6 +156,7 @@ func TestUserService(t *testing.T) {
 			Id:      2,
 			Fname:   "Jane",
 			City:    "Los Angeles",
+			Address: &pb.Address{City: "Los Angeles"},
 			Phone:   9876543210,
 			Height:  165.2,
 			Married: false,
@@ -156,6 +177,7 @@ func TestUserService(t *testing.T) {
 			Id:      2,
 			Fname:   "Jane",
 			City:    "Los Angeles",
+			Address: &pb.Address{City: "Los Angeles"},
 			Phone:   9876543210,
 			Height:  165.2,
 			Married: false,
@@ -166,7 +188,7 @@ func TestUserService(t *testing.T) {
 func TestUserRepository_AddUser(t *testing.T) {
 	t.Run("Add new user", func(t *testing.T) {
 		repo := NewRepository(UserDB{})
-		user := User{ID: 1, FName: "John", City: "New York", Phone: 1234567890, Height: 180.5, Married: true}
+		user := User{ID: 1, FName: "John", Address: Address{City: "New York"}, Phone: 1234567890, Height: 180.5, Married: true}
 		savedUser, err := repo.AddUser(context.Background(), user)
 		assert.NoError(t, err)
 		assert.Equal(t, user, savedUser)
@@ -174,16 +196,16 @@ func TestUserRepository_AddUser(t *testing.T) {
 
 	t.Run("Add user with existing ID", func(t *testing.T) {
 		repo := NewRepository(UserDB{
-			1: {ID: 1, FName: "John", City: "New York", Phone: 1234567890, Height: 180.5, Married: true},
+			1: {ID: 1, FName: "John", Address: Address{City: "New York"}, Phone: 1234567890, Height: 180.5, Married: true},
 		})
-		user := User{ID: 1, FName: "Jane", City: "Los Angeles", Phone: 9876543210, Height: 165.2, Married: false}
+		user := User{ID: 1, FName: "Jane", Address: Address{City: "Los Angeles"}, Phone: 9876543210, Height: 165.2, Married: false}
 		_, err := repo.AddUser(context.Background(), user)
 		assert.ErrorIs(t, err, utility.ErrUserIdAlreadyExists)
 	})
 
 	t.Run("Add new user with valid data", func(t *testing.T) {
 		repo := NewRepository(UserDB{})
-		user := User{ID: 1, FName: "John", City: "New York", Phone: 1234567890, Height: 180.5, Married: true}
+		user := User{ID: 1, FName: "John", Address: Address{City: "New York"}, Phone: 1234567890, Height: 180.5, Married: true}
 		savedUser, err := repo.AddUser(context.Background(), user)
 		assert.NoError(t, err)
 		assert.Equal(t, user, savedUser)
@@ -191,44 +213,44 @@ func TestUserRepository_AddUser(t *testing.T) {
 
 	t.Run("Add user with invalid ID", func(t *testing.T) {
 		repo := NewRepository(UserDB{})
-		user := User{ID: 0, FName: "John", City: "New York", Phone: 1234567890, Height: 180.5, Married: true}
+		user := User{ID: 0, FName: "John", Address: Address{City: "New York"}, Phone: 1234567890, Height: 180.5, Married: true}
 		_, err := repo.AddUser(context.Background(), user)
 		assert.ErrorIs(t, err, utility.ErrInvalidIdInput)
 	})
 
 	t.Run("Add user with empty city", func(t *testing.T) {
 		repo := NewRepository(UserDB{})
-		user := User{ID: 1, FName: "John", City: "", Phone: 1234567890, Height: 180.5, Married: true}
+		user := User{ID: 1, FName: "John", Address: Address{City: ""}, Phone: 1234567890, Height: 180.5, Married: true}
 		_, err := repo.AddUser(context.Background(), user)
 		assert.ErrorIs(t, err, utility.ErrInvalidCityInput)
 	})
 
 	t.Run("Add user with empty first name", func(t *testing.T) {
 		repo := NewRepository(UserDB{})
-		user := User{ID: 1, FName: "", City: "New York", Phone: 1234567890, Height: 180.5, Married: true}
+		user := User{ID: 1, FName: "", Address: Address{City: "New York"}, Phone: 1234567890, Height: 180.5, Married: true}
 		_, err := repo.AddUser(context.Background(), user)
 		assert.ErrorIs(t, err, utility.ErrInvalidFNameInput)
 	})
 
 	t.Run("Add user with invalid height", func(t *testing.T) {
 		repo := NewRepository(UserDB{})
-		user := User{ID: 1, FName: "John", City: "New York", Phone: 1234567890, Height: 0, Married: true}
+		user := User{ID: 1, FName: "John", Address: Address{City: "New York"}, Phone: 1234567890, Height: 0, Married: true}
 		_, err := repo.AddUser(context.Background(), user)
 		assert.ErrorIs(t, err, utility.ErrInvalidHeightInput)
 	})
 
 	t.Run("Add user with invalid phone", func(t *testing.T) {
 		repo := NewRepository(UserDB{})
-		user := User{ID: 1, FName: "John", City: "New York", Phone: 0, Height: 180.5, Married: true}
+		user := User{ID: 1, FName: "John", Address: Address{City: "New York"}, Phone: 0, Height: 180.5, Married: true}
 		_, err := repo.AddUser(context.Background(), user)
 		assert.ErrorIs(t, err, utility.ErrInvalidPhoneInput)
 	})
 
 	t.Run("Add second user with existing ID", func(t *testing.T) {
 		repo := NewRepository(UserDB{
-			1: {ID: 1, FName: "John", City: "New York", Phone: 1234567890, Height: 180.5, Married: true},
+			1: {ID: 1, FName: "John", Address: Address{City: "New York"}, Phone: 1234567890, Height: 180.5, Married: true},
 		})
-		user := User{ID: 1, FName: "Jane", City: "Los Angeles", Phone: 9876543210, Height: 165.2, Married: false}
+		user := User{ID: 1, FName: "Jane", Address: Address{City: "Los Angeles"}, Phone: 9876543210, Height: 165.2, Married: false}
 		_, err := repo.AddUser(context.Background(), user)
 		assert.ErrorIs(t, err, utility.ErrUserIdAlreadyExists)
 	})
@@ -237,32 +259,35 @@ func TestUserRepository_AddUser(t *testing.T) {
 func TestUserRepository_ListUsers(t *testing.T) {
 	t.Run("List all users", func(t *testing.T) {
 		repo := NewRepository(UserDB{
-			1: {ID: 1, FName: "John", City: "New York", Phone: 1234567890, Height: 180.5, Married: true},
-			2: {ID: 2, FName: "Jane", City: "Los Angeles", Phone: 9876543210, Height: 165.2, Married: false},
-			3: {ID: 3, FName: "Bob", City: "Chicago", Phone: 5555555555, Height: 175.0, Married: true},
+			1: {ID: 1, FName: "John", Address: Address{City: "New York"}, Phone: 1234567890, Height: 180.5, Married: true},
+			2: {ID: 2, FName: "Jane", Address: Address{City: "Los Angeles"}, Phone: 9876543210, Height: 165.2, Married: false},
+			3: {ID: 3, FName: "Bob", Address: Address{City: "Chicago"}, Phone: 5555555555, Height: 175.0, Married: true},
 		})
-		users := repo.ListUsers(context.Background(), 10, 1)
+		users, err := repo.ListUsers(context.Background(), 10, 1)
+		assert.NoError(t, err)
 		assert.Len(t, users, 3)
-		assert.Equal(t, User{ID: 1, FName: "John", City: "New York", Phone: 1234567890, Height: 180.5, Married: true}, users[0])
-		assert.Equal(t, User{ID: 2, FName: "Jane", City: "Los Angeles", Phone: 9876543210, Height: 165.2, Married: false}, users[1])
-		assert.Equal(t, User{ID: 3, FName: "Bob", City: "Chicago", Phone: 5555555555, Height: 175.0, Married: true}, users[2])
+		assert.Equal(t, User{ID: 1, FName: "John", Address: Address{City: "New York"}, Phone: 1234567890, Height: 180.5, Married: true}, users[0])
+		assert.Equal(t, User{ID: 2, FName: "Jane", Address: Address{City: "Los Angeles"}, Phone: 9876543210, Height: 165.2, Married: false}, users[1])
+		assert.Equal(t, User{ID: 3, FName: "Bob", Address: Address{City: "Chicago"}, Phone: 5555555555, Height: 175.0, Married: true}, users[2])
 	})
 
 	t.Run("List users with pagination", func(t *testing.T) {
 		repo := NewRepository(UserDB{
-			1: {ID: 1, FName: "John", City: "New York", Phone: 1234567890, Height: 180.5, Married: true},
-			2: {ID: 2, FName: "Jane", City: "Los Angeles", Phone: 9876543210, Height: 165.2, Married: false},
-			3: {ID: 3, FName: "Bob", City: "Chicago", Phone: 5555555555, Height: 175.0, Married: true},
+			1: {ID: 1, FName: "John", Address: Address{City: "New York"}, Phone: 1234567890, Height: 180.5, Married: true},
+			2: {ID: 2, FName: "Jane", Address: Address{City: "Los Angeles"}, Phone: 9876543210, Height: 165.2, Married: false},
+			3: {ID: 3, FName: "Bob", Address: Address{City: "Chicago"}, Phone: 5555555555, Height: 175.0, Married: true},
 		})
-		users := repo.ListUsers(context.Background(), 2, 1)
+		users, err := repo.ListUsers(context.Background(), 2, 1)
+		assert.NoError(t, err)
 		assert.Len(t, users, 1)
-		assert.Equal(t, User{ID: 3, FName: "Bob", City: "Chicago", Phone: 5555555555, Height: 175.0, Married: true}, users[0])
+		assert.Equal(t, User{ID: 3, FName: "Bob", Address: Address{City: "Chicago"}, Phone: 5555555555, Height: 175.0, Married: true}, users[0])
 	})
 }
 
 func TestUserService_AddUser(t *testing.T) {
 	repo := NewRepository(UserDB{})
-	service := NewService(repo)
+	now := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+	service := NewUserServiceServerV1(NewServiceWithOptions(repo, ServiceOptions{Now: func() time.Time { return now }}))
 
 	t.Run("Add new user", func(t *testing.T) {
 		resp, err := service.AddUser(context.Background(), &pb.User{
@@ -275,12 +300,15 @@ func TestUserService_AddUser(t *testing.T) {
 		})
 		assert.NoError(t, err)
 		assert.Equal(t, &pb.User{
-			Id:      1,
-			Fname:   "John",
-			City:    "New York",
-			Phone:   1234567890,
-			Height:  180.5,
-			Married: true,
+			Id:         1,
+			Fname:      "John",
+			City:       "New York",
+			Address:    &pb.Address{City: "New York"},
+			Phone:      1234567890,
+			Height:     180.5,
+			Married:    true,
+			CreateTime: timestamppb.New(now),
+			UpdateTime: timestamppb.New(now),
 		}, resp.User)
 	})
 
@@ -307,12 +335,15 @@ func TestUserService_AddUser(t *testing.T) {
 		})
 		assert.NoError(t, err)
 		assert.Equal(t, &pb.User{
-			Id:      5,
-			Fname:   "Apple",
-			City:    "New York",
-			Phone:   4353234562,
-			Height:  180.5,
-			Married: true,
+			Id:         5,
+			Fname:      "Apple",
+			City:       "New York",
+			Address:    &pb.Address{City: "New York"},
+			Phone:      4353234562,
+			Height:     180.5,
+			Married:    true,
+			CreateTime: timestamppb.New(now),
+			UpdateTime: timestamppb.New(now),
 		}, resp.User)
 	})
 
@@ -392,11 +423,11 @@ func TestUserService_AddUser(t *testing.T) {
 
 func TestUserService_ListUsers(t *testing.T) {
 	repo := NewRepository(UserDB{
-		1: {ID: 1, FName: "John", City: "New York", Phone: 1234567890, Height: 180.5, Married: true},
-		2: {ID: 2, FName: "Jane", City: "Los Angeles", Phone: 9876543210, Height: 165.2, Married: false},
-		3: {ID: 3, FName: "Bob", City: "Chicago", Phone: 5555555555, Height: 175.0, Married: true},
+		1: {ID: 1, FName: "John", Address: Address{City: "New York"}, Phone: 1234567890, Height: 180.5, Married: true},
+		2: {ID: 2, FName: "Jane", Address: Address{City: "Los Angeles"}, Phone: 9876543210, Height: 165.2, Married: false},
+		3: {ID: 3, FName: "Bob", Address: Address{City: "Chicago"}, Phone: 5555555555, Height: 175.0, Married: true},
 	})
-	service := NewService(repo)
+	service := NewUserServiceServerV1(NewService(repo))
 
 	t.Run("List all users", func(t *testing.T) {
 		resp, err := service.ListUsers(context.Background(), &pb.ListUsersRequest{
@@ -409,6 +440,7 @@ func TestUserService_ListUsers(t *testing.T) {
 			Id:      1,
 			Fname:   "John",
 			City:    "New York",
+			Address: &pb.Address{City: "New York"},
 			Phone:   1234567890,
 			Height:  180.5,
 			Married: true,
@@ -417,6 +449,7 @@ func TestUserService_ListUsers(t *testing.T) {
 			Id:      2,
 			Fname:   "Jane",
 			City:    "Los Angeles",
+			Address: &pb.Address{City: "Los Angeles"},
 			Phone:   9876543210,
 			Height:  165.2,
 			Married: false,
@@ -425,6 +458,7 @@ func TestUserService_ListUsers(t *testing.T) {
 			Id:      3,
 			Fname:   "Bob",
 			City:    "Chicago",
+			Address: &pb.Address{City: "Chicago"},
 			Phone:   5555555555,
 			Height:  175.0,
 			Married: true,
@@ -442,9 +476,778 @@ func TestUserService_ListUsers(t *testing.T) {
 			Id:      3,
 			Fname:   "Bob",
 			City:    "Chicago",
+			Address: &pb.Address{City: "Chicago"},
 			Phone:   5555555555,
 			Height:  175.0,
 			Married: true,
 		}, resp.Users[0])
 	})
 }
+
+func TestFileRepository(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "users.json")
+
+	t.Run("Close flushes pending writes", func(t *testing.T) {
+		repo, err := NewFileRepository(path, time.Hour)
+		assert.NoError(t, err)
+		_, err = repo.AddUser(context.Background(), User{ID: 1, FName: "John", Address: Address{City: "New York"}, Phone: 1234567890, Height: 180.5, Married: true})
+		assert.NoError(t, err)
+		assert.NoError(t, repo.Close())
+	})
+
+	t.Run("Reopen loads the snapshot", func(t *testing.T) {
+		repo, err := NewFileRepository(path, time.Hour)
+		assert.NoError(t, err)
+		defer repo.Close()
+		user, err := repo.GetUserById(context.Background(), 1)
+		assert.NoError(t, err)
+		assert.Equal(t, User{ID: 1, FName: "John", Address: Address{City: "New York"}, Phone: 1234567890, Height: 180.5, Married: true}, user)
+	})
+
+	t.Run("Writes are flushed periodically", func(t *testing.T) {
+		repo, err := NewFileRepository(path, 10*time.Millisecond)
+		assert.NoError(t, err)
+		defer repo.Close()
+		_, err = repo.AddUser(context.Background(), User{ID: 2, FName: "Jane", Address: Address{City: "Los Angeles"}, Phone: 9876543210, Height: 165.2, Married: false})
+		assert.NoError(t, err)
+		assert.Eventually(t, func() bool {
+			data, err := os.ReadFile(path)
+			return err == nil && strings.Contains(string(data), `"fname": "Jane"`)
+		}, time.Second, 10*time.Millisecond)
+	})
+}
+
+func TestUserRepository_UpdateUser(t *testing.T) {
+	repo := NewRepository(UserDB{
+		1: {ID: 1, FName: "John", Address: Address{City: "New York"}, Phone: 1234567890, Height: 180.5, Married: true},
+	})
+
+	t.Run("Update existing user", func(t *testing.T) {
+		user := User{ID: 1, FName: "John", Address: Address{City: "Boston"}, Phone: 1234567890, Height: 180.5, Married: false}
+		savedUser, err := repo.UpdateUser(context.Background(), user)
+		assert.NoError(t, err)
+		user.Revision = 2
+		assert.Equal(t, user, savedUser)
+		found, _ := repo.GetUserById(context.Background(), 1)
+		assert.Equal(t, user, found)
+	})
+
+	t.Run("Update missing user", func(t *testing.T) {
+		_, err := repo.UpdateUser(context.Background(), User{ID: 2, FName: "Jane", Address: Address{City: "Los Angeles"}, Phone: 9876543210, Height: 165.2})
+		assert.ErrorIs(t, err, utility.ErrUserNotFound)
+	})
+
+	t.Run("Update with invalid data", func(t *testing.T) {
+		_, err := repo.UpdateUser(context.Background(), User{ID: 1, FName: "John", Phone: 1234567890, Height: 180.5})
+		assert.ErrorIs(t, err, utility.ErrInvalidCityInput)
+	})
+}
+
+func TestUserRepository_Cancellation(t *testing.T) {
+	db := UserDB{}
+	for id := 1; id <= 1000; id++ {
+		db[UserId(id)] = User{ID: UserId(id), FName: "John", Address: Address{City: "New York"}, Phone: 1234567890, Height: 180.5}
+	}
+	repo := NewRepository(db)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	_, err := repo.SearchUsers(ctx, UsersSearchRequest{City: "New York"})
+	assert.ErrorIs(t, err, context.Canceled)
+	_, err = repo.ListUsers(ctx, 0, 0)
+	assert.ErrorIs(t, err, context.Canceled)
+	_, err = repo.GetUsersById(ctx, []UserId{1, 2})
+	assert.ErrorIs(t, err, context.Canceled)
+	_, err = repo.GetUserById(ctx, 1)
+	assert.ErrorIs(t, err, context.Canceled)
+
+	t.Run("Service keeps the cancellation code", func(t *testing.T) {
+		service := NewUserServiceServerV1(NewService(repo))
+		_, err := service.ListUsers(ctx, &pb.ListUsersRequest{})
+		assert.Equal(t, codes.Canceled, status.Code(err))
+
+		expired, cancel := context.WithDeadline(context.Background(), time.Now().Add(-time.Second))
+		defer cancel()
+		_, err = service.SearchUsers(expired, &pb.SearchRequest{City: "New York"})
+		assert.Equal(t, codes.DeadlineExceeded, status.Code(err))
+	})
+}
+
+func TestUserService_CreateUser(t *testing.T) {
+	newUser := &pb.User{Fname: "John", City: "New York", Phone: 1234567890, Height: 180.5}
+
+	t.Run("Sequential IDs follow the highest stored ID", func(t *testing.T) {
+		repo := NewRepository(UserDB{
+			7: {ID: 7, FName: "Jane", Address: Address{City: "Los Angeles"}, Phone: 9876543210, Height: 165.2},
+		})
+		service := NewUserServiceServerV1(NewService(repo))
+		resp, err := service.CreateUser(context.Background(), &pb.CreateUserRequest{User: newUser})
+		assert.NoError(t, err)
+		assert.Equal(t, int64(8), resp.User.Id)
+		assert.Empty(t, resp.User.Uuid)
+
+		// an explicit ID taken behind the generator's back is skipped
+		_, err = repo.AddUser(context.Background(), User{ID: 9, FName: "Jim", Address: Address{City: "Boston"}, Phone: 5555555555, Height: 175})
+		assert.NoError(t, err)
+		resp, err = service.CreateUser(context.Background(), &pb.CreateUserRequest{User: newUser})
+		assert.NoError(t, err)
+		assert.Equal(t, int64(10), resp.User.Id)
+	})
+
+	t.Run("Client supplied identifiers are rejected", func(t *testing.T) {
+		service := NewUserServiceServerV1(NewService(NewRepository(UserDB{})))
+		_, err := service.CreateUser(context.Background(), &pb.CreateUserRequest{User: &pb.User{Id: 1, Fname: "John", City: "New York", Phone: 1234567890, Height: 180.5}})
+		assert.Equal(t, codes.InvalidArgument, status.Code(err))
+		_, err = service.CreateUser(context.Background(), &pb.CreateUserRequest{})
+		assert.Equal(t, codes.InvalidArgument, status.Code(err))
+	})
+
+	t.Run("UUIDv7 generator assigns a UUID", func(t *testing.T) {
+		ids, err := NewUUIDv7Generator(3)
+		assert.NoError(t, err)
+		repo := NewRepository(UserDB{})
+		service := NewUserServiceServerV1(NewServiceWithOptions(repo, ServiceOptions{IDs: ids}))
+		resp, err := service.CreateUser(context.Background(), &pb.CreateUserRequest{User: newUser})
+		assert.NoError(t, err)
+		assert.Regexp(t, `^[0-9a-f]{8}-[0-9a-f]{4}-7[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$`, resp.User.Uuid)
+		assert.Greater(t, resp.User.Id, int64(1<<32))
+
+		users, err := repo.SearchUsers(context.Background(), UsersSearchRequest{UUID: resp.User.Uuid})
+		assert.NoError(t, err)
+		assert.Len(t, users, 1)
+		assert.Equal(t, UserId(resp.User.Id), users[0].ID)
+	})
+}
+
+func TestSnowflakeGenerator(t *testing.T) {
+	now := snowflakeEpoch.Add(time.Hour)
+	g, err := newSnowflakeGenerator(5, func() time.Time { return now })
+	assert.NoError(t, err)
+
+	seen := map[UserId]bool{}
+	var last UserId
+	// more IDs than one millisecond's sequence holds
+	for i := 0; i < 5000; i++ {
+		id, err := g.NextID(context.Background())
+		assert.NoError(t, err)
+		assert.Greater(t, id, last)
+		assert.False(t, seen[id])
+		assert.Equal(t, int64(5), int64(id)>>snowflakeSequenceBits&MaxSnowflakeNode)
+		seen[id] = true
+		last = id
+	}
+
+	// a clock stepping back does not reuse IDs
+	now = now.Add(-time.Second)
+	id, err := g.NextID(context.Background())
+	assert.NoError(t, err)
+	assert.Greater(t, id, last)
+
+	_, err = NewSnowflakeGenerator(MaxSnowflakeNode + 1)
+	assert.Error(t, err)
+}
+
+func TestUserRepository_Emails(t *testing.T) {
+	repo := NewRepository(UserDB{
+		1: {ID: 1, FName: "John", Email: "john@example.com", Address: Address{City: "New York"}, Phone: 1234567890, Height: 180.5},
+	})
+	jane := User{ID: 2, FName: "Jane", Email: "John@Example.com", Address: Address{City: "Los Angeles"}, Phone: 9876543210, Height: 165.2}
+
+	_, err := repo.AddUser(context.Background(), jane)
+	assert.ErrorIs(t, err, utility.ErrEmailAlreadyExists)
+
+	jane.Email = "Jane <jane@example.com>"
+	_, err = repo.AddUser(context.Background(), jane)
+	assert.ErrorIs(t, err, utility.ErrInvalidEmailInput)
+
+	jane.Email = "jane@example.com"
+	_, err = repo.AddUser(context.Background(), jane)
+	assert.NoError(t, err)
+
+	t.Run("Update releases the old email", func(t *testing.T) {
+		john, err := repo.GetUserById(context.Background(), 1)
+		assert.NoError(t, err)
+		john.Email = "jane@example.com"
+		_, err = repo.UpdateUser(context.Background(), john)
+		assert.ErrorIs(t, err, utility.ErrEmailAlreadyExists)
+
+		john.Email = "johnny@example.com"
+		_, err = repo.UpdateUser(context.Background(), john)
+		assert.NoError(t, err)
+		jane.Email = "john@example.com"
+		_, err = repo.UpdateUser(context.Background(), jane)
+		assert.NoError(t, err)
+	})
+
+	t.Run("Search matches emails case-insensitively", func(t *testing.T) {
+		users, err := repo.SearchUsers(context.Background(), UsersSearchRequest{Email: "JOHNNY@example.com"})
+		assert.NoError(t, err)
+		assert.Len(t, users, 1)
+		assert.Equal(t, UserId(1), users[0].ID)
+	})
+}
+
+func TestValidateUser_DateOfBirth(t *testing.T) {
+	user := User{ID: 1, FName: "John", Address: Address{City: "New York"}, Phone: 1234567890, Height: 180.5}
+	for dob, valid := range map[string]bool{
+		"1990-04-01": true,
+		"1990-4-1":   false,
+		"1990-02-30": false,
+		time.Now().AddDate(1, 0, 0).Format(DateLayout): false,
+	} {
+		user.DateOfBirth = dob
+		if valid {
+			assert.NoError(t, ValidateUser(user), dob)
+		} else {
+			assert.ErrorIs(t, ValidateUser(user), utility.ErrInvalidDateOfBirthInput, dob)
+		}
+	}
+}
+
+func TestValidateUser_Country(t *testing.T) {
+	user := User{ID: 1, FName: "John", Address: Address{City: "New York"}, Phone: 1234567890, Height: 180.5}
+	for country, valid := range map[string]bool{
+		"":    true,
+		"US":  true,
+		"us":  false,
+		"USA": false,
+		"U1":  false,
+	} {
+		user.Address.Country = country
+		if valid {
+			assert.NoError(t, ValidateUser(user), country)
+		} else {
+			assert.ErrorIs(t, ValidateUser(user), utility.ErrInvalidCountryInput, country)
+		}
+	}
+}
+
+func TestUserRepository_SearchAddress(t *testing.T) {
+	repo := NewRepository(UserDB{
+		1: {ID: 1, FName: "John", LName: "Smith", Address: Address{City: "Portland", Country: "US"}, Phone: 1234567890, Height: 180.5},
+		2: {ID: 2, FName: "Jane", LName: "Smith", Address: Address{City: "Portland", Country: "AU"}, Phone: 9876543210, Height: 165.2},
+	})
+	users, err := repo.SearchUsers(context.Background(), UsersSearchRequest{LName: "Smith", City: "Portland", Country: "us"})
+	assert.NoError(t, err)
+	assert.Len(t, users, 1)
+	assert.Equal(t, UserId(1), users[0].ID)
+}
+
+func TestUserService_Timestamps(t *testing.T) {
+	created := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+	repo := NewRepository(UserDB{})
+	service := NewUserServiceServerV1(NewServiceWithOptions(repo, ServiceOptions{Now: func() time.Time { return created }}))
+
+	// timestamps sent by the client are replaced
+	resp, err := service.AddUser(context.Background(), &pb.User{
+		Id: 1, Fname: "John", Address: &pb.Address{City: "New York"}, Phone: 1234567890, Height: 180.5,
+		CreateTime: timestamppb.New(created.Add(-time.Hour)),
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, created, resp.User.CreateTime.AsTime())
+	assert.Equal(t, created, resp.User.UpdateTime.AsTime())
+	assert.Equal(t, "New York", resp.User.City)
+
+	_, err = service.AddUser(context.Background(), &pb.User{Id: 2, Fname: "Jane", Email: "jane@example.com", Address: &pb.Address{City: "Boston"}, Phone: 9876543210, Height: 165.2})
+	assert.NoError(t, err)
+	_, err = service.CreateUser(context.Background(), &pb.CreateUserRequest{User: &pb.User{Fname: "Jim", Email: "JANE@example.com", Address: &pb.Address{City: "Boston"}, Phone: 5555555555, Height: 175}})
+	assert.Equal(t, codes.AlreadyExists, status.Code(err))
+
+	// updates keep the create time
+	user := FromProto(FromV1(resp.User))
+	user.CreateTime = time.Time{}
+	user.UpdateTime = created.Add(time.Hour)
+	updated, err := repo.UpdateUser(context.Background(), user)
+	assert.NoError(t, err)
+	assert.Equal(t, created, updated.CreateTime)
+}
+
+func TestUserService_V2(t *testing.T) {
+	service := NewService(NewRepository(UserDB{
+		1: {ID: 1, FName: "John", Address: Address{City: "New York"}, Phone: 1234567890, Height: 180.5, Married: true},
+		2: {ID: 2, FName: "Jane", Address: Address{City: "New York"}, Phone: 9876543210, Height: 165.2, Married: false},
+	}))
+
+	t.Run("Married filters only when set", func(t *testing.T) {
+		resp, err := service.SearchUsers(context.Background(), &pbv2.SearchUsersRequest{City: "New York"})
+		assert.NoError(t, err)
+		assert.Len(t, resp.Users, 2)
+
+		married := false
+		resp, err = service.SearchUsers(context.Background(), &pbv2.SearchUsersRequest{City: "New York", Married: &married})
+		assert.NoError(t, err)
+		assert.Len(t, resp.Users, 1)
+		assert.Equal(t, "Jane", resp.Users[0].Fname)
+	})
+
+	t.Run("AddUser requires a user", func(t *testing.T) {
+		_, err := service.AddUser(context.Background(), &pbv2.AddUserRequest{})
+		assert.Equal(t, codes.InvalidArgument, status.Code(err))
+	})
+
+	t.Run("v1 and v2 users convert both ways", func(t *testing.T) {
+		v2 := &pbv2.User{Id: 3, Fname: "Bob", Email: "bob@example.com", Address: &pbv2.Address{Street: "1 Main St", City: "Chicago", Country: "US"}, Phone: 5555555555, Height: 175}
+		v1 := ToV1(v2)
+		assert.Equal(t, "Chicago", v1.City)
+		assert.Equal(t, v2, FromV1(v1))
+		assert.Equal(t, "Chicago", FromV1(&pb.User{City: "Chicago"}).Address.City)
+	})
+}
+
+func TestUserRepository_Revisions(t *testing.T) {
+	repo := NewRepository(UserDB{
+		1: {ID: 1, FName: "John", Address: Address{City: "New York"}, Phone: 1234567890, Height: 180.5},
+	})
+	john, err := repo.GetUserById(context.Background(), 1)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), john.CurrentRevision())
+
+	john.Revision = 1
+	john.Address.City = "Boston"
+	updated, err := repo.UpdateUser(context.Background(), john)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(2), updated.Revision)
+
+	// a second writer still holding revision 1 loses
+	john.Address.City = "Chicago"
+	_, err = repo.UpdateUser(context.Background(), john)
+	assert.ErrorIs(t, err, utility.ErrRevisionMismatch)
+	assert.ErrorIs(t, repo.DeleteUser(context.Background(), 1, 1), utility.ErrRevisionMismatch)
+
+	assert.NoError(t, repo.DeleteUser(context.Background(), 1, 2))
+	_, err = repo.GetUserById(context.Background(), 1)
+	assert.ErrorIs(t, err, utility.ErrUserNotFound)
+	assert.ErrorIs(t, repo.DeleteUser(context.Background(), 1, 0), utility.ErrUserNotFound)
+
+	// adding the ID again does not reuse the revisions of the deleted user
+	john.Revision = 0
+	added, err := repo.AddUser(context.Background(), john)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(3), added.Revision)
+	assert.ErrorIs(t, repo.DeleteUser(context.Background(), 1, 1), utility.ErrRevisionMismatch)
+}
+
+func TestUserService_UpdateDelete(t *testing.T) {
+	created := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+	now := created
+	service := NewServiceWithOptions(NewRepository(UserDB{}), ServiceOptions{IDs: fixedIDs{}, Now: func() time.Time { return now }})
+
+	resp, err := service.CreateUser(context.Background(), &pbv2.CreateUserRequest{User: &pbv2.User{Fname: "John", Email: "john@example.com", Address: &pbv2.Address{City: "New York"}, Phone: 1234567890, Height: 180.5}})
+	assert.NoError(t, err)
+	read := resp.User
+	assert.Equal(t, "1", read.Etag)
+
+	now = created.Add(time.Hour)
+	edit := proto.Clone(read).(*pbv2.User)
+	edit.Address.City = "Boston"
+	resp, err = service.UpdateUser(context.Background(), &pbv2.UpdateUserRequest{User: edit})
+	assert.NoError(t, err)
+	assert.Equal(t, "2", resp.User.Etag)
+	assert.Equal(t, "Boston", resp.User.Address.City)
+	assert.Equal(t, created, resp.User.CreateTime.AsTime())
+	assert.Equal(t, now, resp.User.UpdateTime.AsTime())
+
+	got, err := service.GetUserByID(context.Background(), &pbv2.GetUserByIDRequest{Id: read.Id})
+	assert.NoError(t, err)
+	assert.Equal(t, "2", got.User.Etag)
+
+	t.Run("Stale etags are aborted", func(t *testing.T) {
+		_, err := service.UpdateUser(context.Background(), &pbv2.UpdateUserRequest{User: read})
+		assert.Equal(t, codes.Aborted, status.Code(err))
+		_, err = service.DeleteUser(context.Background(), &pbv2.DeleteUserRequest{Id: read.Id, Etag: read.Etag})
+		assert.Equal(t, codes.Aborted, status.Code(err))
+	})
+
+	t.Run("Invalid requests", func(t *testing.T) {
+		_, err := service.DeleteUser(context.Background(), &pbv2.DeleteUserRequest{Id: read.Id, Etag: "W/1"})
+		assert.Equal(t, codes.InvalidArgument, status.Code(err))
+		_, err = service.UpdateUser(context.Background(), &pbv2.UpdateUserRequest{User: &pbv2.User{Id: 42, Fname: "Jim", Address: &pbv2.Address{City: "Boston"}, Phone: 5555555555, Height: 175}})
+		assert.Equal(t, codes.NotFound, status.Code(err))
+	})
+
+	t.Run("Delete without an etag is unconditional", func(t *testing.T) {
+		_, err := service.DeleteUser(context.Background(), &pbv2.DeleteUserRequest{Id: read.Id})
+		assert.NoError(t, err)
+		_, err = service.DeleteUser(context.Background(), &pbv2.DeleteUserRequest{Id: read.Id})
+		assert.Equal(t, codes.NotFound, status.Code(err))
+	})
+}
+
+// fixedIDs always hands out ID 1.
+type fixedIDs struct{}
+
+func (fixedIDs) NextID(ctx context.Context) (UserId, error) {
+	return 1, nil
+}
+
+func TestUserRepository_History(t *testing.T) {
+	jan := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	now := jan.AddDate(0, 1, 0)
+	john := User{ID: 1, FName: "John", Address: Address{City: "New York"}, Phone: 1234567890, Height: 180.5, CreateTime: jan, UpdateTime: jan}
+	repo := NewRepositoryWithOptions(UserDB{1: john}, RepositoryOptions{Now: func() time.Time { return now }})
+	// an imported user keeps its older update time, the version is stamped
+	// with the time of the write
+	jane := User{ID: 2, FName: "Jane", Address: Address{City: "Los Angeles"}, Phone: 9876543210, Height: 165.2, CreateTime: jan, UpdateTime: jan}
+	_, err := repo.AddUser(WithActor(context.Background(), "seed"), jane)
+	assert.NoError(t, err)
+
+	now = jan.AddDate(0, 2, 0)
+	moved := john
+	moved.Address.City = "Boston"
+	moved.UpdateTime = now
+	moved, err = repo.UpdateUser(WithActor(context.Background(), "alice"), moved)
+	assert.NoError(t, err)
+	now = jan.AddDate(0, 3, 0)
+	assert.NoError(t, repo.DeleteUser(context.Background(), 2, 0))
+
+	history, err := repo.GetUserHistory(context.Background(), 1)
+	assert.NoError(t, err)
+	assert.Equal(t, []Version{{User: john, Time: jan}, {User: moved, Actor: "alice", Time: jan.AddDate(0, 2, 0)}}, history)
+
+	history, err = repo.GetUserHistory(context.Background(), 2)
+	assert.NoError(t, err)
+	assert.Len(t, history, 2)
+	assert.Equal(t, "seed", history[0].Actor)
+	assert.Equal(t, jan.AddDate(0, 1, 0), history[0].Time)
+	assert.True(t, history[1].Deleted)
+	assert.Equal(t, jane, history[1].User)
+
+	_, err = repo.GetUserHistory(context.Background(), 3)
+	assert.ErrorIs(t, err, utility.ErrUserNotFound)
+
+	t.Run("As of", func(t *testing.T) {
+		old, err := repo.GetUserByIdAsOf(context.Background(), 1, jan.AddDate(0, 1, 15))
+		assert.NoError(t, err)
+		assert.Equal(t, "New York", old.Address.City)
+		_, err = repo.GetUserByIdAsOf(context.Background(), 2, jan.AddDate(0, 0, 15))
+		assert.ErrorIs(t, err, utility.ErrUserNotFound, "not stored yet")
+
+		users, err := repo.ListUsersAsOf(context.Background(), 0, 0, jan.AddDate(0, 1, 15))
+		assert.NoError(t, err)
+		assert.Equal(t, []User{john, jane}, users)
+		users, err = repo.ListUsersAsOf(context.Background(), 0, 0, time.Now())
+		assert.NoError(t, err)
+		assert.Equal(t, []User{moved}, users)
+	})
+}
+
+func TestFileRepository_History(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "users.json")
+	john := User{ID: 1, FName: "John", Address: Address{City: "New York"}, Phone: 1234567890, Height: 180.5}
+
+	t.Run("Snapshots without history are read", func(t *testing.T) {
+		assert.NoError(t, os.WriteFile(path, []byte(`[{"id": 1, "fname": "John", "city": "New York", "phone": 1234567890, "height": 180.5}]`), 0o600))
+		repo, err := NewFileRepository(path, time.Hour)
+		assert.NoError(t, err)
+		history, err := repo.GetUserHistory(context.Background(), 1)
+		assert.NoError(t, err)
+		assert.Equal(t, []Version{{User: john}}, history)
+
+		moved := john
+		moved.Address.City = "Boston"
+		_, err = repo.UpdateUser(WithActor(context.Background(), "import"), moved)
+		assert.NoError(t, err)
+		assert.NoError(t, repo.Close())
+	})
+
+	t.Run("History survives a restart", func(t *testing.T) {
+		repo, err := NewFileRepository(path, time.Hour)
+		assert.NoError(t, err)
+		defer repo.Close()
+		history, err := repo.GetUserHistory(context.Background(), 1)
+		assert.NoError(t, err)
+		assert.Len(t, history, 2)
+		assert.Equal(t, "import", history[1].Actor)
+		assert.Equal(t, "Boston", history[1].User.Address.City)
+	})
+}
+
+func TestUserService_History(t *testing.T) {
+	created := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+	now := created
+	clock := func() time.Time { return now }
+	service := NewServiceWithOptions(NewRepositoryWithOptions(UserDB{}, RepositoryOptions{Now: clock}), ServiceOptions{Now: clock})
+	ctx := auth.NewContext(context.Background(), auth.Principal{Subject: "alice"})
+
+	resp, err := service.AddUser(ctx, &pbv2.AddUserRequest{User: &pbv2.User{Id: 1, Fname: "John", Address: &pbv2.Address{City: "New York"}, Phone: 1234567890, Height: 180.5}})
+	assert.NoError(t, err)
+	now = created.Add(time.Hour)
+	edit := proto.Clone(resp.User).(*pbv2.User)
+	edit.Address.City = "Boston"
+	_, err = service.UpdateUser(context.Background(), &pbv2.UpdateUserRequest{User: edit})
+	assert.NoError(t, err)
+
+	history, err := service.GetUserHistory(context.Background(), &pbv2.GetUserHistoryRequest{Id: 1})
+	assert.NoError(t, err)
+	assert.Len(t, history.Versions, 2)
+	assert.Equal(t, "alice", history.Versions[0].Actor)
+	assert.Equal(t, created, history.Versions[0].Time.AsTime())
+	assert.Equal(t, "New York", history.Versions[0].User.Address.City)
+	assert.Equal(t, "", history.Versions[1].Actor)
+	assert.Equal(t, "2", history.Versions[1].User.Etag)
+
+	got, err := service.GetUserByID(context.Background(), &pbv2.GetUserByIDRequest{Id: 1, AsOf: timestamppb.New(created.Add(time.Minute))})
+	assert.NoError(t, err)
+	assert.Equal(t, "New York", got.User.Address.City)
+	_, err = service.GetUserByID(context.Background(), &pbv2.GetUserByIDRequest{Id: 1, AsOf: timestamppb.New(created.Add(-time.Minute))})
+	assert.Error(t, err)
+
+	list, err := service.ListUsers(context.Background(), &pbv2.ListUsersRequest{AsOf: timestamppb.New(created.Add(-time.Minute))})
+	assert.NoError(t, err)
+	assert.Empty(t, list.Users)
+
+	_, err = service.GetUserHistory(context.Background(), &pbv2.GetUserHistoryRequest{Id: 2})
+	assert.Equal(t, codes.NotFound, status.Code(err))
+}
+
+func TestTenantRepository(t *testing.T) {
+	acme := tenant.NewContext(context.Background(), "acme")
+	globex := tenant.NewContext(context.Background(), "globex")
+	repo := NewTenantRepository(map[string]Repository{
+		"acme":   NewRepository(UserDB{}),
+		"globex": NewRepository(UserDB{}),
+	})
+	ids := NewTenantGenerator(func() IDGenerator { return NewSequentialGenerator(repo) })
+	service := NewServiceWithOptions(repo, ServiceOptions{IDs: ids})
+
+	create := func(ctx context.Context, fname string) *pbv2.User {
+		resp, err := service.CreateUser(ctx, &pbv2.CreateUserRequest{User: &pbv2.User{Fname: fname, Address: &pbv2.Address{City: "Boston"}, Phone: 5555555555, Height: 175}})
+		assert.NoError(t, err)
+		return resp.User
+	}
+	john := create(acme, "John")
+	jane := create(globex, "Jane")
+	assert.Equal(t, int64(1), john.Id, "every tenant has its own ID space")
+	assert.Equal(t, int64(1), jane.Id)
+
+	got, err := service.GetUserByID(acme, &pbv2.GetUserByIDRequest{Id: 1})
+	assert.NoError(t, err)
+	assert.Equal(t, "John", got.User.Fname)
+	got, err = service.GetUserByID(globex, &pbv2.GetUserByIDRequest{Id: 1})
+	assert.NoError(t, err)
+	assert.Equal(t, "Jane", got.User.Fname)
+
+	assert.Equal(t, 1, repo.CountUsers(acme))
+	assert.Zero(t, repo.CountUsers(context.Background()), "counts no tenant without one")
+	assert.Equal(t, 2, CountAllUsers(repo))
+
+	_, err = repo.GetUserById(context.Background(), 1)
+	assert.ErrorIs(t, err, utility.ErrTenantRequired)
+	_, err = repo.GetUserById(tenant.NewContext(context.Background(), "initech"), 1)
+	assert.ErrorIs(t, err, utility.ErrUnknownTenant)
+	_, err = service.ListUsers(context.Background(), &pbv2.ListUsersRequest{})
+	assert.Equal(t, codes.PermissionDenied, status.Code(err))
+}
+
+func TestUserRepository_Transact(t *testing.T) {
+	newRepo := func() Repository {
+		return NewRepository(UserDB{
+			1: {ID: 1, FName: "John", Email: "john@example.com", Address: Address{City: "New York"}, Phone: 1234567890, Height: 180.5},
+			2: {ID: 2, FName: "Jane", Email: "jane@example.com", Address: Address{City: "Boston"}, Phone: 5555555555, Height: 165},
+		})
+	}
+	jim := User{ID: 3, FName: "Jim", Email: "jim@example.com", Address: Address{City: "Chicago"}, Phone: 4444444444, Height: 175}
+
+	t.Run("Applies every write", func(t *testing.T) {
+		repo := newRepo()
+		john, _ := repo.GetUserById(context.Background(), 1)
+		john.Married = true
+		john.Revision = 1
+		users, err := repo.Transact(context.Background(), []Write{
+			{Kind: WriteCreate, User: jim},
+			{Kind: WriteUpdate, User: john},
+			{Kind: WriteDelete, ID: 2, Revision: 1},
+			{Kind: WriteCheck, ID: 3},
+		})
+		assert.NoError(t, err)
+		assert.Len(t, users, 4)
+		assert.Equal(t, int64(2), users[1].Revision)
+		assert.Equal(t, "Jane", users[2].FName)
+		assert.Equal(t, "Jim", users[3].FName, "later writes see earlier ones")
+		assert.Equal(t, 2, repo.CountUsers(context.Background()))
+	})
+
+	t.Run("Rolls back on failure", func(t *testing.T) {
+		repo := newRepo()
+		john, _ := repo.GetUserById(context.Background(), 1)
+		john.Email = "johnny@example.com"
+		_, err := repo.Transact(context.Background(), []Write{
+			{Kind: WriteCreate, User: jim},
+			{Kind: WriteUpdate, User: john},
+			{Kind: WriteDelete, ID: 2},
+			{Kind: WriteCheck, ID: 1, Revision: 1},
+		})
+		var writeErr *WriteError
+		assert.ErrorAs(t, err, &writeErr)
+		assert.Equal(t, 3, writeErr.Index)
+		assert.ErrorIs(t, err, utility.ErrRevisionMismatch)
+
+		users, err := repo.ListUsers(context.Background(), 0, 0)
+		assert.NoError(t, err)
+		assert.Equal(t, []UserId{1, 2}, []UserId{users[0].ID, users[1].ID})
+		assert.Len(t, users, 2)
+		assert.Equal(t, "john@example.com", users[0].Email)
+		_, err = repo.GetUserHistory(context.Background(), 3)
+		assert.ErrorIs(t, err, utility.ErrUserNotFound)
+		versions, err := repo.GetUserHistory(context.Background(), 1)
+		assert.NoError(t, err)
+		assert.Len(t, versions, 1)
+
+		// the email index is restored too
+		_, err = repo.AddUser(context.Background(), User{ID: 4, FName: "Joe", Email: "johnny@example.com", Address: Address{City: "Denver"}, Phone: 3333333333, Height: 170})
+		assert.NoError(t, err)
+		_, err = repo.AddUser(context.Background(), User{ID: 5, FName: "Joe", Email: "john@example.com", Address: Address{City: "Denver"}, Phone: 3333333333, Height: 170})
+		assert.ErrorIs(t, err, utility.ErrEmailAlreadyExists)
+	})
+
+	t.Run("Invalid writes", func(t *testing.T) {
+		repo := newRepo()
+		_, err := repo.Transact(context.Background(), []Write{{Kind: WriteCheck, ID: 1}, {Kind: WriteCreate, User: User{ID: 3}}})
+		assert.ErrorIs(t, err, utility.ErrInvalidCityInput)
+		_, err = repo.Transact(context.Background(), []Write{{ID: 1}})
+		assert.ErrorIs(t, err, utility.ErrInvalidWrite)
+	})
+}
+
+func TestFileRepository_Transact(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "users.json")
+	repo, err := NewFileRepository(path, time.Hour)
+	assert.NoError(t, err)
+	_, err = repo.Transact(context.Background(), []Write{
+		{Kind: WriteCreate, User: User{ID: 1, FName: "John", Address: Address{City: "New York"}, Phone: 1234567890, Height: 180.5}},
+		{Kind: WriteCreate, User: User{ID: 2, FName: "Jane", Address: Address{City: "Boston"}, Phone: 5555555555, Height: 165}},
+	})
+	assert.NoError(t, err)
+	_, err = repo.Transact(context.Background(), []Write{
+		{Kind: WriteDelete, ID: 1},
+		{Kind: WriteDelete, ID: 3},
+	})
+	assert.ErrorIs(t, err, utility.ErrUserNotFound)
+	assert.NoError(t, repo.Close())
+
+	reopened, err := NewFileRepository(path, time.Hour)
+	assert.NoError(t, err)
+	defer reopened.Close()
+	assert.Equal(t, 2, reopened.CountUsers(context.Background()))
+}
+
+func TestUserService_BatchWrite(t *testing.T) {
+	repo := NewRepository(UserDB{
+		1: {ID: 1, FName: "John", Address: Address{City: "New York"}, Phone: 1234567890, Height: 180.5},
+	})
+	service := NewService(repo)
+	jane := &pbv2.User{Fname: "Jane", Address: &pbv2.Address{City: "Boston"}, Phone: 5555555555, Height: 165}
+	john := &pbv2.User{Id: 1, Etag: "1", Fname: "John", Address: &pbv2.Address{City: "New York"}, Phone: 1234567890, Height: 180.5, Married: true}
+
+	resp, err := service.BatchWrite(context.Background(), &pbv2.BatchWriteRequest{Operations: []*pbv2.WriteOperation{
+		{Operation: &pbv2.WriteOperation_Create{Create: &pbv2.CreateUserRequest{User: jane}}},
+		{Operation: &pbv2.WriteOperation_Create{Create: &pbv2.CreateUserRequest{User: jane}}},
+		{Operation: &pbv2.WriteOperation_Update{Update: &pbv2.UpdateUserRequest{User: john}}},
+	}})
+	assert.NoError(t, err)
+	assert.Len(t, resp.Results, 3)
+	assert.Equal(t, int64(2), resp.Results[0].User.Id)
+	assert.Equal(t, int64(3), resp.Results[1].User.Id)
+	assert.True(t, resp.Results[2].User.Married)
+	assert.Equal(t, "2", resp.Results[2].User.Etag)
+
+	t.Run("Failed batches write nothing", func(t *testing.T) {
+		_, err := service.BatchWrite(context.Background(), &pbv2.BatchWriteRequest{Operations: []*pbv2.WriteOperation{
+			{Operation: &pbv2.WriteOperation_Delete{Delete: &pbv2.DeleteUserRequest{Id: 2}}},
+			{Operation: &pbv2.WriteOperation_Update{Update: &pbv2.UpdateUserRequest{User: john}}},
+		}})
+		assert.Equal(t, codes.Aborted, status.Code(err))
+		assert.Contains(t, status.Convert(err).Message(), "operation 1:")
+		_, err = service.GetUserByID(context.Background(), &pbv2.GetUserByIDRequest{Id: 2})
+		assert.NoError(t, err)
+
+		_, err = service.BatchWrite(context.Background(), &pbv2.BatchWriteRequest{Operations: []*pbv2.WriteOperation{
+			{Operation: &pbv2.WriteOperation_Check{Check: &pbv2.CheckUserRequest{Id: 42}}},
+		}})
+		assert.Equal(t, codes.NotFound, status.Code(err))
+	})
+
+	t.Run("Invalid requests", func(t *testing.T) {
+		_, err := service.BatchWrite(context.Background(), &pbv2.BatchWriteRequest{})
+		assert.Equal(t, codes.InvalidArgument, status.Code(err))
+		_, err = service.BatchWrite(context.Background(), &pbv2.BatchWriteRequest{Operations: []*pbv2.WriteOperation{{}}})
+		assert.Equal(t, codes.InvalidArgument, status.Code(err))
+		_, err = service.BatchWrite(context.Background(), &pbv2.BatchWriteRequest{Operations: []*pbv2.WriteOperation{
+			{Operation: &pbv2.WriteOperation_Create{Create: &pbv2.CreateUserRequest{User: &pbv2.User{Id: 9, Fname: "Jim", Address: &pbv2.Address{City: "Boston"}, Phone: 1, Height: 1}}}},
+		}})
+		assert.Equal(t, codes.InvalidArgument, status.Code(err))
+	})
+}
+
+func TestUserRepository_Outbox(t *testing.T) {
+	repo := NewRepositoryWithOptions(UserDB{}, RepositoryOptions{Outbox: true})
+	feed := repo.(ChangeFeed)
+	john := User{ID: 1, FName: "John", Address: Address{City: "New York"}, Phone: 1234567890, Height: 180.5}
+
+	_, err := repo.AddUser(WithActor(context.Background(), "alice"), john)
+	assert.NoError(t, err)
+	john.Married = true
+	_, err = repo.UpdateUser(context.Background(), john)
+	assert.NoError(t, err)
+	assert.NoError(t, repo.DeleteUser(context.Background(), 1, 0))
+	_, err = repo.AddUser(context.Background(), john)
+	assert.NoError(t, err)
+	// a failed transaction leaves no changes behind
+	_, err = repo.Transact(context.Background(), []Write{{Kind: WriteDelete, ID: 1}, {Kind: WriteCheck, ID: 1}})
+	assert.ErrorIs(t, err, utility.ErrUserNotFound)
+
+	changes, err := feed.PendingChanges(context.Background(), 0)
+	assert.NoError(t, err)
+	assert.Len(t, changes, 4)
+	var types []ChangeType
+	for i, change := range changes {
+		assert.Equal(t, int64(i+1), change.Seq)
+		types = append(types, change.Type)
+	}
+	assert.Equal(t, []ChangeType{ChangeCreated, ChangeUpdated, ChangeDeleted, ChangeCreated}, types)
+	assert.Equal(t, "alice", changes[0].Actor)
+
+	assert.NoError(t, feed.AckChanges(context.Background(), 2))
+	changes, err = feed.PendingChanges(context.Background(), 1)
+	assert.NoError(t, err)
+	assert.Len(t, changes, 1)
+	assert.Equal(t, int64(3), changes[0].Seq)
+
+	_, err = NewRepository(UserDB{}).(ChangeFeed).PendingChanges(context.Background(), 0)
+	assert.ErrorIs(t, err, utility.ErrNoOutbox)
+}
+
+func TestFileRepository_Outbox(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "users.json")
+	repo, err := NewFileRepositoryWithOptions(path, time.Hour, RepositoryOptions{Outbox: true})
+	assert.NoError(t, err)
+	_, err = repo.AddUser(context.Background(), User{ID: 1, FName: "John", Address: Address{City: "New York"}, Phone: 1234567890, Height: 180.5})
+	assert.NoError(t, err)
+
+	changes, err := repo.(ChangeFeed).PendingChanges(context.Background(), 0)
+	assert.NoError(t, err)
+	assert.Empty(t, changes, "changes are published once they are on disk")
+	assert.NoError(t, repo.(*fileRepo).Flush())
+	changes, err = repo.(ChangeFeed).PendingChanges(context.Background(), 0)
+	assert.NoError(t, err)
+	assert.Len(t, changes, 1)
+	assert.NoError(t, repo.Close())
+
+	reopened, err := NewFileRepositoryWithOptions(path, time.Hour, RepositoryOptions{Outbox: true})
+	assert.NoError(t, err)
+	changes, err = reopened.(ChangeFeed).PendingChanges(context.Background(), 0)
+	assert.NoError(t, err)
+	assert.Len(t, changes, 1, "unacknowledged changes survive a restart")
+	assert.NoError(t, reopened.(ChangeFeed).AckChanges(context.Background(), 1))
+	_, err = reopened.AddUser(context.Background(), User{ID: 2, FName: "Jane", Address: Address{City: "Boston"}, Phone: 5555555555, Height: 165})
+	assert.NoError(t, err)
+	assert.NoError(t, reopened.Close())
+
+	reopened, err = NewFileRepositoryWithOptions(path, time.Hour, RepositoryOptions{Outbox: true})
+	assert.NoError(t, err)
+	defer reopened.Close()
+	changes, err = reopened.(ChangeFeed).PendingChanges(context.Background(), 0)
+	assert.NoError(t, err)
+	assert.Len(t, changes, 1)
+	assert.Equal(t, int64(2), changes[0].Seq, "sequence numbers continue")
+}
@@ -3,12 +3,22 @@ package utility
 import "errors"
 
 var (
-	ErrUserNotFound         = errors.New("user not found in db")
-	ErrUserIdAlreadyExists  = errors.New("user with this Id already exists")
-	ErrInvalidSearchRequest = errors.New("invalid search request")
-	ErrInvalidHeightInput   = errors.New("invalid height input")
-	ErrInvalidFNameInput    = errors.New("invalid first name input")
-	ErrInvalidCityInput     = errors.New("invalid city input")
-	ErrInvalidPhoneInput    = errors.New("invalid phone number input")
-	ErrInvalidIdInput       = errors.New("invalid user ID input")
+	ErrUserNotFound            = errors.New("user not found in db")
+	ErrUserIdAlreadyExists     = errors.New("user with this Id already exists")
+	ErrInvalidSearchRequest    = errors.New("invalid search request")
+	ErrInvalidHeightInput      = errors.New("invalid height input")
+	ErrInvalidFNameInput       = errors.New("invalid first name input")
+	ErrInvalidCityInput        = errors.New("invalid city input")
+	ErrInvalidPhoneInput       = errors.New("invalid phone number input")
+	ErrInvalidIdInput          = errors.New("invalid user ID input")
+	ErrInvalidEmailInput       = errors.New("invalid email input")
+	ErrEmailAlreadyExists      = errors.New("user with this email already exists")
+	ErrInvalidDateOfBirthInput = errors.New("invalid date of birth input")
+	ErrInvalidCountryInput     = errors.New("invalid country input")
+	ErrRevisionMismatch        = errors.New("user was modified since it was read, revision does not match")
+	ErrInvalidWrite            = errors.New("write must be a create, update, delete or check")
+	ErrNoOutbox                = errors.New("repository has no outbox")
+	ErrDrainTimeout            = errors.New("drain timeout exceeded, in-flight RPCs were cancelled")
+	ErrTenantRequired          = errors.New("no tenant given")
+	ErrUnknownTenant           = errors.New("unknown tenant")
 )
@@ -0,0 +1,39 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/kunal768/go-grpc-tc/audit"
+	"github.com/kunal768/go-grpc-tc/config"
+)
+
+// runVerifyAudit checks the hash chain of the audit log at -file, or at the
+// configured audit.path.
+func runVerifyAudit(args []string) error {
+	fs := flag.NewFlagSet("verify-audit", flag.ContinueOnError)
+	file := fs.String("file", "", "audit log to verify, audit.path if empty")
+
+	cfg, _, err := config.Load(fs, args, os.LookupEnv)
+	if err != nil {
+		return err
+	}
+	path := *file
+	if path == "" {
+		path = cfg.Audit.Path
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	last, err := audit.Verify(f)
+	if err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+	fmt.Printf("%s: %d records verified, last hash %s\n", path, last.Seq, last.Hash)
+	return nil
+}